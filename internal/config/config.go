@@ -4,6 +4,8 @@ package config
 type AppConfig struct {
 	Debug   bool
 	Version string
+	Palette string // Built-in palette preset name or path to a .pal file
+	Input   string // Controller port device, "auto" to follow the ROM header
 }
 
 // NewConfig returns a new configuration with default values
@@ -11,5 +13,7 @@ func NewConfig() *AppConfig {
 	return &AppConfig{
 		Debug:   false,
 		Version: "0.1.0",
+		Palette: "2c02",
+		Input:   "auto",
 	}
 }
\ No newline at end of file
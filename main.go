@@ -1,24 +1,97 @@
 package main
 
 import (
+	"crypto/md5"
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/example/my-golang-project/internal/config"
+	"github.com/example/my-golang-project/pkg/apu"
 	"github.com/example/my-golang-project/pkg/debug"
+	"github.com/example/my-golang-project/pkg/input"
+	"github.com/example/my-golang-project/pkg/movie"
 	"github.com/example/my-golang-project/pkg/nes"
+	"github.com/example/my-golang-project/pkg/nsf"
+	"github.com/example/my-golang-project/pkg/ppu"
 )
 
 func main() {
+	// The nsf subcommand plays music files instead of running a ROM
+	if len(os.Args) > 1 && os.Args[1] == "nsf" {
+		runNSF(os.Args[2:])
+		return
+	}
+
+	cfg := config.NewConfig()
+
 	// Command line flags
 	debugMode := flag.Bool("debug", false, "Run in debug mode with UI")
 	//romPath := flag.String("rom", "roms/test_cpu_exec_space_apu.nes", "Path to ROM file")
 	//romPath := flag.String("rom", "roms/official_only.nes", "Path to ROM file")
 	romPath := flag.String("rom", "roms/Legend of Zelda, The (USA) (Rev A).nes", "Path to ROM file")
 	//romPath := flag.String("rom", "roms/cpu_dummy_reads.nes", "Path to ROM file")
+	regionName := flag.String("region", "auto", "Console region: auto, ntsc, pal or dendy")
+	paletteName := flag.String("palette", cfg.Palette, "Palette preset (2c02, 2c03, 2c05, fceux) or path to a .pal file")
+	ntscFilter := flag.Bool("ntsc", false, "Apply the NTSC composite video filter")
+	ntscSharpness := flag.Float64("ntsc-sharpness", ppu.DefaultNTSCOptions().Sharpness, "NTSC filter sharpness, 0 (soft) to 1 (sharp)")
+	ntscSaturation := flag.Float64("ntsc-saturation", ppu.DefaultNTSCOptions().Saturation, "NTSC filter color saturation, 0 (grayscale) to 2, 1 is neutral")
+	scaleFilter := flag.String("scale", ppu.ScaleNearest, "Upscaler: nearest, scale2x, scale3x, hq2x, hq3x, xbrz2x, xbrz3x or xbrz4x")
+	scaleFactor := flag.Int("scale-factor", 1, "Integer factor for the nearest upscaler")
+	scanlines := flag.Float64("scanlines", 0, "Darken every other scaled line by this amount (0-1)")
+	aspect := flag.Bool("aspect", false, "Stretch the output to the 8:7 pixel aspect ratio")
+	volume := flag.Float64("volume", 1.0, "Master volume, 0-1")
+	mute := flag.Bool("mute", false, "Start with the sound muted")
+	audioSync := flag.Bool("audio-sync", false, "Pace the emulation by the audio clock instead of the frame rate")
+	recordPath := flag.String("record", "", "Record the audio output to a 16-bit PCM .wav file")
+	recordStems := flag.Bool("record-stems", false, "With -record, also record each APU channel to its own file")
+	moviePlay := flag.String("movie", "", "Play back an .fm2 input movie from power-on")
+	movieRecord := flag.String("record-movie", "", "Record the controllers to an .fm2 input movie")
+	headlessFrames := flag.Int("headless", 0, "Run this many frames without a window and exit")
+	exportPalette := flag.String("export-palette", "", "Write the selected palette to a .pal file and exit")
+	inputDevice := flag.String("input-device", cfg.Input, "Controller port device: auto, standard, fourscore, zapper, arkanoid, arkanoid-famicom, powerpad-a, powerpad-b or keyboard")
+	inputConfig := flag.String("input", "", "JSON file with the keyboard and gamepad bindings")
+	exportInput := flag.String("export-input", "", "Write the input bindings to a JSON file and exit")
 
 	flag.Parse()
 
+	// Load the color palette
+	palette, err := ppu.LoadPalette(*paletteName)
+	if err != nil {
+		fmt.Printf("Error loading palette: %v\n", err)
+		return
+	}
+	if *exportPalette != "" {
+		if err := ppu.ExportPaletteFile(*exportPalette, palette); err != nil {
+			fmt.Printf("Error exporting palette: %v\n", err)
+		}
+		return
+	}
+
+	// Load the controller bindings
+	bindings := input.DefaultBindings()
+	if *inputConfig != "" {
+		bindings, err = input.LoadBindings(*inputConfig)
+		if err != nil {
+			fmt.Printf("Error loading input bindings: %v\n", err)
+			return
+		}
+	}
+	if *exportInput != "" {
+		if err := input.SaveBindings(*exportInput, bindings); err != nil {
+			fmt.Printf("Error exporting input bindings: %v\n", err)
+		}
+		return
+	}
+
+	// A movie is either played back or recorded
+	if *moviePlay != "" && *movieRecord != "" {
+		fmt.Println("Error: -movie and -record-movie can't be used together")
+		return
+	}
+
 	// Check if the ROM file exists
 	if _, err := os.Stat(*romPath); os.IsNotExist(err) {
 		fmt.Printf("Error: ROM file not found: %s\n", *romPath)
@@ -27,6 +100,7 @@ func main() {
 
 	// Create a new NES instance
 	nesSystem := nes.New()
+	nesSystem.PPU.SetColorPalette(palette)
 
 	// Read the NES ROM file
 	header, prgROM, err := nes.ReadNESFile(*romPath)
@@ -45,11 +119,94 @@ func main() {
 	// Load the ROM data
 	nesSystem.LoadROM(prgROM.Data)
 
-	// Reset the NES components
-	nesSystem.Reset()
+	// Select the console region, from the header unless overridden
+	region := nes.RegionFromHeader(header)
+	if *regionName != "auto" {
+		region, err = nes.ParseRegion(*regionName)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+	}
+	nesSystem.SetRegion(region)
+	fmt.Printf("Region: %s\n", region)
+
+	// Plug in the input device, from the header unless overridden
+	device, _ := nes.DeviceFromHeader(header)
+	if *inputDevice != "auto" {
+		device, err = input.ParseDeviceType(*inputDevice)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+	}
+	nesSystem.ConnectInput(device)
+	fmt.Printf("Input device: %s\n", device)
+
+	// Power on the NES components
+	nesSystem.PowerOn()
 
 	fmt.Println("\nNES system initialized successfully.")
 
+	// Record the audio until the emulation ends
+	if *recordPath != "" {
+		err := nesSystem.APU.StartRecording(*recordPath, apu.RecordOptions{Stems: *recordStems})
+		if err != nil {
+			fmt.Printf("Error starting audio recording: %v\n", err)
+			return
+		}
+		defer func() {
+			if err := nesSystem.APU.StopRecording(); err != nil {
+				fmt.Printf("Error finishing audio recording: %v\n", err)
+			} else {
+				fmt.Printf("Audio recorded to %s\n", *recordPath)
+			}
+		}()
+	}
+
+	// Play back or record an input movie
+	if *moviePlay != "" {
+		m, err := movie.LoadFile(*moviePlay)
+		if err != nil {
+			fmt.Printf("Error loading movie: %v\n", err)
+			return
+		}
+		if err := nesSystem.PlayMovie(m); err != nil {
+			fmt.Printf("Error playing movie: %v\n", err)
+			return
+		}
+		fmt.Printf("Playing movie %s, %d frames\n", *moviePlay, len(m.Frames))
+	} else if *movieRecord != "" {
+		m := nesSystem.RecordMovie()
+		m.ROMFilename = strings.TrimSuffix(filepath.Base(*romPath), filepath.Ext(*romPath))
+		if data, err := os.ReadFile(*romPath); err == nil && len(data) > 16 {
+			checksum := md5.Sum(data[16:])
+			m.ROMChecksum = checksum[:]
+		}
+		defer func() {
+			m := nesSystem.StopMovie()
+			if err := m.SaveFile(*movieRecord); err != nil {
+				fmt.Printf("Error saving movie: %v\n", err)
+			} else {
+				fmt.Printf("Movie recorded to %s, %d frames\n", *movieRecord, len(m.Frames))
+			}
+		}()
+	}
+
+	// Run without a window for a fixed number of frames
+	if *headlessFrames > 0 {
+		fmt.Printf("Running %d frames headless...\n", *headlessFrames)
+		for i := 0; i < *headlessFrames; i++ {
+			if err := nesSystem.RunFrame(); err != nil {
+				fmt.Printf("Error running emulation: %v\n", err)
+				return
+			}
+		}
+		// The hash of the last frame lets movies be used as regression tests
+		fmt.Printf("Frame %d hash: %016x\n", *headlessFrames, ppu.HashFrame(nesSystem.PPU.Frame()))
+		return
+	}
+
 	// Run in debug mode if flag is set
 	if *debugMode {
 		fmt.Println("Starting debug UI with graphics...")
@@ -59,8 +216,87 @@ func main() {
 	} else {
 		// Run in normal mode with game rendering
 		fmt.Println("Running NES emulation with graphics...")
-		if err := nes.StartGame(nesSystem); err != nil {
+		options := nes.GameOptions{
+			NTSCFilter: *ntscFilter,
+			NTSC: ppu.NTSCOptions{
+				Sharpness:  *ntscSharpness,
+				Saturation: *ntscSaturation,
+			},
+			Scale: ppu.ScaleOptions{
+				Filter:      *scaleFilter,
+				Factor:      *scaleFactor,
+				Scanlines:   *scanlines,
+				AspectRatio: *aspect,
+			},
+			Volume:    *volume,
+			Mute:      *mute,
+			AudioSync: *audioSync,
+			Bindings:  bindings,
+			StatePath: strings.TrimSuffix(*romPath, filepath.Ext(*romPath)),
+		}
+		if err := nes.StartGame(nesSystem, options); err != nil {
 			fmt.Printf("Error running game: %v\n", err)
 		}
 	}
 }
+
+// runNSF plays an .nsf or .nsfe file: nsf [flags] file
+func runNSF(args []string) {
+	flags := flag.NewFlagSet("nsf", flag.ExitOnError)
+	track := flags.Int("track", 0, "Track to start with, 0 for the file's default")
+	volume := flags.Float64("volume", 1.0, "Master volume, 0-1")
+	mute := flags.Bool("mute", false, "Start with the sound muted")
+	recordPath := flags.String("record", "", "Record the audio output to a 16-bit PCM .wav file")
+	headlessSeconds := flags.Int("headless", 0, "Play this many seconds without a window and exit")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		fmt.Println("Usage: nsf [flags] file.nsf")
+		flags.PrintDefaults()
+		return
+	}
+
+	file, err := nsf.LoadFile(flags.Arg(0))
+	if err != nil {
+		fmt.Printf("Error loading NSF file: %v\n", err)
+		return
+	}
+	fmt.Printf("Title: %s\nArtist: %s\nCopyright: %s\nSongs: %d\n", file.Title, file.Artist, file.Copyright, file.TotalSongs)
+	if chips := nsf.ChipNames(file.Chips); len(chips) > 0 {
+		fmt.Printf("Expansion audio: %s\n", strings.Join(chips, ", "))
+	}
+
+	nesSystem := nes.New()
+	player := nes.NewNSFPlayer(nesSystem, file)
+	if *track > 0 {
+		file.StartSong = *track
+	}
+
+	if *recordPath != "" {
+		if err := nesSystem.APU.StartRecording(*recordPath, apu.RecordOptions{}); err != nil {
+			fmt.Printf("Error starting audio recording: %v\n", err)
+			return
+		}
+		defer func() {
+			if err := nesSystem.APU.StopRecording(); err != nil {
+				fmt.Printf("Error finishing audio recording: %v\n", err)
+			} else {
+				fmt.Printf("Audio recorded to %s\n", *recordPath)
+			}
+		}()
+	}
+
+	if *headlessSeconds > 0 {
+		player.StartTrack(file.StartSong)
+		cycles := uint64(*headlessSeconds) * uint64(nesSystem.APU.GetTiming().CPUClock)
+		if err := player.Run(cycles); err != nil {
+			fmt.Printf("Error running emulation: %v\n", err)
+		}
+		return
+	}
+
+	options := nes.GameOptions{Volume: *volume, Mute: *mute}
+	if err := nes.StartNSFPlayer(player, options); err != nil {
+		fmt.Printf("Error running NSF player: %v\n", err)
+	}
+}
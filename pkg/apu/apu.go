@@ -11,71 +11,300 @@ type APU struct {
 	DMC        DMCChannel
 	
 	// Frame counter
-	FrameCounter     uint8
-	FrameCounterMode uint8
+	FrameCounter     uint8 // Next step of the sequence
+	FrameCounterMode uint8 // FrameCounterFourStep or FrameCounterFiveStep
 	IRQInhibit       bool
+	FrameIRQ         bool // Frame interrupt flag, bit 6 of $4015
+	frameCycle       uint32
+	frameWriteValue  uint8 // Last $4017 write, applied after a short delay
+	frameWriteDelay  uint8
 	
-	// Output buffer
-	AudioSamples []float32
+	// Mixed output resampled to PCM
+	output     *blipBuffer
+	sampleRate int
+	recorder   *recorder // WAV recording in progress, nil when not recording
+	
+	// Debugging: channels left out of the mix and oscilloscope history
+	muted    [ChannelCount]bool
+	soloed   [ChannelCount]bool
+	silenced [ChannelCount]bool
+	scope    [ChannelCount][ScopeSize]uint8
+	scopePos int
+	
+	// Region-dependent rates
+	timing Timing
+	
+	// CPU cycles since power on, the pulse timers tick on every other one
+	cycle uint64
+	
+	// Reference to memory for DMC sample fetches
+	Memory interface {
+		Read(address uint16) byte
+	}
+	
+	// Expansion sound chip on the cartridge, mixed with the APU's output
+	Expansion interface {
+		Step()
+		Output() float32
+	}
+	
+	// Reference to CPU for DMC stalls and the IRQ line
+	CPU interface {
+		Stall(cycles uint16)
+		SetIRQ(source uint8, active bool)
+	}
+}
+
+// NewAPU creates a new APU instance
+func NewAPU() *APU {
+	return &APU{
+		Pulse1:     newPulseChannel(1),
+		Pulse2:     newPulseChannel(2),
+		Noise:      newNoiseChannel(),
+		DMC:        newDMCChannel(),
+		output:     newBlipBuffer(NTSCTiming.CPUClock, DefaultSampleRate),
+		sampleRate: DefaultSampleRate,
+		timing:     NTSCTiming,
+	}
+}
+
+// PowerOn puts the APU in its power-up state
+func (a *APU) PowerOn() {
+	a.frameWriteValue = 0
+	a.IRQInhibit = false
+	a.Reset()
 }
 
-// PulseChannel represents one of the two pulse wave channels
-type PulseChannel struct {
-	Enabled     bool
-	DutyCycle   uint8
-	Volume      uint8
-	SweepEnabled bool
-	Period      uint16
-	LengthCounter uint8
+// Reset resets the APU like the reset button does
+// All channels are silenced, and the frame counter restarts in the mode of
+// the last $4017 write, as if it was written again
+func (a *APU) Reset() {
+	a.Pulse1 = newPulseChannel(1)
+	a.Pulse2 = newPulseChannel(2)
+	a.Triangle = TriangleChannel{}
+	a.Noise = newNoiseChannel()
+	a.DMC = newDMCChannel()
+	a.DMC.Period = a.dmcRates()[0]
+	
+	a.output = newBlipBuffer(a.timing.CPUClock, a.sampleRate)
+	a.cycle = 0
+	
+	a.FrameCounter = 0
+	a.FrameCounterMode = FrameCounterFourStep
+	a.FrameIRQ = false
+	a.frameCycle = 0
+	a.writeFrameCounter(a.frameWriteValue)
+	a.updateIRQ()
 }
 
-// TriangleChannel represents the triangle wave channel
-type TriangleChannel struct {
-	Enabled     bool
-	Period      uint16
-	LengthCounter uint8
+// SetMemory sets the memory interface the DMC reads samples from
+func (a *APU) SetMemory(memory interface {
+	Read(address uint16) byte
+}) {
+	a.Memory = memory
 }
 
-// NoiseChannel represents the noise channel
-type NoiseChannel struct {
-	Enabled     bool
-	Volume      uint8
-	Period      uint16
-	LengthCounter uint8
-	Mode        bool
+// SetExpansion sets the cartridge's expansion sound chip, nil removes it
+func (a *APU) SetExpansion(expansion interface {
+	Step()
+	Output() float32
+}) {
+	a.Expansion = expansion
 }
 
-// DMCChannel represents the Delta Modulation Channel
-type DMCChannel struct {
-	Enabled     bool
-	DirectLoad  uint8
-	SampleAddress uint16
-	SampleLength uint16
+// SetCPU sets the CPU interface used for DMC stalls and IRQs
+func (a *APU) SetCPU(cpu interface {
+	Stall(cycles uint16)
+	SetIRQ(source uint8, active bool)
+}) {
+	a.CPU = cpu
 }
 
-// NewAPU creates a new APU instance
-func NewAPU() *APU {
-	return &APU{
-		AudioSamples: make([]float32, 0),
+// ReadRegister reads an APU register, only $4015 is readable
+// Reading $4015 acknowledges the frame interrupt
+func (a *APU) ReadRegister(address uint16) uint8 {
+	if address != 0x4015 {
+		return 0
+	}
+
+	// Each bit tells whether a channel's length counter is still running
+	var status uint8
+	if a.Pulse1.LengthCounter > 0 {
+		status |= 0x01
+	}
+	if a.Pulse2.LengthCounter > 0 {
+		status |= 0x02
+	}
+	if a.Triangle.LengthCounter > 0 {
+		status |= 0x04
+	}
+	if a.Noise.LengthCounter > 0 {
+		status |= 0x08
+	}
+	if a.DMC.BytesRemaining > 0 {
+		status |= 0x10
 	}
+	if a.FrameIRQ {
+		status |= 0x40
+	}
+	if a.DMC.IRQFlag {
+		status |= 0x80
+	}
+	
+	a.FrameIRQ = false
+	a.updateIRQ()
+	return status
 }
 
-// Reset resets the APU to its initial state
-func (a *APU) Reset() {
-	a.Pulse1 = PulseChannel{}
-	a.Pulse2 = PulseChannel{}
-	a.Triangle = TriangleChannel{}
-	a.Noise = NoiseChannel{}
-	a.DMC = DMCChannel{}
+// WriteRegister writes an APU register
+func (a *APU) WriteRegister(address uint16, value uint8) {
+	switch address {
+	case 0x4000:
+		a.Pulse1.writeControl(value)
+	case 0x4001:
+		a.Pulse1.writeSweep(value)
+	case 0x4002:
+		a.Pulse1.writeTimerLow(value)
+	case 0x4003:
+		a.Pulse1.writeTimerHigh(value)
+	case 0x4004:
+		a.Pulse2.writeControl(value)
+	case 0x4005:
+		a.Pulse2.writeSweep(value)
+	case 0x4006:
+		a.Pulse2.writeTimerLow(value)
+	case 0x4007:
+		a.Pulse2.writeTimerHigh(value)
+	case 0x4008:
+		a.Triangle.writeLinear(value)
+	case 0x400A:
+		a.Triangle.writeTimerLow(value)
+	case 0x400B:
+		a.Triangle.writeTimerHigh(value)
+	case 0x400C:
+		a.Noise.writeControl(value)
+	case 0x400E:
+		a.Noise.writePeriod(value, a.noisePeriods())
+	case 0x400F:
+		a.Noise.writeLength(value)
+	case 0x4010:
+		a.DMC.writeControl(value, a.dmcRates())
+		a.updateIRQ()
+	case 0x4011:
+		a.DMC.writeLevel(value)
+	case 0x4012:
+		a.DMC.writeAddress(value)
+	case 0x4013:
+		a.DMC.writeLength(value)
+	case 0x4015:
+		a.Pulse1.setEnabled(value&0x01 != 0)
+		a.Pulse2.setEnabled(value&0x02 != 0)
+		a.Triangle.setEnabled(value&0x04 != 0)
+		a.Noise.setEnabled(value&0x08 != 0)
+		a.DMC.setEnabled(value&0x10 != 0)
+		a.updateIRQ()
+	case 0x4017:
+		a.writeFrameCounter(value)
+	}
+}
+
+// Step advances the APU by one CPU cycle
+func (a *APU) Step() {
+	// The pulse timers are clocked by the APU clock, half the CPU clock
+	if a.cycle%2 == 1 {
+		a.Pulse1.stepTimer()
+		a.Pulse2.stepTimer()
+		a.Noise.stepTimer()
+	}
+	a.Triangle.stepTimer()
 	
-	a.FrameCounter = 0
-	a.FrameCounterMode = 0
-	a.IRQInhibit = false
+	a.DMC.stepTimer()
+	if a.Memory != nil {
+		a.DMC.stepReader(a.Memory.Read, a.stall)
+	}
 	
-	a.AudioSamples = make([]float32, 0)
+	a.stepFrameCounter()
+	a.updateIRQ()
+	
+	mix := a.mix()
+	if a.Expansion != nil {
+		a.Expansion.Step()
+		mix += a.Expansion.Output()
+	}
+	a.output.clock(mix)
+	if a.recorder != nil {
+		a.record(mix)
+	}
+	a.stepScope()
+	
+	a.cycle++
 }
 
-// Step advances the APU by one cycle
-func (a *APU) Step() {
-	// TODO: Implement APU cycle emulation
+// SetSampleRate sets the rate of the PCM returned by ReadSamples, e.g. 44100 or 48000
+// Samples not read yet are discarded
+func (a *APU) SetSampleRate(rate int) {
+	a.sampleRate = rate
+	a.output = newBlipBuffer(a.timing.CPUClock, rate)
+}
+
+// AdjustSampleRate produces samples ratio times faster than the nominal rate,
+// without discarding anything, e.g. 1.002 to fill an audio buffer a bit faster
+func (a *APU) AdjustSampleRate(ratio float64) {
+	a.output.adjustRate(ratio)
+}
+
+// SampleRate returns the rate of the PCM returned by ReadSamples
+func (a *APU) SampleRate() int {
+	return a.sampleRate
+}
+
+// ReadSamples fills dst with mono PCM samples in the -1 to 1 range and
+// returns how many were written, which is less than len(dst) when the
+// emulation hasn't produced enough yet
+func (a *APU) ReadSamples(dst []float32) int {
+	return a.output.read(dst)
+}
+
+// SamplesAvailable returns how many samples ReadSamples can return right now
+func (a *APU) SamplesAvailable() int {
+	return a.output.available()
+}
+
+// stall halts the CPU while the DMC fetches a sample
+func (a *APU) stall(cycles uint16) {
+	if a.CPU != nil {
+		a.CPU.Stall(cycles)
+	}
+}
+
+// noisePeriods returns the noise period table of the current region
+func (a *APU) noisePeriods() *[16]uint16 {
+	if a.timing.PAL {
+		return &noisePeriodsPAL
+	}
+	return &noisePeriodsNTSC
+}
+
+// dmcRates returns the DMC rate table of the current region
+func (a *APU) dmcRates() *[16]uint16 {
+	if a.timing.PAL {
+		return &dmcRatesPAL
+	}
+	return &dmcRatesNTSC
+}
+
+// quarterFrame clocks the envelopes and the linear counter, called by the frame counter
+func (a *APU) quarterFrame() {
+	a.Pulse1.clockEnvelope()
+	a.Pulse2.clockEnvelope()
+	a.Triangle.clockLinear()
+	a.Noise.clockEnvelope()
+}
+
+// halfFrame clocks the length counters and sweeps, called by the frame counter
+func (a *APU) halfFrame() {
+	a.Pulse1.clockLengthAndSweep()
+	a.Pulse2.clockLengthAndSweep()
+	a.Triangle.clockLength()
+	a.Noise.clockLength()
 }
\ No newline at end of file
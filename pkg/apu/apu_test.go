@@ -0,0 +1,848 @@
+package apu
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// testCPU records the IRQ line driven by the APU and the DMC's stalls
+type testCPU struct {
+	irq    map[uint8]bool
+	stalls []uint16
+}
+
+func (c *testCPU) Stall(cycles uint16) {
+	c.stalls = append(c.stalls, cycles)
+}
+
+func (c *testCPU) SetIRQ(source uint8, active bool) {
+	c.irq[source] = active
+}
+
+// newTestAPU powers on an APU connected to a testCPU
+func newTestAPU(timing Timing) (*APU, *testCPU) {
+	cpu := &testCPU{irq: map[uint8]bool{}}
+	a := NewAPU()
+	a.SetTiming(timing)
+	a.SetCPU(cpu)
+	a.PowerOn()
+	return a, cpu
+}
+
+// stepUntil runs the APU until done returns true, returning the cycles run,
+// or -1 if it takes more than limit cycles
+func stepUntil(a *APU, limit int, done func() bool) int {
+	for cycles := 1; cycles <= limit; cycles++ {
+		a.Step()
+		if done() {
+			return cycles
+		}
+	}
+	return -1
+}
+
+func TestFrameIRQ(t *testing.T) {
+	tests := []struct {
+		name   string
+		timing Timing
+		value  uint8 // Written to $4017
+		want   int   // CPU cycles until the IRQ, -1 for none
+	}{
+		// The write applies on the third cycle, frame cycle 1
+		{"NTSC 4-step", NTSCTiming, 0x00, 2 + 29828},
+		{"PAL 4-step", PALTiming, 0x00, 2 + 33252},
+		{"Dendy 4-step", DendyTiming, 0x00, 2 + 29828},
+		{"inhibited", NTSCTiming, 0x40, -1},
+		{"5-step", NTSCTiming, 0x80, -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, cpu := newTestAPU(tt.timing)
+			a.WriteRegister(0x4017, tt.value)
+
+			got := stepUntil(a, 2*41566, func() bool { return a.FrameIRQ })
+			if got != tt.want {
+				t.Fatalf("frame IRQ after %d cycles, want %d", got, tt.want)
+			}
+			if got < 0 {
+				return
+			}
+			if !anyIRQ(cpu) {
+				t.Error("frame IRQ not signalled to the CPU")
+			}
+			if status := a.ReadRegister(0x4015); status&0x40 == 0 {
+				t.Errorf("$4015 = %#02x, want the frame IRQ bit set", status)
+			}
+			if a.FrameIRQ || anyIRQ(cpu) {
+				t.Error("reading $4015 didn't acknowledge the frame IRQ")
+			}
+		})
+	}
+}
+
+// anyIRQ reports whether any source holds the CPU's IRQ line
+func anyIRQ(cpu *testCPU) bool {
+	for _, active := range cpu.irq {
+		if active {
+			return true
+		}
+	}
+	return false
+}
+
+func TestInhibitClearsFrameIRQ(t *testing.T) {
+	a, cpu := newTestAPU(NTSCTiming)
+	stepUntil(a, 30000, func() bool { return a.FrameIRQ })
+	a.WriteRegister(0x4017, 0x40)
+	if a.FrameIRQ || anyIRQ(cpu) {
+		t.Error("setting the inhibit flag didn't clear the frame IRQ")
+	}
+}
+
+func TestLengthCounter(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       uint8 // $4017 value
+		halfFrames []int // Frame cycles of the half frames
+	}{
+		{"4-step", 0x00, []int{14913, 29829}},
+		{"5-step", 0x80, []int{0, 14913, 37281}}, // The write clocks one at once
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _ := newTestAPU(NTSCTiming)
+			a.WriteRegister(0x4015, 0x01)
+			a.WriteRegister(0x4003, 0x18) // Length index 3: 2 half frames
+			if a.Pulse1.LengthCounter != 2 {
+				t.Fatalf("length counter = %d, want 2", a.Pulse1.LengthCounter)
+			}
+			a.WriteRegister(0x4017, tt.mode)
+
+			// The write applies on the third cycle, frame cycle 1
+			wantSilent := 2 + tt.halfFrames[1]
+			got := stepUntil(a, 40000, func() bool { return a.ReadRegister(0x4015)&0x01 == 0 })
+			if got != wantSilent {
+				t.Errorf("channel silenced after %d cycles, want %d", got, wantSilent)
+			}
+		})
+	}
+}
+
+func TestLengthCounterDisabled(t *testing.T) {
+	a, _ := newTestAPU(NTSCTiming)
+	a.WriteRegister(0x4003, 0x08) // Ignored while the channel is disabled
+	if a.Pulse1.LengthCounter != 0 {
+		t.Errorf("length counter = %d while disabled, want 0", a.Pulse1.LengthCounter)
+	}
+
+	a.WriteRegister(0x4015, 0x01)
+	a.WriteRegister(0x4003, 0x08) // Length index 1: 254
+	if a.Pulse1.LengthCounter != 254 {
+		t.Errorf("length counter = %d, want 254", a.Pulse1.LengthCounter)
+	}
+	a.WriteRegister(0x4015, 0x00)
+	if a.Pulse1.LengthCounter != 0 {
+		t.Errorf("length counter = %d after disabling, want 0", a.Pulse1.LengthCounter)
+	}
+}
+
+func TestPulseDuty(t *testing.T) {
+	tests := []struct {
+		duty uint8
+		high int // CPU cycles of one 144-cycle period with output
+	}{
+		{0, 18},
+		{1, 36},
+		{2, 72},
+		{3, 108},
+	}
+
+	for _, tt := range tests {
+		a, _ := newTestAPU(NTSCTiming)
+		a.WriteRegister(0x4015, 0x01)
+		a.WriteRegister(0x4000, tt.duty<<6|0x10|0x0F) // Constant volume 15
+		a.WriteRegister(0x4002, 8)                    // 9 APU cycles per step
+		a.WriteRegister(0x4003, 0x08)
+
+		high := 0
+		for i := 0; i < 144; i++ {
+			a.Step()
+			if level := a.Pulse1.Output(); level == 15 {
+				high++
+			} else if level != 0 {
+				t.Fatalf("duty %d: output %d, want 0 or 15", tt.duty, level)
+			}
+		}
+		if high != tt.high {
+			t.Errorf("duty %d: %d cycles high, want %d", tt.duty, high, tt.high)
+		}
+	}
+}
+
+func TestPulseSweep(t *testing.T) {
+	tests := []struct {
+		name    string
+		channel int
+		period  uint16
+		sweep   uint8 // $4001 value
+		target  uint16
+		muted   bool
+	}{
+		{"add", 1, 0x100, 0x81, 0x180, false},
+		{"pulse 1 subtracts one more", 1, 0x100, 0x89, 0x07F, false},
+		{"pulse 2 negate", 2, 0x100, 0x89, 0x080, false},
+		{"target overflow mutes", 2, 0x600, 0x81, 0x900, true},
+		{"low period mutes", 2, 0x007, 0x00, 0x00E, true},
+		{"overflow mutes with the sweep off", 2, 0x7FF, 0x00, 0xFFE, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPulseChannel(tt.channel)
+			p.setEnabled(true)
+			p.writeControl(0x10 | 0x0F)
+			p.writeSweep(tt.sweep)
+			p.writeTimerLow(uint8(tt.period))
+			p.writeTimerHigh(uint8(tt.period>>8) | 0x08)
+
+			if target := p.targetPeriod(); target != tt.target {
+				t.Errorf("target period = %#x, want %#x", target, tt.target)
+			}
+			if muted := p.sweepMuted(p.targetPeriod()); muted != tt.muted {
+				t.Errorf("muted = %v, want %v", muted, tt.muted)
+			}
+		})
+	}
+}
+
+func TestEnvelopeDecay(t *testing.T) {
+	var e Envelope
+	e.write(0x02) // Decay, divider period 2
+	e.Start = true
+
+	e.clock()
+	if e.output() != 15 {
+		t.Fatalf("output after start = %d, want 15", e.output())
+	}
+	// The level drops every 3 quarter frames
+	for level := 14; level >= 0; level-- {
+		for i := 0; i < 3; i++ {
+			e.clock()
+		}
+		if int(e.output()) != level {
+			t.Fatalf("output = %d, want %d", e.output(), level)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		e.clock()
+	}
+	if e.output() != 0 {
+		t.Errorf("output without loop = %d, want 0", e.output())
+	}
+
+	e.write(0x22) // Loop
+	for i := 0; i < 3; i++ {
+		e.clock()
+	}
+	if e.output() != 15 {
+		t.Errorf("output with loop = %d, want 15", e.output())
+	}
+}
+
+func TestTriangleLinearCounter(t *testing.T) {
+	tests := []struct {
+		name    string
+		control uint8   // $4008 value
+		want    []uint8 // Linear counter after each quarter frame
+	}{
+		{"counts down", 0x03, []uint8{3, 2, 1, 0, 0}},
+		{"control keeps reloading", 0x83, []uint8{3, 3, 3, 3, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tri TriangleChannel
+			tri.setEnabled(true)
+			tri.writeLinear(tt.control)
+			tri.writeTimerHigh(0x08) // Sets the reload flag
+			for i, want := range tt.want {
+				tri.clockLinear()
+				if tri.LinearCounter != want {
+					t.Errorf("linear counter = %d after %d clocks, want %d", tri.LinearCounter, i+1, want)
+				}
+			}
+
+			// The sequencer only moves while the linear counter runs
+			step := tri.sequenceStep
+			for i := 0; i < 4; i++ {
+				tri.stepTimer()
+			}
+			if moved := tri.sequenceStep != step; moved != (tri.LinearCounter > 0) {
+				t.Errorf("sequencer moved = %v with linear counter %d", moved, tri.LinearCounter)
+			}
+		})
+	}
+}
+
+func TestNoisePeriod(t *testing.T) {
+	tests := []struct {
+		name string
+		mode bool
+		want int // Steps until the shift register repeats
+	}{
+		{"long", false, 32767},
+		{"short", true, 93},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := newNoiseChannel()
+			n.Mode = tt.mode
+			start := n.shift
+			for steps := 1; steps <= 32767; steps++ {
+				n.stepTimer()
+				if n.shift == start {
+					if steps != tt.want {
+						t.Errorf("sequence repeats after %d steps, want %d", steps, tt.want)
+					}
+					return
+				}
+			}
+			t.Errorf("sequence doesn't repeat, want a period of %d", tt.want)
+		})
+	}
+}
+
+func TestDMCRate(t *testing.T) {
+	tests := []struct {
+		name   string
+		timing Timing
+		index  uint8
+		want   int // CPU cycles per output bit
+	}{
+		{"NTSC slowest", NTSCTiming, 0x00, 428},
+		{"NTSC fastest", NTSCTiming, 0x0F, 54},
+		{"PAL slowest", PALTiming, 0x00, 398},
+		{"PAL fastest", PALTiming, 0x0F, 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _ := newTestAPU(tt.timing)
+			a.WriteRegister(0x4010, tt.index)
+
+			// Play a byte of ones, the level rises by 2 each bit
+			d := &a.DMC
+			d.silence = false
+			d.shiftRegister = 0xFF
+			d.timer = 0
+			d.stepTimer()
+			level := d.OutputLevel
+			cycles := 0
+			for d.OutputLevel == level {
+				d.stepTimer()
+				cycles++
+			}
+			if cycles != tt.want {
+				t.Errorf("%d cycles per bit, want %d", cycles, tt.want)
+			}
+		})
+	}
+}
+
+// testMemory records the addresses the DMC reads
+type testMemory struct {
+	reads []uint16
+}
+
+func (m *testMemory) Read(address uint16) byte {
+	m.reads = append(m.reads, address)
+	return 0xAA
+}
+
+func TestDMCSampleEnd(t *testing.T) {
+	tests := []struct {
+		name    string
+		control uint8 // $4010 value, at the fastest rate
+		reads   int   // Bytes fetched in 1000 cycles
+		irq     bool
+	}{
+		{"IRQ", 0x8F, 1, true},
+		{"no IRQ", 0x0F, 1, false},
+		{"loop", 0xCF, 3, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, cpu := newTestAPU(NTSCTiming)
+			memory := &testMemory{}
+			a.SetMemory(memory)
+			a.WriteRegister(0x4017, 0x40) // No frame IRQ
+			a.WriteRegister(0x4010, tt.control)
+			a.WriteRegister(0x4012, 0x01) // $C040
+			a.WriteRegister(0x4013, 0x00) // 1 byte
+			a.WriteRegister(0x4015, 0x10)
+
+			for i := 0; i < 1000; i++ {
+				a.Step()
+			}
+
+			if len(memory.reads) != tt.reads {
+				t.Fatalf("%d bytes fetched, want %d", len(memory.reads), tt.reads)
+			}
+			for _, address := range memory.reads {
+				if address != 0xC040 {
+					t.Errorf("fetched $%04X, want $C040", address)
+				}
+			}
+			// Every fetch halts the CPU
+			if len(cpu.stalls) != tt.reads {
+				t.Errorf("%d stalls, want %d", len(cpu.stalls), tt.reads)
+			}
+			for _, cycles := range cpu.stalls {
+				if cycles != dmcFetchCycles {
+					t.Errorf("stalled for %d cycles, want %d", cycles, dmcFetchCycles)
+				}
+			}
+
+			if a.DMC.IRQFlag != tt.irq || anyIRQ(cpu) != tt.irq {
+				t.Errorf("IRQ flag = %v, line = %v, want %v", a.DMC.IRQFlag, anyIRQ(cpu), tt.irq)
+			}
+			if status := a.ReadRegister(0x4015); (status&0x80 != 0) != tt.irq {
+				t.Errorf("$4015 = %#02x, want the DMC IRQ bit %v", status, tt.irq)
+			}
+			if playing := a.DMC.BytesRemaining > 0; playing != (tt.control&0x40 != 0) {
+				t.Errorf("still playing = %v after the sample's end", playing)
+			}
+		})
+	}
+}
+
+func TestMMC5Pulse(t *testing.T) {
+	m := NewMMC5()
+	m.WriteRegister(0x5015, 0x01)
+	m.WriteRegister(0x5000, 0x80|0x10|0x0F) // 50% duty, constant volume 15
+	m.WriteRegister(0x5002, 0x02)           // A period the APU's sweep unit would mute
+	m.WriteRegister(0x5003, 0x18)           // Length index 3: 2 clocks
+
+	high := 0
+	for i := 0; i < 48; i++ {
+		m.Step()
+		if m.Pulse1.Output() == 15 {
+			high++
+		}
+	}
+	if high != 24 {
+		t.Errorf("%d of 48 cycles high, want 24", high)
+	}
+	if status := m.ReadRegister(0x5015); status != 0x01 {
+		t.Errorf("$5015 = %#02x, want %#02x", status, 0x01)
+	}
+
+	// The length counter runs out after two 240Hz clocks
+	for i := 48; i < 2*mmc5FramePeriod; i++ {
+		m.Step()
+	}
+	if status := m.ReadRegister(0x5015); status != 0 {
+		t.Errorf("$5015 = %#02x after two frame clocks, want 0", status)
+	}
+}
+
+func TestMMC5PCM(t *testing.T) {
+	m := NewMMC5()
+	m.WriteRegister(0x5011, 0x80)
+	m.WriteRegister(0x5011, 0x00) // Ignored
+	if m.PCM != 0x80 {
+		t.Errorf("PCM = %#02x, want %#02x", m.PCM, 0x80)
+	}
+	if got, want := m.Output(), float32(0x80)*mmc5PCMScale; got != want {
+		t.Errorf("Output() = %v, want %v", got, want)
+	}
+}
+
+func TestFDSWave(t *testing.T) {
+	f := NewFDS()
+	f.WriteRegister(0x4089, 0x80) // Allow wave writes
+	for i := uint16(0); i < 64; i++ {
+		f.WriteRegister(0x4040+i, uint8(i))
+	}
+	f.WriteRegister(0x4089, 0x00)
+	f.WriteRegister(0x4080, 0x80|0x20) // Gain 32
+	f.WriteRegister(0x4087, 0x80)      // No modulation
+	f.WriteRegister(0x4082, 0x00)
+	f.WriteRegister(0x4083, 0x04) // Period $400, a step every 64 cycles
+
+	for i := 0; i < 64*10; i++ {
+		f.Step()
+	}
+	if f.sample != 10 {
+		t.Errorf("sample = %d after 640 cycles, want 10", f.sample)
+	}
+	if got, want := f.Output(), float32(10*32)*fdsScale; got != want {
+		t.Errorf("Output() = %v, want %v", got, want)
+	}
+	if gain := f.ReadRegister(0x4090); gain != 0x60 {
+		t.Errorf("$4090 = %#02x, want %#02x", gain, 0x60)
+	}
+
+	// Halting the wave resets it
+	f.WriteRegister(0x4083, 0x84)
+	f.Step()
+	if f.sample != 0 {
+		t.Errorf("sample = %d after halting, want 0", f.sample)
+	}
+}
+
+func TestFDSModulation(t *testing.T) {
+	tests := []struct {
+		name    string
+		counter uint8 // $4085
+		gain    uint8 // $4084 direct gain
+		want    uint16
+	}{
+		{"none", 0x00, 0x10, 0x100},
+		{"up", 0x08, 0x10, 0x100 + 32},
+		{"down", 0x78, 0x10, 0x100 - 32}, // -8
+		{"rounded up", 0x01, 0x01, 0x100 + 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewFDS()
+			f.WriteRegister(0x4082, 0x00)
+			f.WriteRegister(0x4083, 0x01)
+			f.WriteRegister(0x4084, 0x80|tt.gain)
+			f.WriteRegister(0x4085, tt.counter)
+			f.WriteRegister(0x4087, 0x00)
+			if pitch := f.pitch(); pitch != tt.want {
+				t.Errorf("pitch = %#x, want %#x", pitch, tt.want)
+			}
+		})
+	}
+}
+
+func TestFDSModTable(t *testing.T) {
+	f := NewFDS()
+	f.WriteRegister(0x4087, 0x80) // Halt to write the table
+	for i := 0; i < 32; i++ {
+		f.WriteRegister(0x4088, 0x01) // +1
+	}
+	f.WriteRegister(0x4085, 0x3E)
+	f.WriteRegister(0x4086, 0x00)
+	f.WriteRegister(0x4087, 0x08) // Period $800, an entry every 32 cycles
+
+	for i := 0; i < 32; i++ {
+		f.Step()
+	}
+	if f.ModCounter != 0x3F {
+		t.Fatalf("mod counter = %#02x, want %#02x", f.ModCounter, 0x3F)
+	}
+	for i := 0; i < 32; i++ {
+		f.Step()
+	}
+	if f.ModCounter != 0x40 {
+		t.Errorf("mod counter = %#02x, want it wrapped to %#02x", f.ModCounter, 0x40)
+	}
+}
+
+func TestN163(t *testing.T) {
+	n := NewN163()
+
+	// An 8-sample ramp 0-7 at address 0, written with auto-increment
+	n.WriteRegister(0xF800, 0x80)
+	for _, value := range []uint8{0x10, 0x32, 0x54, 0x76} {
+		n.WriteRegister(0x4800, value)
+	}
+	// Channel 7 moves one sample per update through the 8-sample wave
+	n.WriteRegister(0xF800, 0x80|0x78)
+	for _, value := range []uint8{0x00, 0x00, 0x00, 0x00, 0xF8 | 0x01, 0x00, 0x00, 0x0F} {
+		n.WriteRegister(0x4800, value)
+	}
+
+	for i := 0; i < 3*n163UpdatePeriod; i++ {
+		n.Step()
+	}
+	if got, want := n.Output(), float32(3*15)*n163Scale; got != want {
+		t.Errorf("Output() = %v after 3 updates, want %v", got, want)
+	}
+	n.WriteRegister(0xF800, 0x80|0x7D)
+	if phase := n.ReadRegister(0x4800); phase != 3 {
+		t.Errorf("phase = %d after 3 updates, want 3", phase)
+	}
+	if address := n.ReadRegister(0x4800); address != 0 {
+		t.Errorf("wave address = %d, want the next register", address)
+	}
+
+	// The phase wraps at the end of the wave
+	for i := 0; i < 5*n163UpdatePeriod; i++ {
+		n.Step()
+	}
+	if n.RAM[0x7D] != 0 || n.levels[7] != 0 {
+		t.Errorf("phase = %d, level = %d after 8 updates, want both 0", n.RAM[0x7D], n.levels[7])
+	}
+
+	// $E000 bit 6 stops the updates
+	n.WriteRegister(0xE000, 0x40)
+	for i := 0; i < 2*n163UpdatePeriod; i++ {
+		n.Step()
+	}
+	if n.RAM[0x7D] != 0 {
+		t.Errorf("phase = %d with the sound disabled, want 0", n.RAM[0x7D])
+	}
+}
+
+func TestSunsoft5BTone(t *testing.T) {
+	s := NewSunsoft5B()
+	write := func(register, value uint8) {
+		s.WriteRegister(0xC000, register)
+		s.WriteRegister(0xE000, value)
+	}
+	write(0, 1)    // Channel A period 1, a toggle every 16 cycles
+	write(7, 0x3E) // Only channel A's tone
+	write(8, 0x0F)
+
+	high := 0
+	for i := 0; i < 64; i++ {
+		s.Step()
+		if s.Output() != 0 {
+			high++
+		}
+	}
+	if high != 32 {
+		t.Errorf("%d of 64 cycles high, want 32", high)
+	}
+	s.tones[0] = true
+	if got, want := s.Output(), float32(sunsoft5BScale); got != want {
+		t.Errorf("Output() = %v at full volume, want %v", got, want)
+	}
+}
+
+func TestSunsoft5BEnvelope(t *testing.T) {
+	tests := []struct {
+		name  string
+		shape uint8
+		ticks int
+		want  uint8
+	}{
+		{"decay", 0x00, 10, 21},
+		{"decay ends at 0", 0x00, 40, 0},
+		{"attack and hold", 0x0D, 40, 31},
+		{"decay, hold inverted", 0x0B, 40, 31},
+		{"triangle turns around", 0x0E, 33, 30},
+		{"sawtooth restarts", 0x0C, 33, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSunsoft5B()
+			s.WriteRegister(0xC000, 11)
+			s.WriteRegister(0xE000, 1) // A step every 16 cycles
+			s.WriteRegister(0xC000, 13)
+			s.WriteRegister(0xE000, tt.shape)
+			for i := 0; i < tt.ticks*sunsoft5BPrescaler; i++ {
+				s.Step()
+			}
+			if level := s.envelopeLevel(); level != tt.want {
+				t.Errorf("level = %d after %d steps, want %d", level, tt.ticks, tt.want)
+			}
+		})
+	}
+}
+
+// checkWAVHeader checks the chunks of a mono 16-bit PCM WAV file and returns
+// its samples
+func checkWAVHeader(t *testing.T, data []byte, sampleRate int) []int16 {
+	t.Helper()
+	if len(data) < wavHeaderSize {
+		t.Fatalf("file is %d bytes, shorter than the header", len(data))
+	}
+	le := binary.LittleEndian
+	dataSize := len(data) - wavHeaderSize
+	checks := []struct {
+		name      string
+		got, want uint32
+	}{
+		{"RIFF size", le.Uint32(data[4:]), uint32(36 + dataSize)},
+		{"fmt size", le.Uint32(data[16:]), 16},
+		{"format", uint32(le.Uint16(data[20:])), 1},
+		{"channels", uint32(le.Uint16(data[22:])), 1},
+		{"sample rate", le.Uint32(data[24:]), uint32(sampleRate)},
+		{"byte rate", le.Uint32(data[28:]), uint32(2 * sampleRate)},
+		{"block align", uint32(le.Uint16(data[32:])), 2},
+		{"bits per sample", uint32(le.Uint16(data[34:])), 16},
+		{"data size", le.Uint32(data[40:]), uint32(dataSize)},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s = %d, want %d", c.name, c.got, c.want)
+		}
+	}
+	for offset, id := range map[int]string{0: "RIFF", 8: "WAVE", 12: "fmt ", 36: "data"} {
+		if got := string(data[offset : offset+4]); got != id {
+			t.Errorf("chunk id at %d = %q, want %q", offset, got, id)
+		}
+	}
+
+	samples := make([]int16, dataSize/2)
+	for i := range samples {
+		samples[i] = int16(le.Uint16(data[wavHeaderSize+2*i:]))
+	}
+	return samples
+}
+
+func TestWAVWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wav")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWAVWriter(file, 22050)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteSamples([]float32{0, 1, -1, 0.5}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteSamples([]float32{2, -2}); err != nil { // Clipped
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := checkWAVHeader(t, data, 22050)
+	want := []int16{0, 32767, -32767, 16383, 32767, -32767}
+	if !slices.Equal(samples, want) {
+		t.Errorf("samples = %v, want %v", samples, want)
+	}
+}
+
+func TestRecording(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "music.wav")
+
+	a, _ := newTestAPU(NTSCTiming)
+	if err := a.StartRecording(path, RecordOptions{SampleRate: 8000, Stems: true}); err != nil {
+		t.Fatal(err)
+	}
+	a.WriteRegister(0x4015, 0x01)
+	a.WriteRegister(0x4000, 0x80|0x10|0x0F)
+	a.WriteRegister(0x4002, 0xFD) // About 440Hz
+	a.WriteRegister(0x4003, 0x08)
+	cycles := int(NTSCTiming.CPUClock / 10)
+	for i := 0; i < cycles; i++ {
+		a.Step()
+	}
+	if !a.Recording() {
+		t.Fatal("Recording() = false while recording")
+	}
+	if err := a.StopRecording(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A tenth of a second at 8000Hz, give or take the resampler's latency
+	for _, name := range append([]string{"music"}, prefixAll("music-", StemNames[:])...) {
+		data, err := os.ReadFile(filepath.Join(dir, name+".wav"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		samples := checkWAVHeader(t, data, 8000)
+		if len(samples) < 790 || len(samples) > 800 {
+			t.Errorf("%s: %d samples, want about 800", name, len(samples))
+		}
+
+		// Idle channels settle once the filters remove the step of the
+		// triangle, whose level starts at 15
+		second := samples[len(samples)/2:]
+		steady := slices.IndexFunc(second, func(s int16) bool { return s != second[0] }) < 0
+		if wantSteady := name != "music" && name != "music-pulse1"; steady != wantSteady {
+			t.Errorf("%s: steady = %v, want %v", name, steady, wantSteady)
+		}
+	}
+}
+
+// prefixAll returns the names with a prefix added
+func prefixAll(prefix string, names []string) []string {
+	prefixed := make([]string, len(names))
+	for i, name := range names {
+		prefixed[i] = prefix + name
+	}
+	return prefixed
+}
+
+func TestMixerTables(t *testing.T) {
+	tests := []struct {
+		name string
+		got  float32
+		want float64
+	}{
+		{"pulse silent", pulseTable[0], 0},
+		{"pulse full", pulseTable[30], 0.2575},
+		{"tnd silent", tndTable[0], 0},
+		{"tnd full", tndTable[202], 0.7425},
+	}
+	for _, tt := range tests {
+		if math.Abs(float64(tt.got)-tt.want) > 0.0005 {
+			t.Errorf("%s = %.4f, want %.4f", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestBlipBufferStep(t *testing.T) {
+	b := newBlipBuffer(NTSCTiming.CPUClock, 44100)
+	cycles := int(NTSCTiming.CPUClock / 10)
+	for i := 0; i < cycles; i++ {
+		b.clock(0.5)
+	}
+	samples := make([]float32, b.available())
+	b.read(samples)
+	if len(samples) < 4400 || len(samples) > 4410 {
+		t.Fatalf("%d samples for a tenth of a second, want about 4410", len(samples))
+	}
+
+	// The step comes through, then the high-pass filters take it back to 0
+	peak := slices.Max(samples)
+	if peak < 0.3 || peak > 0.5 {
+		t.Errorf("peak = %v, want most of the 0.5 step", peak)
+	}
+	if last := samples[len(samples)-1]; math.Abs(float64(last)) > 0.001 {
+		t.Errorf("last sample = %v, want it settled to 0", last)
+	}
+}
+
+func TestBlipBufferOverflow(t *testing.T) {
+	const rate = 1000
+	b := newBlipBuffer(NTSCTiming.CPUClock, rate)
+
+	// A rising level tells the samples apart
+	level := float32(0)
+	for b.available() < rate*maxBufferedSeconds {
+		b.clock(level)
+		level = float32(b.available())
+	}
+	newest := b.samples[len(b.samples)-1]
+
+	// The next sample drops the oldest half
+	for b.available() == rate*maxBufferedSeconds {
+		b.clock(level)
+	}
+	if got, want := b.available(), rate*maxBufferedSeconds/2+1; got != want {
+		t.Fatalf("%d samples after overflowing, want %d", got, want)
+	}
+	if kept := b.samples[len(b.samples)-2]; kept != newest {
+		t.Errorf("sample before the new one = %v, want the newest one kept, %v", kept, newest)
+	}
+}
@@ -0,0 +1,147 @@
+// Package apu implements the NES Audio Processing Unit emulation
+package apu
+
+// Channel identifies one of the five sound channels
+type Channel int
+
+// Sound channels, in StemNames order
+const (
+	ChannelPulse1 Channel = iota
+	ChannelPulse2
+	ChannelTriangle
+	ChannelNoise
+	ChannelDMC
+)
+
+// ChannelCount is the number of sound channels
+const ChannelCount = 5
+
+const (
+	// ScopeSize is the number of samples kept for each channel's oscilloscope trace
+	ScopeSize = 512
+
+	// scopeDecimation is how many CPU cycles pass between two scope samples,
+	// about 28 kHz so the trace covers a frame
+	scopeDecimation = 64
+)
+
+// String returns the name of the channel
+func (c Channel) String() string {
+	if c < 0 || c >= ChannelCount {
+		return "unknown"
+	}
+	return StemNames[c]
+}
+
+// ChannelStatus is a snapshot of a channel's state for debugging tools
+type ChannelStatus struct {
+	Channel       Channel
+	Enabled       bool
+	Period        uint16 // Timer reload value
+	Volume        uint8  // Current envelope volume, or the DMC output level
+	Duty          uint8  // Duty cycle index, pulse channels only
+	LengthCounter uint8  // Bytes left for the DMC, capped at 255
+	Level         uint8  // Current output level
+	Muted         bool   // Silent in the mix because of mute or solo
+}
+
+// SetChannelMuted mutes or unmutes a channel in the mix
+func (a *APU) SetChannelMuted(channel Channel, muted bool) {
+	a.muted[channel] = muted
+	a.updateSilenced()
+}
+
+// SetChannelSolo solos or unsolos a channel, while any channel is soloed
+// only the soloed ones are heard
+func (a *APU) SetChannelSolo(channel Channel, solo bool) {
+	a.soloed[channel] = solo
+	a.updateSilenced()
+}
+
+// ChannelMuted reports whether a channel was muted with SetChannelMuted
+func (a *APU) ChannelMuted(channel Channel) bool {
+	return a.muted[channel]
+}
+
+// ChannelSoloed reports whether a channel was soloed with SetChannelSolo
+func (a *APU) ChannelSoloed(channel Channel) bool {
+	return a.soloed[channel]
+}
+
+// updateSilenced works out which channels are left out of the mix
+func (a *APU) updateSilenced() {
+	anySolo := false
+	for _, solo := range a.soloed {
+		anySolo = anySolo || solo
+	}
+	for channel := range a.silenced {
+		a.silenced[channel] = a.muted[channel] || (anySolo && !a.soloed[channel])
+	}
+}
+
+// channelLevels returns the current output level of every channel
+func (a *APU) channelLevels() [ChannelCount]uint8 {
+	return [ChannelCount]uint8{
+		a.Pulse1.Output(),
+		a.Pulse2.Output(),
+		a.Triangle.Output(),
+		a.Noise.Output(),
+		a.DMC.Output(),
+	}
+}
+
+// ChannelStatus returns the state of a channel
+func (a *APU) ChannelStatus(channel Channel) ChannelStatus {
+	status := ChannelStatus{
+		Channel: channel,
+		Level:   a.channelLevels()[channel],
+		Muted:   a.silenced[channel],
+	}
+
+	switch channel {
+	case ChannelPulse1, ChannelPulse2:
+		p := &a.Pulse1
+		if channel == ChannelPulse2 {
+			p = &a.Pulse2
+		}
+		status.Enabled = p.Enabled
+		status.Period = p.Period
+		status.Volume = p.Envelope.output()
+		status.Duty = p.DutyCycle
+		status.LengthCounter = p.LengthCounter
+	case ChannelTriangle:
+		status.Enabled = a.Triangle.Enabled
+		status.Period = a.Triangle.Period
+		status.Volume = 15
+		status.LengthCounter = a.Triangle.LengthCounter
+	case ChannelNoise:
+		status.Enabled = a.Noise.Enabled
+		status.Period = a.Noise.Period
+		status.Volume = a.Noise.Envelope.output()
+		status.LengthCounter = a.Noise.LengthCounter
+	case ChannelDMC:
+		status.Enabled = a.DMC.Enabled
+		status.Period = a.DMC.Period
+		status.Volume = a.DMC.OutputLevel
+		status.LengthCounter = uint8(min(a.DMC.BytesRemaining, 0xFF))
+	}
+	return status
+}
+
+// stepScope records the channel levels for the oscilloscope
+func (a *APU) stepScope() {
+	if a.cycle%scopeDecimation != 0 {
+		return
+	}
+	levels := a.channelLevels()
+	for channel, level := range levels {
+		a.scope[channel][a.scopePos] = level
+	}
+	a.scopePos = (a.scopePos + 1) % ScopeSize
+}
+
+// ScopeTrace copies the latest ScopeSize levels of a channel into dst, oldest first
+func (a *APU) ScopeTrace(channel Channel, dst *[ScopeSize]uint8) {
+	n := copy(dst[:], a.scope[channel][a.scopePos:])
+	copy(dst[n:], a.scope[channel][:a.scopePos])
+}
@@ -0,0 +1,159 @@
+// Package apu implements the NES Audio Processing Unit emulation
+package apu
+
+// DMC output periods in CPU cycles, indexed by the low 4 bits of $4010
+var (
+	dmcRatesNTSC = [16]uint16{428, 380, 340, 320, 286, 254, 226, 214, 190, 160, 142, 128, 106, 84, 72, 54}
+	dmcRatesPAL  = [16]uint16{398, 354, 316, 298, 276, 236, 210, 198, 176, 148, 132, 118, 98, 78, 66, 50}
+)
+
+// dmcFetchCycles is how long the CPU is halted while the DMC fetches a sample byte
+// It ranges from 1 to 4 depending on what the CPU is doing, 4 is the common case
+const dmcFetchCycles = 4
+
+// DMCChannel represents the Delta Modulation Channel
+type DMCChannel struct {
+	Enabled bool // Bytes remain to be played, bit 4 of $4015
+
+	IRQEnabled bool
+	IRQFlag    bool // Set when a non-looping sample ends
+	Loop       bool
+
+	Period uint16 // Output period in CPU cycles
+	timer  uint16
+
+	// Output unit
+	OutputLevel   uint8 // 7-bit DAC level, set directly by $4011
+	shiftRegister uint8
+	bitsRemaining uint8
+	silence       bool
+
+	// Memory reader
+	SampleAddress  uint16 // Start address, $C000 + 64 * $4012
+	SampleLength   uint16 // Length in bytes, 16 * $4013 + 1
+	currentAddress uint16
+	BytesRemaining uint16
+	sampleBuffer   uint8
+	bufferEmpty    bool
+}
+
+// newDMCChannel creates a DMC channel at its power-up state
+func newDMCChannel() DMCChannel {
+	return DMCChannel{
+		Period:        dmcRatesNTSC[0],
+		bitsRemaining: 8,
+		silence:       true,
+		bufferEmpty:   true,
+	}
+}
+
+// writeControl handles $4010: IRQ enable, loop and rate index into the region's table
+// Clearing the IRQ enable bit acknowledges a pending IRQ
+func (d *DMCChannel) writeControl(value uint8, rates *[16]uint16) {
+	d.IRQEnabled = value&0x80 != 0
+	d.Loop = value&0x40 != 0
+	d.Period = rates[value&0x0F]
+	if !d.IRQEnabled {
+		d.IRQFlag = false
+	}
+}
+
+// writeLevel handles $4011
+func (d *DMCChannel) writeLevel(value uint8) {
+	d.OutputLevel = value & 0x7F
+}
+
+// writeAddress handles $4012
+func (d *DMCChannel) writeAddress(value uint8) {
+	d.SampleAddress = 0xC000 | uint16(value)<<6
+}
+
+// writeLength handles $4013
+func (d *DMCChannel) writeLength(value uint8) {
+	d.SampleLength = uint16(value)<<4 | 1
+}
+
+// setEnabled handles the channel's bit in $4015
+// Enabling restarts the sample only if the previous one has finished
+func (d *DMCChannel) setEnabled(enabled bool) {
+	d.IRQFlag = false
+	if !enabled {
+		d.BytesRemaining = 0
+	} else if d.BytesRemaining == 0 {
+		d.restart()
+	}
+	d.Enabled = d.BytesRemaining > 0
+}
+
+// restart starts playing the sample from the beginning
+func (d *DMCChannel) restart() {
+	d.currentAddress = d.SampleAddress
+	d.BytesRemaining = d.SampleLength
+}
+
+// stepReader fetches the next sample byte when the buffer is empty
+// read is the CPU bus, stall halts the CPU for the duration of the fetch
+func (d *DMCChannel) stepReader(read func(address uint16) byte, stall func(cycles uint16)) {
+	if !d.bufferEmpty || d.BytesRemaining == 0 {
+		return
+	}
+
+	stall(dmcFetchCycles)
+	d.sampleBuffer = read(d.currentAddress)
+	d.bufferEmpty = false
+
+	// The address wraps around to $8000 instead of $0000
+	if d.currentAddress == 0xFFFF {
+		d.currentAddress = 0x8000
+	} else {
+		d.currentAddress++
+	}
+
+	d.BytesRemaining--
+	if d.BytesRemaining == 0 {
+		if d.Loop {
+			d.restart()
+		} else if d.IRQEnabled {
+			d.IRQFlag = true
+		}
+	}
+	d.Enabled = d.BytesRemaining > 0
+}
+
+// stepTimer is called every CPU cycle, the rate table is in CPU cycles
+func (d *DMCChannel) stepTimer() {
+	if d.timer > 0 {
+		d.timer--
+		return
+	}
+	d.timer = d.Period - 1
+
+	// Each bit moves the level up or down by 2, unless it would leave 0-127
+	if !d.silence {
+		if d.shiftRegister&1 != 0 {
+			if d.OutputLevel <= 125 {
+				d.OutputLevel += 2
+			}
+		} else if d.OutputLevel >= 2 {
+			d.OutputLevel -= 2
+		}
+	}
+	d.shiftRegister >>= 1
+
+	d.bitsRemaining--
+	if d.bitsRemaining == 0 {
+		d.bitsRemaining = 8
+		if d.bufferEmpty {
+			d.silence = true
+		} else {
+			d.silence = false
+			d.shiftRegister = d.sampleBuffer
+			d.bufferEmpty = true
+		}
+	}
+}
+
+// Output returns the channel's current level, 0-127
+func (d *DMCChannel) Output() uint8 {
+	return d.OutputLevel
+}
@@ -0,0 +1,51 @@
+// Package apu implements the NES Audio Processing Unit emulation
+package apu
+
+// Envelope is the volume generator shared by the pulse and noise channels
+// It either outputs a constant volume or a sawtooth that decays from 15 to 0
+type Envelope struct {
+	Start    bool  // Set by writes to the channel's fourth register
+	Loop     bool  // Restart at 15 after reaching 0, same bit as the length counter halt
+	Constant bool  // Output Volume instead of the decay level
+	Volume   uint8 // Constant volume, or the divider period of the decay
+	Decay    uint8 // Current decay level
+
+	divider uint8
+}
+
+// write loads the envelope settings from bits 0-5 of a control register
+func (e *Envelope) write(value uint8) {
+	e.Loop = value&0x20 != 0
+	e.Constant = value&0x10 != 0
+	e.Volume = value & 0x0F
+}
+
+// clock is called by the frame counter every quarter frame
+func (e *Envelope) clock() {
+	if e.Start {
+		e.Start = false
+		e.Decay = 15
+		e.divider = e.Volume
+		return
+	}
+
+	if e.divider > 0 {
+		e.divider--
+		return
+	}
+	e.divider = e.Volume
+
+	if e.Decay > 0 {
+		e.Decay--
+	} else if e.Loop {
+		e.Decay = 15
+	}
+}
+
+// output returns the current volume, 0-15
+func (e *Envelope) output() uint8 {
+	if e.Constant {
+		return e.Volume
+	}
+	return e.Decay
+}
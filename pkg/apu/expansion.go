@@ -0,0 +1,36 @@
+// Package apu implements the NES Audio Processing Unit emulation
+package apu
+
+import "github.com/example/my-golang-project/pkg/savestate"
+
+// ExpansionMix combines several expansion sound chips into one, for NSF
+// files that use more than one
+type ExpansionMix []interface {
+	Step()
+	Output() float32
+}
+
+// Step advances every chip by one CPU cycle
+func (m ExpansionMix) Step() {
+	for _, chip := range m {
+		chip.Step()
+	}
+}
+
+// Output returns the sum of the chips' outputs
+func (m ExpansionMix) Output() float32 {
+	var output float32
+	for _, chip := range m {
+		output += chip.Output()
+	}
+	return output
+}
+
+// Serialize saves or loads the chips that implement Serialize, in order
+func (m ExpansionMix) Serialize(s *savestate.Serializer) {
+	for _, chip := range m {
+		if serializer, ok := chip.(interface{ Serialize(s *savestate.Serializer) }); ok {
+			serializer.Serialize(s)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+// Package apu implements the NES Audio Processing Unit emulation
+package apu
+
+// fdsScale converts the FDS's output, a wave sample times the volume gain,
+// to the level of the APU mix: at full volume it is about 2.4 times as loud
+// as an APU pulse
+const fdsScale = 0.000177
+
+// fdsMasterVolumes are the output levels of $4089's master volume setting,
+// 2/2, 2/3, 2/4 and 2/5, in 30ths
+var fdsMasterVolumes = [4]int{30, 20, 15, 12}
+
+// fdsModSteps is how each modulation table entry changes the mod counter,
+// entry 4 resets it instead
+var fdsModSteps = [8]int8{0, 1, 2, 4, 0, -4, -2, -1}
+
+// FDS is the sound of the Famicom Disk System: a 64-step wavetable channel
+// with a volume envelope, frequency modulated by a second table
+type FDS struct {
+	Wave       [64]uint8 // 6-bit samples at $4040-$407F
+	WavePeriod uint16    // 12-bit frequency, $4082/$4083
+	waveAcc    uint32    // The position advances when it passes 16 bits
+	wavePos    uint8
+	waveHalt   bool  // $4083 bit 7 stops and resets the wave
+	waveWrite  bool  // $4089 bit 7 allows wave writes and holds the output
+	sample     uint8 // Wave sample being output
+	master     uint8 // $4089 master volume, index into fdsMasterVolumes
+
+	Volume       FDSEnvelope
+	ModEnvelope  FDSEnvelope // Its gain is the modulation depth
+	envelopeHalt bool        // $4083 bit 6 stops both envelopes
+	envelopeRate uint8       // $408A, multiplies the envelope periods
+
+	ModTable   [64]uint8 // 3-bit entries, written two at a time to $4088
+	ModPeriod  uint16    // 12-bit frequency, $4086/$4087
+	ModCounter uint8     // 7-bit signed bias, $4085
+	modAcc     uint32
+	modPos     uint8
+	modHalt    bool // $4087 bit 7 stops the modulation and allows table writes
+}
+
+// FDSEnvelope is one of the FDS's two envelopes, which move a gain up or
+// down one step at a time, or set it directly
+type FDSEnvelope struct {
+	Gain     uint8 // 0-63, the output uses at most 32
+	Speed    uint8
+	Increase bool
+	Disabled bool // The gain was written directly
+	timer    uint32
+}
+
+// NewFDS creates an FDS sound chip with the envelope rate the BIOS sets
+func NewFDS() *FDS {
+	return &FDS{envelopeRate: 0xE8}
+}
+
+// WriteRegister handles writes to $4040-$408A
+func (f *FDS) WriteRegister(address uint16, value uint8) {
+	switch {
+	case address >= 0x4040 && address < 0x4080:
+		if f.waveWrite {
+			f.Wave[address-0x4040] = value & 0x3F
+		}
+	case address == 0x4080:
+		f.Volume.write(value)
+	case address == 0x4082:
+		f.WavePeriod = f.WavePeriod&0x0F00 | uint16(value)
+	case address == 0x4083:
+		f.WavePeriod = f.WavePeriod&0x00FF | uint16(value&0x0F)<<8
+		f.waveHalt = value&0x80 != 0
+		f.envelopeHalt = value&0x40 != 0
+		if f.waveHalt {
+			f.waveAcc = 0
+			f.wavePos = 0
+		}
+	case address == 0x4084:
+		f.ModEnvelope.write(value)
+	case address == 0x4085:
+		f.ModCounter = value & 0x7F
+	case address == 0x4086:
+		f.ModPeriod = f.ModPeriod&0x0F00 | uint16(value)
+	case address == 0x4087:
+		f.ModPeriod = f.ModPeriod&0x00FF | uint16(value&0x0F)<<8
+		f.modHalt = value&0x80 != 0
+		if f.modHalt {
+			f.modAcc = 0
+		}
+	case address == 0x4088:
+		if f.modHalt {
+			f.ModTable[f.modPos] = value & 0x07
+			f.ModTable[(f.modPos+1)&0x3F] = value & 0x07
+			f.modPos = (f.modPos + 2) & 0x3F
+		}
+	case address == 0x4089:
+		f.waveWrite = value&0x80 != 0
+		f.master = value & 0x03
+	case address == 0x408A:
+		f.envelopeRate = value
+	}
+}
+
+// ReadRegister reads the wave table at $4040-$407F, and the volume and
+// modulation gains at $4090 and $4092
+func (f *FDS) ReadRegister(address uint16) uint8 {
+	switch {
+	case address >= 0x4040 && address < 0x4080:
+		return f.Wave[address-0x4040]
+	case address == 0x4090:
+		return f.Volume.Gain | 0x40
+	case address == 0x4092:
+		return f.ModEnvelope.Gain | 0x40
+	}
+	return 0
+}
+
+// Step advances the chip by one CPU cycle
+func (f *FDS) Step() {
+	if !f.envelopeHalt && !f.waveHalt && f.envelopeRate != 0 {
+		f.Volume.step(f.envelopeRate)
+		f.ModEnvelope.step(f.envelopeRate)
+	}
+
+	if !f.modHalt {
+		f.modAcc += uint32(f.ModPeriod)
+		if f.modAcc >= 0x10000 {
+			f.modAcc -= 0x10000
+			f.clockMod()
+		}
+	}
+
+	if !f.waveHalt {
+		f.waveAcc += uint32(f.pitch())
+		if f.waveAcc >= 0x10000 {
+			f.waveAcc &= 0xFFFF
+			f.wavePos = (f.wavePos + 1) & 0x3F
+		}
+	}
+	if !f.waveWrite {
+		f.sample = f.Wave[f.wavePos]
+	}
+}
+
+// clockMod applies the next modulation table entry to the mod counter,
+// which wraps around within 7 bits
+func (f *FDS) clockMod() {
+	entry := f.ModTable[f.modPos]
+	f.modPos = (f.modPos + 1) & 0x3F
+	if entry == 4 {
+		f.ModCounter = 0
+		return
+	}
+	f.ModCounter = uint8(int8(f.ModCounter)+fdsModSteps[entry]) & 0x7F
+}
+
+// pitch returns the wave frequency bent by the modulation unit, with the
+// hardware's rounding
+func (f *FDS) pitch() uint16 {
+	if f.modHalt {
+		return f.WavePeriod
+	}
+
+	// The counter is a 7-bit signed value
+	counter := int(f.ModCounter)
+	if counter >= 64 {
+		counter -= 128
+	}
+
+	temp := counter * int(f.ModEnvelope.Gain)
+	remainder := temp & 0x0F
+	temp >>= 4
+	if remainder > 0 && temp&0x80 == 0 {
+		if counter < 0 {
+			temp--
+		} else {
+			temp += 2
+		}
+	}
+	if temp >= 192 {
+		temp -= 256
+	} else if temp < -64 {
+		temp += 256
+	}
+
+	temp *= int(f.WavePeriod)
+	remainder = temp & 0x3F
+	temp >>= 6
+	if remainder >= 32 {
+		temp++
+	}
+
+	pitch := int(f.WavePeriod) + temp
+	if pitch < 0 {
+		return 0
+	}
+	return uint16(pitch)
+}
+
+// Output returns the chip's output at the level of the APU mix
+func (f *FDS) Output() float32 {
+	gain := int(f.Volume.Gain)
+	if gain > 32 {
+		gain = 32
+	}
+	level := int(f.sample) * gain * fdsMasterVolumes[f.master] / 30
+	return float32(level) * fdsScale
+}
+
+// write handles $4080/$4084: mode, direction and speed or gain
+func (e *FDSEnvelope) write(value uint8) {
+	e.Disabled = value&0x80 != 0
+	e.Increase = value&0x40 != 0
+	e.Speed = value & 0x3F
+	if e.Disabled {
+		e.Gain = e.Speed
+	}
+	e.timer = 0
+}
+
+// step is called every CPU cycle, moving the gain one step every
+// 8 * rate * (Speed + 1) cycles
+func (e *FDSEnvelope) step(rate uint8) {
+	if e.Disabled {
+		return
+	}
+	e.timer++
+	if e.timer < 8*uint32(rate)*(uint32(e.Speed)+1) {
+		return
+	}
+	e.timer = 0
+	if e.Increase && e.Gain < 32 {
+		e.Gain++
+	} else if !e.Increase && e.Gain > 0 {
+		e.Gain--
+	}
+}
@@ -0,0 +1,146 @@
+// Package apu implements the NES Audio Processing Unit emulation
+package apu
+
+import "github.com/example/my-golang-project/pkg/cpu"
+
+// Frame counter modes, bit 7 of $4017
+const (
+	FrameCounterFourStep uint8 = 0
+	FrameCounterFiveStep uint8 = 1
+)
+
+// What a frame counter step clocks
+const (
+	frameQuarter uint8 = 1 << iota // Envelopes and the triangle's linear counter
+	frameHalf                      // Length counters and sweeps
+	frameIRQ                       // Raises the frame interrupt in 4-step mode
+)
+
+// frameStep is one event of the frame sequencer
+type frameStep struct {
+	cycle  uint32 // CPU cycles after the sequence starts
+	events uint8
+}
+
+// frameSequences holds the steps of each mode, the last one restarts the sequence
+// The IRQ is asserted on three consecutive CPU cycles at the end of the 4-step sequence
+var (
+	frameSequencesNTSC = [2][]frameStep{
+		{
+			{7457, frameQuarter},
+			{14913, frameQuarter | frameHalf},
+			{22371, frameQuarter},
+			{29828, frameIRQ},
+			{29829, frameQuarter | frameHalf | frameIRQ},
+			{29830, frameIRQ},
+		},
+		{
+			{7457, frameQuarter},
+			{14913, frameQuarter | frameHalf},
+			{22371, frameQuarter},
+			{29829, 0},
+			{37281, frameQuarter | frameHalf},
+			{37282, 0},
+		},
+	}
+	frameSequencesPAL = [2][]frameStep{
+		{
+			{8313, frameQuarter},
+			{16627, frameQuarter | frameHalf},
+			{24939, frameQuarter},
+			{33252, frameIRQ},
+			{33253, frameQuarter | frameHalf | frameIRQ},
+			{33254, frameIRQ},
+		},
+		{
+			{8313, frameQuarter},
+			{16627, frameQuarter | frameHalf},
+			{24939, frameQuarter},
+			{33253, 0},
+			{41565, frameQuarter | frameHalf},
+			{41566, 0},
+		},
+	}
+)
+
+// writeFrameCounter handles $4017
+// The new mode only takes effect 3 or 4 CPU cycles later, depending on
+// whether the write lands on an APU cycle, while the inhibit flag acts at once
+func (a *APU) writeFrameCounter(value uint8) {
+	a.IRQInhibit = value&0x40 != 0
+	if a.IRQInhibit {
+		a.FrameIRQ = false
+		a.updateIRQ()
+	}
+
+	a.frameWriteValue = value
+	a.frameWriteDelay = 3
+	if a.cycle%2 == 1 {
+		a.frameWriteDelay = 4
+	}
+}
+
+// stepFrameCounter advances the frame sequencer by one CPU cycle
+func (a *APU) stepFrameCounter() {
+	if a.frameWriteDelay > 0 {
+		a.frameWriteDelay--
+		if a.frameWriteDelay == 0 {
+			a.applyFrameCounter(a.frameWriteValue)
+		}
+	}
+
+	a.frameCycle++
+	sequence := a.frameSequence()
+	step := sequence[a.FrameCounter]
+	if a.frameCycle != step.cycle {
+		return
+	}
+
+	if step.events&frameQuarter != 0 {
+		a.quarterFrame()
+	}
+	if step.events&frameHalf != 0 {
+		a.halfFrame()
+	}
+	if step.events&frameIRQ != 0 && !a.IRQInhibit {
+		a.FrameIRQ = true
+	}
+
+	a.FrameCounter++
+	if int(a.FrameCounter) == len(sequence) {
+		a.FrameCounter = 0
+		a.frameCycle = 0
+	}
+}
+
+// applyFrameCounter restarts the sequencer after a delayed $4017 write
+// Selecting the 5-step mode clocks all units immediately
+func (a *APU) applyFrameCounter(value uint8) {
+	a.FrameCounterMode = FrameCounterFourStep
+	if value&0x80 != 0 {
+		a.FrameCounterMode = FrameCounterFiveStep
+	}
+	a.FrameCounter = 0
+	a.frameCycle = 0
+
+	if a.FrameCounterMode == FrameCounterFiveStep {
+		a.quarterFrame()
+		a.halfFrame()
+	}
+}
+
+// frameSequence returns the steps of the current mode and region
+func (a *APU) frameSequence() []frameStep {
+	if a.timing.PAL {
+		return frameSequencesPAL[a.FrameCounterMode]
+	}
+	return frameSequencesNTSC[a.FrameCounterMode]
+}
+
+// updateIRQ drives the CPU's IRQ line from the frame and DMC interrupt flags
+func (a *APU) updateIRQ() {
+	if a.CPU != nil {
+		a.CPU.SetIRQ(cpu.IRQSourceFrameCounter, a.FrameIRQ)
+		a.CPU.SetIRQ(cpu.IRQSourceDMC, a.DMC.IRQFlag)
+	}
+}
@@ -0,0 +1,25 @@
+// Package apu implements the NES Audio Processing Unit emulation
+package apu
+
+// lengthTable maps the 5-bit index written to a channel's length register
+// to the number of half frames the channel keeps sounding
+var lengthTable = [32]uint8{
+	10, 254, 20, 2, 40, 4, 80, 6, 160, 8, 60, 10, 14, 12, 26, 14,
+	12, 16, 24, 18, 48, 20, 96, 22, 192, 24, 72, 26, 16, 28, 32, 30,
+}
+
+// loadLength returns the length counter value for a write to a channel's
+// length register, which only takes effect while the channel is enabled
+func loadLength(enabled bool, value uint8, current uint8) uint8 {
+	if !enabled {
+		return current
+	}
+	return lengthTable[value>>3]
+}
+
+// clockLength is called by the frame counter every half frame
+func clockLength(counter *uint8, halt bool) {
+	if *counter > 0 && !halt {
+		*counter--
+	}
+}
@@ -0,0 +1,36 @@
+// Package apu implements the NES Audio Processing Unit emulation
+package apu
+
+// The channels are mixed through two resistor networks whose output is not
+// linear in the channel levels, so the mix is looked up in two tables
+var (
+	// pulseTable is indexed by pulse1 + pulse2, 0-30
+	pulseTable [31]float32
+
+	// tndTable is indexed by 3*triangle + 2*noise + dmc, 0-202
+	tndTable [203]float32
+)
+
+func init() {
+	for n := 1; n < len(pulseTable); n++ {
+		pulseTable[n] = float32(95.52 / (8128.0/float64(n) + 100))
+	}
+	for n := 1; n < len(tndTable); n++ {
+		tndTable[n] = float32(163.67 / (24329.0/float64(n) + 100))
+	}
+}
+
+// mix returns the combined output of the five channels, 0 to about 1
+// Muted channels are mixed as if they were silent
+func (a *APU) mix() float32 {
+	levels := a.channelLevels()
+	for channel, silenced := range a.silenced {
+		if silenced {
+			levels[channel] = 0
+		}
+	}
+
+	pulse := levels[ChannelPulse1] + levels[ChannelPulse2]
+	tnd := 3*int(levels[ChannelTriangle]) + 2*int(levels[ChannelNoise]) + int(levels[ChannelDMC])
+	return pulseTable[pulse] + tndTable[tnd]
+}
@@ -0,0 +1,111 @@
+// Package apu implements the NES Audio Processing Unit emulation
+package apu
+
+// Levels of the MMC5's channels in the APU mix: the pulses as loud as the
+// APU's, the PCM channel as loud as the DMC at half the value
+const (
+	mmc5PulseScale = 0.00752
+	mmc5PCMScale   = 0.00335 / 2
+)
+
+// mmc5FramePeriod is the number of CPU cycles between clocks of the MMC5's
+// envelopes and length counters, which run at a fixed 240Hz
+const mmc5FramePeriod = 7457
+
+// MMC5 is the expansion sound of Nintendo's MMC5 mapper: two pulse channels
+// like the APU's without the sweep unit, and an 8-bit PCM channel
+// Only the PCM channel's write mode is emulated, NSF files don't use the
+// mode that reads samples from ROM
+type MMC5 struct {
+	Pulse1 MMC5Pulse
+	Pulse2 MMC5Pulse
+	PCM    uint8 // Level of the PCM channel, written to $5011
+
+	cycle      uint64 // CPU cycles, the pulse timers tick on every other one
+	frameTimer uint16
+}
+
+// MMC5Pulse is one of the MMC5's pulse channels
+type MMC5Pulse struct {
+	PulseChannel
+}
+
+// NewMMC5 creates an MMC5 sound chip
+func NewMMC5() *MMC5 {
+	return &MMC5{}
+}
+
+// WriteRegister handles writes to $5000-$5015
+func (m *MMC5) WriteRegister(address uint16, value uint8) {
+	switch address {
+	case 0x5000:
+		m.Pulse1.writeControl(value)
+	case 0x5002:
+		m.Pulse1.writeTimerLow(value)
+	case 0x5003:
+		m.Pulse1.writeTimerHigh(value)
+	case 0x5004:
+		m.Pulse2.writeControl(value)
+	case 0x5006:
+		m.Pulse2.writeTimerLow(value)
+	case 0x5007:
+		m.Pulse2.writeTimerHigh(value)
+	case 0x5011:
+		// Writes of 0 are ignored, 0 ends a sample in read mode
+		if value != 0 {
+			m.PCM = value
+		}
+	case 0x5015:
+		m.Pulse1.setEnabled(value&0x01 != 0)
+		m.Pulse2.setEnabled(value&0x02 != 0)
+	}
+}
+
+// ReadRegister reads $5015, whose bits tell whether each pulse channel's
+// length counter is still running
+func (m *MMC5) ReadRegister(address uint16) uint8 {
+	if address != 0x5015 {
+		return 0
+	}
+	var status uint8
+	if m.Pulse1.LengthCounter > 0 {
+		status |= 0x01
+	}
+	if m.Pulse2.LengthCounter > 0 {
+		status |= 0x02
+	}
+	return status
+}
+
+// Step advances the chip by one CPU cycle
+func (m *MMC5) Step() {
+	if m.cycle%2 == 0 {
+		m.Pulse1.stepTimer()
+		m.Pulse2.stepTimer()
+	}
+	m.cycle++
+
+	m.frameTimer++
+	if m.frameTimer == mmc5FramePeriod {
+		m.frameTimer = 0
+		for _, p := range []*MMC5Pulse{&m.Pulse1, &m.Pulse2} {
+			p.clockEnvelope()
+			clockLength(&p.LengthCounter, p.LengthHalt)
+		}
+	}
+}
+
+// Output returns the chip's output at the level of the APU mix
+func (m *MMC5) Output() float32 {
+	pulse := int(m.Pulse1.Output()) + int(m.Pulse2.Output())
+	return float32(pulse)*mmc5PulseScale + float32(m.PCM)*mmc5PCMScale
+}
+
+// Output returns the channel's current level, 0-15
+// Without a sweep unit, no period mutes the channel
+func (p *MMC5Pulse) Output() uint8 {
+	if p.LengthCounter == 0 || dutyTable[p.DutyCycle][p.dutyStep] == 0 {
+		return 0
+	}
+	return p.Envelope.output()
+}
@@ -0,0 +1,116 @@
+// Package apu implements the NES Audio Processing Unit emulation
+package apu
+
+// n163Scale converts a channel's 8-bit level to the level of the 2A03 mix,
+// so a lone channel at full volume is about as loud as an APU pulse
+const n163Scale = 0.00066
+
+// n163UpdatePeriod is the number of CPU cycles the N163 spends on each
+// channel before moving on to the next one
+const n163UpdatePeriod = 15
+
+// N163 is the expansion sound of Namco's 163 mapper: up to 8 wavetable
+// channels whose registers and 4-bit waveforms share 128 bytes of RAM
+// The chip updates one channel at a time, so each channel's level is held
+// between updates and the active channels are averaged
+type N163 struct {
+	// Sound RAM, $40-$7F hold the channel registers, 8 bytes per channel
+	// from channel 0 at $40 to channel 7 at $78
+	RAM [128]uint8
+
+	address  uint8 // Bits 0-6 address RAM, bit 7 increments it after each access
+	disabled bool  // $E000 bit 6 stops the sound
+	timer    uint8
+	channel  uint8    // Active channels updated so far in this round
+	levels   [8]uint8 // Level of each channel at its last update
+}
+
+// NewN163 creates an N163 sound chip
+func NewN163() *N163 {
+	return &N163{}
+}
+
+// WriteRegister handles writes to the data port at $4800-$4FFF, the sound
+// control at $E000-$E7FF and the address port at $F800-$FFFF
+func (n *N163) WriteRegister(address uint16, value uint8) {
+	switch {
+	case address >= 0xF800:
+		n.address = value
+	case address >= 0xE000 && address < 0xE800:
+		n.disabled = value&0x40 != 0
+	case address >= 0x4800 && address < 0x5000:
+		n.RAM[n.address&0x7F] = value
+		n.increment()
+	}
+}
+
+// ReadRegister reads RAM through the data port at $4800-$4FFF
+func (n *N163) ReadRegister(address uint16) uint8 {
+	if address < 0x4800 || address >= 0x5000 {
+		return 0
+	}
+	value := n.RAM[n.address&0x7F]
+	n.increment()
+	return value
+}
+
+// increment moves the address port on after a data port access if its
+// bit 7 is set
+func (n *N163) increment() {
+	if n.address&0x80 != 0 {
+		n.address = 0x80 | (n.address+1)&0x7F
+	}
+}
+
+// channels returns the number of active channels, set by bits 4-6 of $7F
+// Active channels are the highest numbered ones, down from channel 7
+func (n *N163) channels() uint8 {
+	return (n.RAM[0x7F]>>4)&0x07 + 1
+}
+
+// Step advances the chip by one CPU cycle
+func (n *N163) Step() {
+	if n.disabled {
+		return
+	}
+	n.timer++
+	if n.timer < n163UpdatePeriod {
+		return
+	}
+	n.timer = 0
+
+	count := n.channels()
+	if n.channel >= count {
+		n.channel = 0
+	}
+	n.updateChannel(7 - n.channel)
+	n.channel = (n.channel + 1) % count
+}
+
+// updateChannel adds a channel's frequency to its phase, which the chip keeps
+// in RAM, and reads the sample at the new position of the waveform
+func (n *N163) updateChannel(channel uint8) {
+	registers := n.RAM[0x40+8*int(channel):][:8]
+
+	frequency := uint32(registers[0]) | uint32(registers[2])<<8 | uint32(registers[4]&0x03)<<16
+	phase := uint32(registers[1]) | uint32(registers[3])<<8 | uint32(registers[5])<<16
+	length := 256 - uint32(registers[4]&0xFC)
+
+	phase = (phase + frequency) % (length << 16)
+	registers[1], registers[3], registers[5] = uint8(phase), uint8(phase>>8), uint8(phase>>16)
+
+	// Samples are packed two per byte, the low nibble first
+	position := (phase>>16 + uint32(registers[6])) & 0xFF
+	sample := n.RAM[position/2] >> (4 * (position & 1)) & 0x0F
+	n.levels[channel] = sample * (registers[7] & 0x0F)
+}
+
+// Output returns the chip's output at the level of the APU mix
+func (n *N163) Output() float32 {
+	count := n.channels()
+	level := 0
+	for channel := 8 - count; channel < 8; channel++ {
+		level += int(n.levels[channel])
+	}
+	return float32(level) / float32(count) * n163Scale
+}
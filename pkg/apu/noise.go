@@ -0,0 +1,89 @@
+// Package apu implements the NES Audio Processing Unit emulation
+package apu
+
+// Noise timer periods in CPU cycles, indexed by the low 4 bits of $400E
+var (
+	noisePeriodsNTSC = [16]uint16{4, 8, 16, 32, 64, 96, 128, 160, 202, 254, 380, 508, 762, 1016, 2034, 4068}
+	noisePeriodsPAL  = [16]uint16{4, 8, 14, 30, 60, 88, 118, 148, 188, 236, 354, 472, 708, 944, 1890, 3778}
+)
+
+// NoiseChannel represents the noise channel
+type NoiseChannel struct {
+	Enabled bool
+
+	Envelope Envelope
+
+	Mode   bool   // Short mode, taps bit 6 instead of bit 1 for a 93-step sequence
+	Period uint16 // Timer reload value in APU cycles
+	timer  uint16
+	shift  uint16 // 15-bit linear feedback shift register
+
+	LengthCounter uint8
+	LengthHalt    bool
+}
+
+// newNoiseChannel creates a noise channel, the shift register starts at 1
+func newNoiseChannel() NoiseChannel {
+	return NoiseChannel{shift: 1}
+}
+
+// writeControl handles $400C: length halt and envelope
+func (n *NoiseChannel) writeControl(value uint8) {
+	n.LengthHalt = value&0x20 != 0
+	n.Envelope.write(value)
+}
+
+// writePeriod handles $400E: mode and period index into the region's table
+func (n *NoiseChannel) writePeriod(value uint8, periods *[16]uint16) {
+	n.Mode = value&0x80 != 0
+	// The table is in CPU cycles, the timer is clocked every other one
+	n.Period = periods[value&0x0F]/2 - 1
+}
+
+// writeLength handles $400F: length counter load, restarts the envelope
+func (n *NoiseChannel) writeLength(value uint8) {
+	n.LengthCounter = loadLength(n.Enabled, value, n.LengthCounter)
+	n.Envelope.Start = true
+}
+
+// setEnabled handles the channel's bit in $4015, disabling clears the length counter
+func (n *NoiseChannel) setEnabled(enabled bool) {
+	n.Enabled = enabled
+	if !enabled {
+		n.LengthCounter = 0
+	}
+}
+
+// stepTimer is called every APU cycle, every other CPU cycle
+func (n *NoiseChannel) stepTimer() {
+	if n.timer > 0 {
+		n.timer--
+		return
+	}
+	n.timer = n.Period
+
+	tap := uint16(1)
+	if n.Mode {
+		tap = 6
+	}
+	feedback := (n.shift & 1) ^ ((n.shift >> tap) & 1)
+	n.shift = n.shift>>1 | feedback<<14
+}
+
+// clockEnvelope is called every quarter frame
+func (n *NoiseChannel) clockEnvelope() {
+	n.Envelope.clock()
+}
+
+// clockLength is called every half frame
+func (n *NoiseChannel) clockLength() {
+	clockLength(&n.LengthCounter, n.LengthHalt)
+}
+
+// Output returns the channel's current level, 0-15
+func (n *NoiseChannel) Output() uint8 {
+	if n.LengthCounter == 0 || n.shift&1 != 0 {
+		return 0
+	}
+	return n.Envelope.output()
+}
@@ -0,0 +1,145 @@
+// Package apu implements the NES Audio Processing Unit emulation
+package apu
+
+// dutyTable holds the 8-step waveform of each duty cycle
+// 12.5%, 25%, 50% and 25% negated
+var dutyTable = [4][8]uint8{
+	{0, 1, 0, 0, 0, 0, 0, 0},
+	{0, 1, 1, 0, 0, 0, 0, 0},
+	{0, 1, 1, 1, 1, 0, 0, 0},
+	{1, 0, 0, 1, 1, 1, 1, 1},
+}
+
+// PulseChannel represents one of the two pulse wave channels
+type PulseChannel struct {
+	Enabled   bool
+	DutyCycle uint8 // Index into dutyTable
+	dutyStep  uint8 // Position in the 8-step sequence
+
+	Envelope Envelope
+
+	// Sweep unit, bends the period up or down every half frame
+	SweepEnabled bool
+	SweepPeriod  uint8
+	SweepNegate  bool
+	SweepShift   uint8
+	sweepDivider uint8
+	sweepReload  bool
+
+	// onesComplement makes the sweep subtract one extra, as pulse 1 does
+	onesComplement bool
+
+	Period uint16 // 11-bit timer reload value
+	timer  uint16
+
+	LengthCounter uint8
+	LengthHalt    bool
+}
+
+// newPulseChannel creates a pulse channel, channel is 1 or 2
+func newPulseChannel(channel int) PulseChannel {
+	return PulseChannel{onesComplement: channel == 1}
+}
+
+// writeControl handles $4000/$4004: duty, length halt and envelope
+func (p *PulseChannel) writeControl(value uint8) {
+	p.DutyCycle = value >> 6
+	p.LengthHalt = value&0x20 != 0
+	p.Envelope.write(value)
+}
+
+// writeSweep handles $4001/$4005
+func (p *PulseChannel) writeSweep(value uint8) {
+	p.SweepEnabled = value&0x80 != 0
+	p.SweepPeriod = (value >> 4) & 0x07
+	p.SweepNegate = value&0x08 != 0
+	p.SweepShift = value & 0x07
+	p.sweepReload = true
+}
+
+// writeTimerLow handles $4002/$4006
+func (p *PulseChannel) writeTimerLow(value uint8) {
+	p.Period = p.Period&0x0700 | uint16(value)
+}
+
+// writeTimerHigh handles $4003/$4007: length counter load and timer high bits
+// It also restarts the envelope and the duty sequence
+func (p *PulseChannel) writeTimerHigh(value uint8) {
+	p.Period = p.Period&0x00FF | uint16(value&0x07)<<8
+	p.LengthCounter = loadLength(p.Enabled, value, p.LengthCounter)
+	p.Envelope.Start = true
+	p.dutyStep = 0
+}
+
+// setEnabled handles the channel's bit in $4015, disabling clears the length counter
+func (p *PulseChannel) setEnabled(enabled bool) {
+	p.Enabled = enabled
+	if !enabled {
+		p.LengthCounter = 0
+	}
+}
+
+// stepTimer is called every APU cycle, every other CPU cycle
+func (p *PulseChannel) stepTimer() {
+	if p.timer == 0 {
+		p.timer = p.Period
+		p.dutyStep = (p.dutyStep + 1) & 0x07
+	} else {
+		p.timer--
+	}
+}
+
+// clockEnvelope is called every quarter frame
+func (p *PulseChannel) clockEnvelope() {
+	p.Envelope.clock()
+}
+
+// clockLengthAndSweep is called every half frame
+func (p *PulseChannel) clockLengthAndSweep() {
+	clockLength(&p.LengthCounter, p.LengthHalt)
+
+	target := p.targetPeriod()
+	if p.sweepDivider == 0 && p.SweepEnabled && p.SweepShift > 0 && !p.sweepMuted(target) {
+		p.Period = target
+	}
+	if p.sweepDivider == 0 || p.sweepReload {
+		p.sweepDivider = p.SweepPeriod
+		p.sweepReload = false
+	} else {
+		p.sweepDivider--
+	}
+}
+
+// targetPeriod is the period the sweep unit would switch to
+// It is computed all the time, even with the sweep disabled, since it can mute the channel
+func (p *PulseChannel) targetPeriod() uint16 {
+	change := p.Period >> p.SweepShift
+	if !p.SweepNegate {
+		return p.Period + change
+	}
+
+	// Pulse 1 adds the ones' complement, so it subtracts one more than pulse 2
+	if p.onesComplement {
+		change++
+	}
+	if change > p.Period {
+		return 0
+	}
+	return p.Period - change
+}
+
+// sweepMuted reports whether the period is out of the range the channel can play
+func (p *PulseChannel) sweepMuted(target uint16) bool {
+	return p.Period < 8 || target > 0x7FF
+}
+
+// Output returns the channel's current level, 0-15
+func (p *PulseChannel) Output() uint8 {
+	if p.LengthCounter == 0 || p.sweepMuted(p.targetPeriod()) {
+		return 0
+	}
+	if dutyTable[p.DutyCycle][p.dutyStep] == 0 {
+		return 0
+	}
+	return p.Envelope.output()
+}
@@ -0,0 +1,172 @@
+// Package apu implements the NES Audio Processing Unit emulation
+package apu
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// StemNames are the file name suffixes of the per-channel recordings
+var StemNames = [ChannelCount]string{"pulse1", "pulse2", "triangle", "noise", "dmc"}
+
+// recordFlushSamples is how many samples a track buffers before writing them
+const recordFlushSamples = 4096
+
+// RecordOptions configures a WAV recording
+type RecordOptions struct {
+	SampleRate int  // Rate of the recording, 0 means DefaultSampleRate
+	Stems      bool // Also record every channel to its own file
+}
+
+// recordTrack resamples one signal and writes it to a WAV file
+type recordTrack struct {
+	file    *os.File
+	writer  *WAVWriter
+	buffer  *blipBuffer
+	scratch []float32
+}
+
+// newRecordTrack creates the file of a track
+func newRecordTrack(path string, clockRate float64, sampleRate int) (*recordTrack, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	writer, err := NewWAVWriter(file, sampleRate)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &recordTrack{
+		file:    file,
+		writer:  writer,
+		buffer:  newBlipBuffer(clockRate, sampleRate),
+		scratch: make([]float32, recordFlushSamples),
+	}, nil
+}
+
+// clock feeds the level of the signal for one CPU cycle
+func (t *recordTrack) clock(level float32) error {
+	t.buffer.clock(level)
+	if t.buffer.available() >= recordFlushSamples {
+		return t.flush()
+	}
+	return nil
+}
+
+// flush writes the finished samples to the file
+func (t *recordTrack) flush() error {
+	n := t.buffer.read(t.scratch)
+	return t.writer.WriteSamples(t.scratch[:n])
+}
+
+// close flushes the track and finalizes its file
+func (t *recordTrack) close() error {
+	return errors.Join(t.flush(), t.writer.Close(), t.file.Close())
+}
+
+// recorder records the mixer output and optionally each channel
+// It resamples on its own at the nominal rate, so recordings are not
+// affected by the rate adjustments of the audio playback
+type recorder struct {
+	mix   *recordTrack
+	stems []*recordTrack // In StemNames order, empty without stems
+	err   error          // First write error, recording stops on error
+}
+
+// StartRecording starts recording the APU output to a 16-bit PCM WAV file
+// With stems, every channel also goes to its own file named after path, e.g.
+// music.wav records music-pulse1.wav, music-pulse2.wav and so on
+func (a *APU) StartRecording(path string, options RecordOptions) error {
+	if a.recorder != nil {
+		return errors.New("already recording")
+	}
+
+	sampleRate := options.SampleRate
+	if sampleRate == 0 {
+		sampleRate = DefaultSampleRate
+	}
+
+	rec := &recorder{}
+	mix, err := newRecordTrack(path, a.timing.CPUClock, sampleRate)
+	if err != nil {
+		return err
+	}
+	rec.mix = mix
+
+	if options.Stems {
+		ext := filepath.Ext(path)
+		base := strings.TrimSuffix(path, ext)
+		for _, name := range StemNames {
+			track, err := newRecordTrack(fmt.Sprintf("%s-%s%s", base, name, ext), a.timing.CPUClock, sampleRate)
+			if err != nil {
+				rec.close()
+				return err
+			}
+			rec.stems = append(rec.stems, track)
+		}
+	}
+
+	a.recorder = rec
+	return nil
+}
+
+// StopRecording finishes the recording and closes its files
+// It also reports any error that happened while writing
+func (a *APU) StopRecording() error {
+	if a.recorder == nil {
+		return nil
+	}
+	rec := a.recorder
+	a.recorder = nil
+	return errors.Join(rec.err, rec.close())
+}
+
+// Recording reports whether a recording is in progress
+func (a *APU) Recording() bool {
+	return a.recorder != nil
+}
+
+// record feeds one CPU cycle of output to the recording
+// Each stem is the channel's level through the mixer with the others silent
+func (a *APU) record(mix float32) {
+	rec := a.recorder
+	if rec.err != nil {
+		return
+	}
+
+	rec.err = rec.mix.clock(mix)
+	if len(rec.stems) == 0 || rec.err != nil {
+		return
+	}
+
+	channels := a.channelLevels()
+	levels := [ChannelCount]float32{
+		pulseTable[channels[ChannelPulse1]],
+		pulseTable[channels[ChannelPulse2]],
+		tndTable[3*int(channels[ChannelTriangle])],
+		tndTable[2*int(channels[ChannelNoise])],
+		tndTable[channels[ChannelDMC]],
+	}
+	for i, track := range rec.stems {
+		if err := track.clock(levels[i]); err != nil {
+			rec.err = err
+			return
+		}
+	}
+}
+
+// close finalizes all the files of the recording
+func (r *recorder) close() error {
+	var errs []error
+	if r.mix != nil {
+		errs = append(errs, r.mix.close())
+	}
+	for _, track := range r.stems {
+		errs = append(errs, track.close())
+	}
+	return errors.Join(errs...)
+}
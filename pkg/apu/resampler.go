@@ -0,0 +1,178 @@
+// Package apu implements the NES Audio Processing Unit emulation
+package apu
+
+import "math"
+
+const (
+	// DefaultSampleRate is the output rate used until SetSampleRate is called
+	DefaultSampleRate = 44100
+
+	// blipTaps is the width of the band-limited step in output samples
+	blipTaps = 16
+
+	// blipPhases is how many sub-sample positions the step is precomputed for
+	blipPhases = 64
+
+	// blipCutoff is the low-pass cutoff as a fraction of the output rate
+	blipCutoff = 0.45
+
+	// maxBufferedSeconds caps the samples kept when nobody reads them
+	maxBufferedSeconds = 1
+)
+
+// blipKernel holds the band-limited impulse for each sub-sample phase
+// Adding it for every change of the input and integrating the result
+// synthesizes steps without the aliasing of plain decimation
+var blipKernel = buildBlipKernel()
+
+// buildBlipKernel computes a Blackman-windowed sinc for every phase, each
+// normalized so a step always settles at exactly its height
+func buildBlipKernel() [blipPhases][blipTaps]float64 {
+	var kernel [blipPhases][blipTaps]float64
+	half := float64(blipTaps) / 2
+
+	for phase := 0; phase < blipPhases; phase++ {
+		frac := float64(phase) / blipPhases
+		sum := 0.0
+		for i := 0; i < blipTaps; i++ {
+			t := float64(i) - (half - 1) - frac
+			x := 2 * blipCutoff * t
+
+			sinc := 1.0
+			if x != 0 {
+				sinc = math.Sin(math.Pi*x) / (math.Pi * x)
+			}
+
+			// Blackman window over the width of the kernel
+			w := (t + half) / (2 * half)
+			window := 0.42 - 0.5*math.Cos(2*math.Pi*w) + 0.08*math.Cos(4*math.Pi*w)
+
+			kernel[phase][i] = sinc * window
+			sum += kernel[phase][i]
+		}
+		for i := range kernel[phase] {
+			kernel[phase][i] /= sum
+		}
+	}
+	return kernel
+}
+
+// onePoleFilter is a first-order high-pass or low-pass filter
+type onePoleFilter struct {
+	highPass bool
+	alpha    float64
+	prevIn   float64
+	prevOut  float64
+}
+
+// newOnePoleFilter creates a filter with the given cutoff in Hz
+func newOnePoleFilter(highPass bool, cutoff, sampleRate float64) onePoleFilter {
+	rc := 1 / (2 * math.Pi * cutoff)
+	dt := 1 / sampleRate
+	f := onePoleFilter{highPass: highPass}
+	if highPass {
+		f.alpha = rc / (rc + dt)
+	} else {
+		f.alpha = dt / (rc + dt)
+	}
+	return f
+}
+
+// process filters one sample
+func (f *onePoleFilter) process(in float64) float64 {
+	var out float64
+	if f.highPass {
+		out = f.alpha * (f.prevOut + in - f.prevIn)
+	} else {
+		out = f.prevOut + f.alpha*(in-f.prevOut)
+	}
+	f.prevIn = in
+	f.prevOut = out
+	return out
+}
+
+// blipBuffer turns a signal sampled at the CPU clock into PCM at the output
+// rate using band-limited step synthesis, then runs it through the filters
+// of the console's audio output: high-pass at 90 and 440 Hz, low-pass at 14 kHz
+type blipBuffer struct {
+	sampleRate int
+	clockRate  float64
+	factor     float64 // Output samples per input clock
+	position   float64 // Position of the next clock in output samples, relative to deltas[0]
+	last       float64 // Input level at the previous clock
+
+	deltas     [blipTaps + 1]float64 // Pending deltas of the samples being synthesized
+	integrator float64
+
+	filters []onePoleFilter
+	samples []float32 // Finished samples waiting to be read
+}
+
+// newBlipBuffer creates a buffer converting from clockRate to sampleRate
+func newBlipBuffer(clockRate float64, sampleRate int) *blipBuffer {
+	rate := float64(sampleRate)
+	return &blipBuffer{
+		sampleRate: sampleRate,
+		clockRate:  clockRate,
+		factor:     rate / clockRate,
+		filters: []onePoleFilter{
+			newOnePoleFilter(true, 90, rate),
+			newOnePoleFilter(true, 440, rate),
+			newOnePoleFilter(false, 14000, rate),
+		},
+	}
+}
+
+// adjustRate scales the output rate by ratio without losing buffered samples,
+// so a consumer can nudge the production rate to match its own clock
+func (b *blipBuffer) adjustRate(ratio float64) {
+	b.factor = float64(b.sampleRate) * ratio / b.clockRate
+}
+
+// clock feeds the level of the input for one clock
+func (b *blipBuffer) clock(level float32) {
+	if delta := float64(level) - b.last; delta != 0 {
+		b.last = float64(level)
+		phase := int((b.position - math.Floor(b.position)) * blipPhases)
+		start := int(b.position)
+		for i, k := range blipKernel[phase] {
+			b.deltas[start+i] += delta * k
+		}
+	}
+
+	b.position += b.factor
+	if b.position >= 1 {
+		b.position--
+		b.emit()
+	}
+}
+
+// emit finishes the oldest sample and shifts the pending deltas
+func (b *blipBuffer) emit() {
+	b.integrator += b.deltas[0]
+	copy(b.deltas[:], b.deltas[1:])
+	b.deltas[blipTaps] = 0
+
+	sample := b.integrator
+	for i := range b.filters {
+		sample = b.filters[i].process(sample)
+	}
+
+	// Drop the oldest samples if nobody is reading
+	if len(b.samples) >= b.sampleRate*maxBufferedSeconds {
+		b.samples = b.samples[:copy(b.samples, b.samples[len(b.samples)/2:])]
+	}
+	b.samples = append(b.samples, float32(sample))
+}
+
+// read moves up to len(dst) finished samples into dst
+func (b *blipBuffer) read(dst []float32) int {
+	n := copy(dst, b.samples)
+	b.samples = b.samples[:copy(b.samples, b.samples[n:])]
+	return n
+}
+
+// available returns the number of finished samples
+func (b *blipBuffer) available() int {
+	return len(b.samples)
+}
@@ -0,0 +1,239 @@
+// Package apu implements the NES Audio Processing Unit emulation
+package apu
+
+import (
+	"fmt"
+
+	"github.com/example/my-golang-project/pkg/savestate"
+)
+
+// Serialize saves or loads the channels, the frame counter and the
+// expansion audio if it implements Serialize
+// Queued samples, recording and mute settings belong to the host and are
+// not included
+func (a *APU) Serialize(s *savestate.Serializer) {
+	s.Section("APU ")
+	a.Pulse1.serialize(s)
+	a.Pulse2.serialize(s)
+	a.Triangle.serialize(s)
+	a.Noise.serialize(s)
+	a.DMC.serialize(s)
+
+	s.Uint8(&a.FrameCounter)
+	s.Uint8(&a.FrameCounterMode)
+	s.Bool(&a.IRQInhibit)
+	s.Bool(&a.FrameIRQ)
+	s.Uint32(&a.frameCycle)
+	s.Uint8(&a.frameWriteValue)
+	s.Uint8(&a.frameWriteDelay)
+	s.Uint64(&a.cycle)
+	if a.FrameCounterMode > FrameCounterFiveStep {
+		s.Fail(fmt.Errorf("invalid frame counter mode %d", a.FrameCounterMode))
+	} else if int(a.FrameCounter) >= len(a.frameSequence()) {
+		s.Fail(fmt.Errorf("invalid frame counter step %d", a.FrameCounter))
+	}
+
+	s.Section("EXPA")
+	if expansion, ok := a.Expansion.(interface{ Serialize(s *savestate.Serializer) }); ok {
+		expansion.Serialize(s)
+	}
+}
+
+// serialize saves or loads the envelope generator
+func (e *Envelope) serialize(s *savestate.Serializer) {
+	s.Bool(&e.Start)
+	s.Bool(&e.Loop)
+	s.Bool(&e.Constant)
+	s.Uint8(&e.Volume)
+	s.Uint8(&e.Decay)
+	s.Uint8(&e.divider)
+	if e.Volume > 15 || e.Decay > 15 {
+		s.Fail(fmt.Errorf("invalid envelope volume %d/%d", e.Volume, e.Decay))
+	}
+}
+
+// serialize saves or loads a pulse channel
+func (p *PulseChannel) serialize(s *savestate.Serializer) {
+	s.Bool(&p.Enabled)
+	s.Uint8(&p.DutyCycle)
+	s.Uint8(&p.dutyStep)
+	p.Envelope.serialize(s)
+	s.Bool(&p.SweepEnabled)
+	s.Uint8(&p.SweepPeriod)
+	s.Bool(&p.SweepNegate)
+	s.Uint8(&p.SweepShift)
+	s.Uint8(&p.sweepDivider)
+	s.Bool(&p.sweepReload)
+	s.Uint16(&p.Period)
+	s.Uint16(&p.timer)
+	s.Uint8(&p.LengthCounter)
+	s.Bool(&p.LengthHalt)
+	if int(p.DutyCycle) >= len(dutyTable) || int(p.dutyStep) >= len(dutyTable[0]) {
+		s.Fail(fmt.Errorf("invalid pulse duty %d/%d", p.DutyCycle, p.dutyStep))
+	}
+}
+
+// serialize saves or loads the triangle channel
+func (t *TriangleChannel) serialize(s *savestate.Serializer) {
+	s.Bool(&t.Enabled)
+	s.Uint16(&t.Period)
+	s.Uint16(&t.timer)
+	s.Uint8(&t.sequenceStep)
+	s.Uint8(&t.LinearCounter)
+	s.Uint8(&t.LinearReload)
+	s.Bool(&t.linearReload)
+	s.Bool(&t.Control)
+	s.Uint8(&t.LengthCounter)
+	if int(t.sequenceStep) >= len(triangleSequence) {
+		s.Fail(fmt.Errorf("invalid triangle step %d", t.sequenceStep))
+	}
+}
+
+// serialize saves or loads the noise channel
+func (n *NoiseChannel) serialize(s *savestate.Serializer) {
+	s.Bool(&n.Enabled)
+	n.Envelope.serialize(s)
+	s.Bool(&n.Mode)
+	s.Uint16(&n.Period)
+	s.Uint16(&n.timer)
+	s.Uint16(&n.shift)
+	s.Uint8(&n.LengthCounter)
+	s.Bool(&n.LengthHalt)
+}
+
+// serialize saves or loads the DMC channel
+func (d *DMCChannel) serialize(s *savestate.Serializer) {
+	s.Bool(&d.Enabled)
+	s.Bool(&d.IRQEnabled)
+	s.Bool(&d.IRQFlag)
+	s.Bool(&d.Loop)
+	s.Uint16(&d.Period)
+	s.Uint16(&d.timer)
+	s.Uint8(&d.OutputLevel)
+	s.Uint8(&d.shiftRegister)
+	s.Uint8(&d.bitsRemaining)
+	s.Bool(&d.silence)
+	s.Uint16(&d.SampleAddress)
+	s.Uint16(&d.SampleLength)
+	s.Uint16(&d.currentAddress)
+	s.Uint16(&d.BytesRemaining)
+	s.Uint8(&d.sampleBuffer)
+	s.Bool(&d.bufferEmpty)
+	if d.OutputLevel > 127 {
+		s.Fail(fmt.Errorf("invalid DMC output level %d", d.OutputLevel))
+	}
+}
+
+// Serialize saves or loads the VRC6 channels
+func (v *VRC6) Serialize(s *savestate.Serializer) {
+	s.Section("VRC6")
+	v.Pulse1.serialize(s)
+	v.Pulse2.serialize(s)
+	s.Bool(&v.Sawtooth.Enabled)
+	s.Uint8(&v.Sawtooth.Rate)
+	s.Uint16(&v.Sawtooth.Period)
+	s.Uint16(&v.Sawtooth.timer)
+	s.Uint8(&v.Sawtooth.step)
+	s.Uint8(&v.Sawtooth.accumulator)
+	s.Bool(&v.halt)
+	s.Uint8(&v.frequency)
+}
+
+// serialize saves or loads a VRC6 pulse channel
+func (p *VRC6Pulse) serialize(s *savestate.Serializer) {
+	s.Bool(&p.Enabled)
+	s.Uint8(&p.Volume)
+	s.Uint8(&p.Duty)
+	s.Bool(&p.Mode)
+	s.Uint16(&p.Period)
+	s.Uint16(&p.timer)
+	s.Uint8(&p.step)
+}
+
+// Serialize saves or loads the MMC5 channels
+func (m *MMC5) Serialize(s *savestate.Serializer) {
+	s.Section("MMC5")
+	m.Pulse1.serialize(s)
+	m.Pulse2.serialize(s)
+	s.Uint8(&m.PCM)
+	s.Uint64(&m.cycle)
+	s.Uint16(&m.frameTimer)
+	if m.frameTimer >= mmc5FramePeriod {
+		s.Fail(fmt.Errorf("invalid MMC5 frame timer %d", m.frameTimer))
+	}
+}
+
+// Serialize saves or loads the FDS wave and modulation units
+func (f *FDS) Serialize(s *savestate.Serializer) {
+	s.Section("FDS ")
+	s.Bytes(f.Wave[:])
+	s.Uint16(&f.WavePeriod)
+	s.Uint32(&f.waveAcc)
+	s.Uint8(&f.wavePos)
+	s.Bool(&f.waveHalt)
+	s.Bool(&f.waveWrite)
+	s.Uint8(&f.sample)
+	s.Uint8(&f.master)
+	f.Volume.serialize(s)
+	f.ModEnvelope.serialize(s)
+	s.Bool(&f.envelopeHalt)
+	s.Uint8(&f.envelopeRate)
+	s.Bytes(f.ModTable[:])
+	s.Uint16(&f.ModPeriod)
+	s.Uint8(&f.ModCounter)
+	s.Uint32(&f.modAcc)
+	s.Uint8(&f.modPos)
+	s.Bool(&f.modHalt)
+	if f.wavePos > 63 || f.modPos > 63 || f.master > 3 || f.sample > 63 {
+		s.Fail(fmt.Errorf("invalid FDS state"))
+	}
+	for _, entry := range f.ModTable {
+		if entry > 7 {
+			s.Fail(fmt.Errorf("invalid FDS modulation entry %d", entry))
+		}
+	}
+}
+
+// serialize saves or loads an FDS envelope
+func (e *FDSEnvelope) serialize(s *savestate.Serializer) {
+	s.Uint8(&e.Gain)
+	s.Uint8(&e.Speed)
+	s.Bool(&e.Increase)
+	s.Bool(&e.Disabled)
+	s.Uint32(&e.timer)
+}
+
+// Serialize saves or loads the N163's RAM, which holds its channel registers
+func (n *N163) Serialize(s *savestate.Serializer) {
+	s.Section("N163")
+	s.Bytes(n.RAM[:])
+	s.Uint8(&n.address)
+	s.Bool(&n.disabled)
+	s.Uint8(&n.timer)
+	s.Uint8(&n.channel)
+	s.Bytes(n.levels[:])
+	if n.timer >= n163UpdatePeriod || n.channel > 7 {
+		s.Fail(fmt.Errorf("invalid N163 state"))
+	}
+}
+
+// Serialize saves or loads the Sunsoft 5B's registers and counters
+func (s5b *Sunsoft5B) Serialize(s *savestate.Serializer) {
+	s.Section("S5B ")
+	s.Bytes(s5b.Registers[:])
+	s.Uint8(&s5b.selected)
+	s.Uint8(&s5b.prescaler)
+	for i := range s5b.tones {
+		s.Uint16(&s5b.toneTimers[i])
+		s.Bool(&s5b.tones[i])
+	}
+	s.Uint8(&s5b.noiseTimer)
+	s.Uint32(&s5b.noise)
+	s.Uint16(&s5b.envelopeTimer)
+	s.Uint8(&s5b.envelopeStep)
+	s.Bool(&s5b.envelopeAttack)
+	s.Bool(&s5b.envelopeHold)
+	if s5b.envelopeStep > 31 || s5b.prescaler >= sunsoft5BPrescaler {
+		s.Fail(fmt.Errorf("invalid Sunsoft 5B state"))
+	}
+}
@@ -0,0 +1,170 @@
+// Package apu implements the NES Audio Processing Unit emulation
+package apu
+
+import "math"
+
+// sunsoft5BScale converts a channel's level to the level of the 2A03 mix,
+// so a channel at full volume is about as loud as an APU pulse
+const sunsoft5BScale = 0.15
+
+// sunsoft5BPrescaler is the number of CPU cycles per clock of the chip's
+// tone, noise and envelope counters
+const sunsoft5BPrescaler = 16
+
+// sunsoft5BLevels is the logarithmic DAC, 1.5dB per step from level 31
+var sunsoft5BLevels [32]float32
+
+func init() {
+	for level := 1; level < len(sunsoft5BLevels); level++ {
+		sunsoft5BLevels[level] = float32(math.Pow(10, float64(level-31)*1.5/20))
+	}
+}
+
+// Sunsoft5B is the expansion sound of Sunsoft's 5B mapper, a YM2149F:
+// three square wave channels that can mix in a shared noise generator and
+// take their volume from a shared envelope
+type Sunsoft5B struct {
+	// Registers 0-13 written through $C000 and $E000
+	//   0-5: tone periods of channels A-C, 12 bits each
+	//   6: noise period
+	//   7: bits 0-2 disable the tones, bits 3-5 the noise of each channel
+	//   8-10: channel volumes, bit 4 selects the envelope
+	//   11-12: envelope period
+	//   13: envelope shape
+	Registers [14]uint8
+
+	selected  uint8 // Register the next $E000 write goes to
+	prescaler uint8
+
+	toneTimers [3]uint16
+	tones      [3]bool // Square wave outputs
+
+	noiseTimer uint8
+	noise      uint32 // 17-bit LFSR, bit 0 is the output
+
+	envelopeTimer  uint16
+	envelopeStep   uint8 // 0-31
+	envelopeAttack bool  // The envelope rises during its current cycle
+	envelopeHold   bool  // The envelope stopped after its last cycle
+}
+
+// NewSunsoft5B creates a Sunsoft 5B sound chip
+func NewSunsoft5B() *Sunsoft5B {
+	return &Sunsoft5B{noise: 1}
+}
+
+// WriteRegister handles the register select at $C000-$DFFF and the register
+// data at $E000-$FFFF
+func (s *Sunsoft5B) WriteRegister(address uint16, value uint8) {
+	switch {
+	case address >= 0xE000:
+		if int(s.selected) >= len(s.Registers) {
+			// The I/O ports, unused by the NES
+			return
+		}
+		s.Registers[s.selected] = value
+		if s.selected == 13 {
+			// Writing the shape restarts the envelope
+			s.envelopeTimer = 0
+			s.envelopeStep = 0
+			s.envelopeAttack = value&0x04 != 0
+			s.envelopeHold = false
+		}
+	case address >= 0xC000:
+		s.selected = value & 0x0F
+	}
+}
+
+// Step advances the chip by one CPU cycle
+func (s *Sunsoft5B) Step() {
+	s.prescaler++
+	if s.prescaler < sunsoft5BPrescaler {
+		return
+	}
+	s.prescaler = 0
+
+	for i := range s.tones {
+		period := uint16(s.Registers[2*i]) | uint16(s.Registers[2*i+1]&0x0F)<<8
+		s.toneTimers[i]++
+		if s.toneTimers[i] >= max(period, 1) {
+			s.toneTimers[i] = 0
+			s.tones[i] = !s.tones[i]
+		}
+	}
+
+	// The noise shifts at half the rate of the tones
+	s.noiseTimer++
+	if s.noiseTimer >= 2*max(s.Registers[6]&0x1F, 1) {
+		s.noiseTimer = 0
+		feedback := (s.noise ^ s.noise>>3) & 1
+		s.noise = s.noise>>1 | feedback<<16
+	}
+
+	s.envelopeTimer++
+	if s.envelopeTimer >= max(uint16(s.Registers[11])|uint16(s.Registers[12])<<8, 1) {
+		s.envelopeTimer = 0
+		s.stepEnvelope()
+	}
+}
+
+// stepEnvelope moves the envelope one of its 32 steps on
+// At the end of a cycle the shape's bits decide what happens: without
+// continue (bit 3) it drops to 0 and stays there, with hold (bit 0) it
+// stays at its last level, and alternate (bit 1) reverses the direction
+func (s *Sunsoft5B) stepEnvelope() {
+	if s.envelopeHold {
+		return
+	}
+	if s.envelopeStep < 31 {
+		s.envelopeStep++
+		return
+	}
+
+	shape := s.Registers[13]
+	switch {
+	case shape&0x08 == 0:
+		s.envelopeAttack = false
+		s.envelopeHold = true
+	case shape&0x01 != 0:
+		if shape&0x02 != 0 {
+			s.envelopeAttack = !s.envelopeAttack
+		}
+		s.envelopeHold = true
+	default:
+		if shape&0x02 != 0 {
+			s.envelopeAttack = !s.envelopeAttack
+		}
+		s.envelopeStep = 0
+	}
+}
+
+// envelopeLevel returns the envelope's current level, 0-31
+func (s *Sunsoft5B) envelopeLevel() uint8 {
+	if s.envelopeAttack {
+		return s.envelopeStep
+	}
+	return 31 - s.envelopeStep
+}
+
+// Output returns the chip's output at the level of the APU mix
+func (s *Sunsoft5B) Output() float32 {
+	var output float32
+	for i, tone := range s.tones {
+		// A disabled tone or noise counts as always high
+		tone = tone || s.Registers[7]&(0x01<<i) != 0
+		noise := s.noise&1 != 0 || s.Registers[7]&(0x08<<i) != 0
+		if !tone || !noise {
+			continue
+		}
+
+		volume := s.Registers[8+i]
+		switch {
+		case volume&0x10 != 0:
+			output += sunsoft5BLevels[s.envelopeLevel()]
+		case volume&0x0F != 0:
+			// The 16 volumes use every other level of the DAC
+			output += sunsoft5BLevels[2*(volume&0x0F)+1]
+		}
+	}
+	return output * sunsoft5BScale
+}
@@ -0,0 +1,38 @@
+// Package apu implements the NES Audio Processing Unit emulation
+package apu
+
+// Timing holds the region-dependent APU rates
+type Timing struct {
+	CPUClock float64 // CPU clock in Hz, the APU runs off the same clock
+	PAL      bool    // Use the PAL frame counter, noise and DMC period tables
+}
+
+// NTSCTiming is the 2A03 used in North American and Japanese consoles
+var NTSCTiming = Timing{
+	CPUClock: 1789773,
+	PAL:      false,
+}
+
+// PALTiming is the 2A07 used in European consoles
+var PALTiming = Timing{
+	CPUClock: 1662607,
+	PAL:      true,
+}
+
+// DendyTiming is the UA6527P used in Dendy famiclones, which keeps the
+// NTSC tables but runs from a slower clock
+var DendyTiming = Timing{
+	CPUClock: 1773448,
+	PAL:      false,
+}
+
+// SetTiming selects the region-dependent APU rates
+func (a *APU) SetTiming(timing Timing) {
+	a.timing = timing
+	a.output = newBlipBuffer(timing.CPUClock, a.sampleRate)
+}
+
+// GetTiming returns the region-dependent APU rates
+func (a *APU) GetTiming() Timing {
+	return a.timing
+}
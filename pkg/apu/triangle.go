@@ -0,0 +1,87 @@
+// Package apu implements the NES Audio Processing Unit emulation
+package apu
+
+// triangleSequence is the 32-step waveform of the triangle channel
+var triangleSequence = [32]uint8{
+	15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1, 0,
+	0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+}
+
+// TriangleChannel represents the triangle wave channel
+type TriangleChannel struct {
+	Enabled bool
+
+	Period       uint16 // 11-bit timer reload value
+	timer        uint16
+	sequenceStep uint8 // Position in triangleSequence
+
+	// Linear counter, a finer grained length counter clocked every quarter frame
+	LinearCounter uint8
+	LinearReload  uint8
+	linearReload  bool // Reload flag, set by writes to $400B
+	Control       bool // Halts the length counter and keeps reloading the linear counter
+
+	LengthCounter uint8
+}
+
+// writeLinear handles $4008: control flag and linear counter reload value
+func (t *TriangleChannel) writeLinear(value uint8) {
+	t.Control = value&0x80 != 0
+	t.LinearReload = value & 0x7F
+}
+
+// writeTimerLow handles $400A
+func (t *TriangleChannel) writeTimerLow(value uint8) {
+	t.Period = t.Period&0x0700 | uint16(value)
+}
+
+// writeTimerHigh handles $400B: length counter load and timer high bits
+func (t *TriangleChannel) writeTimerHigh(value uint8) {
+	t.Period = t.Period&0x00FF | uint16(value&0x07)<<8
+	t.LengthCounter = loadLength(t.Enabled, value, t.LengthCounter)
+	t.linearReload = true
+}
+
+// setEnabled handles the channel's bit in $4015, disabling clears the length counter
+func (t *TriangleChannel) setEnabled(enabled bool) {
+	t.Enabled = enabled
+	if !enabled {
+		t.LengthCounter = 0
+	}
+}
+
+// stepTimer is called every CPU cycle, the triangle timer runs at the CPU clock
+// The sequencer only moves while both counters are running
+func (t *TriangleChannel) stepTimer() {
+	if t.timer > 0 {
+		t.timer--
+		return
+	}
+	t.timer = t.Period
+	if t.LengthCounter > 0 && t.LinearCounter > 0 {
+		t.sequenceStep = (t.sequenceStep + 1) & 0x1F
+	}
+}
+
+// clockLinear is called every quarter frame
+func (t *TriangleChannel) clockLinear() {
+	if t.linearReload {
+		t.LinearCounter = t.LinearReload
+	} else if t.LinearCounter > 0 {
+		t.LinearCounter--
+	}
+	if !t.Control {
+		t.linearReload = false
+	}
+}
+
+// clockLength is called every half frame
+func (t *TriangleChannel) clockLength() {
+	clockLength(&t.LengthCounter, t.Control)
+}
+
+// Output returns the channel's current level, 0-15
+// When silenced the sequencer stops where it is instead of dropping to 0
+func (t *TriangleChannel) Output() uint8 {
+	return triangleSequence[t.sequenceStep]
+}
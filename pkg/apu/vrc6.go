@@ -0,0 +1,175 @@
+// Package apu implements the NES Audio Processing Unit emulation
+package apu
+
+// vrc6Scale converts the VRC6's 6-bit output to the level of the 2A03 mix,
+// so a VRC6 pulse at full volume is about as loud as an APU pulse
+const vrc6Scale = 0.0107
+
+// VRC6 is the expansion sound of Konami's VRC6 mapper: two pulse channels
+// with 8 duty cycles and a sawtooth channel
+type VRC6 struct {
+	Pulse1   VRC6Pulse
+	Pulse2   VRC6Pulse
+	Sawtooth VRC6Sawtooth
+
+	halt      bool  // $9003 bit 0 stops all channels
+	frequency uint8 // $9003 bits 1-2 shift the periods right by 4 or 8
+}
+
+// VRC6Pulse is one of the VRC6's pulse channels
+type VRC6Pulse struct {
+	Enabled bool
+	Volume  uint8
+	Duty    uint8 // High for Duty+1 of 16 steps
+	Mode    bool  // Ignore the duty and output the volume constantly
+	Period  uint16
+	timer   uint16
+	step    uint8
+}
+
+// VRC6Sawtooth is the VRC6's sawtooth channel
+type VRC6Sawtooth struct {
+	Enabled     bool
+	Rate        uint8 // Added to the accumulator every other clock
+	Period      uint16
+	timer       uint16
+	step        uint8
+	accumulator uint8
+}
+
+// NewVRC6 creates a VRC6 sound chip
+func NewVRC6() *VRC6 {
+	return &VRC6{}
+}
+
+// WriteRegister handles writes to $9000-$9003, $A000-$A002 and $B000-$B002
+// Boards that swap address lines A0 and A1 should swap them before calling
+func (v *VRC6) WriteRegister(address uint16, value uint8) {
+	switch address {
+	case 0x9000:
+		v.Pulse1.writeControl(value)
+	case 0x9001:
+		v.Pulse1.writePeriodLow(value)
+	case 0x9002:
+		v.Pulse1.writePeriodHigh(value)
+	case 0x9003:
+		v.halt = value&0x01 != 0
+		v.frequency = (value >> 1) & 0x03
+	case 0xA000:
+		v.Pulse2.writeControl(value)
+	case 0xA001:
+		v.Pulse2.writePeriodLow(value)
+	case 0xA002:
+		v.Pulse2.writePeriodHigh(value)
+	case 0xB000:
+		v.Sawtooth.Rate = value & 0x3F
+	case 0xB001:
+		v.Sawtooth.Period = v.Sawtooth.Period&0x0F00 | uint16(value)
+	case 0xB002:
+		v.Sawtooth.Period = v.Sawtooth.Period&0x00FF | uint16(value&0x0F)<<8
+		v.Sawtooth.Enabled = value&0x80 != 0
+		if !v.Sawtooth.Enabled {
+			v.Sawtooth.accumulator = 0
+			v.Sawtooth.step = 0
+		}
+	}
+}
+
+// periodShift returns how far the frequency control shifts the periods
+func (v *VRC6) periodShift() uint {
+	switch {
+	case v.frequency&0x02 != 0:
+		return 8
+	case v.frequency&0x01 != 0:
+		return 4
+	}
+	return 0
+}
+
+// Step advances the chip by one CPU cycle
+func (v *VRC6) Step() {
+	if v.halt {
+		return
+	}
+	shift := v.periodShift()
+	v.Pulse1.stepTimer(shift)
+	v.Pulse2.stepTimer(shift)
+	v.Sawtooth.stepTimer(shift)
+}
+
+// Output returns the chip's output at the level of the APU mix
+func (v *VRC6) Output() float32 {
+	level := int(v.Pulse1.Output()) + int(v.Pulse2.Output()) + int(v.Sawtooth.Output())
+	return float32(level) * vrc6Scale
+}
+
+// writeControl handles $9000/$A000: mode, duty and volume
+func (p *VRC6Pulse) writeControl(value uint8) {
+	p.Mode = value&0x80 != 0
+	p.Duty = (value >> 4) & 0x07
+	p.Volume = value & 0x0F
+}
+
+// writePeriodLow handles $9001/$A001
+func (p *VRC6Pulse) writePeriodLow(value uint8) {
+	p.Period = p.Period&0x0F00 | uint16(value)
+}
+
+// writePeriodHigh handles $9002/$A002, disabling resets the duty sequence
+func (p *VRC6Pulse) writePeriodHigh(value uint8) {
+	p.Period = p.Period&0x00FF | uint16(value&0x0F)<<8
+	p.Enabled = value&0x80 != 0
+	if !p.Enabled {
+		p.step = 0
+	}
+}
+
+// stepTimer is called every CPU cycle
+func (p *VRC6Pulse) stepTimer(shift uint) {
+	if !p.Enabled {
+		return
+	}
+	if p.timer > 0 {
+		p.timer--
+		return
+	}
+	p.timer = p.Period >> shift
+	p.step = (p.step + 1) & 0x0F
+}
+
+// Output returns the channel's current level, 0-15
+func (p *VRC6Pulse) Output() uint8 {
+	if !p.Enabled {
+		return 0
+	}
+	if p.Mode || p.step <= p.Duty {
+		return p.Volume
+	}
+	return 0
+}
+
+// stepTimer is called every CPU cycle
+// The accumulator grows on every other step and resets after 14 steps
+func (s *VRC6Sawtooth) stepTimer(shift uint) {
+	if !s.Enabled {
+		return
+	}
+	if s.timer > 0 {
+		s.timer--
+		return
+	}
+	s.timer = s.Period >> shift
+
+	s.step++
+	if s.step == 14 {
+		s.step = 0
+		s.accumulator = 0
+	} else if s.step%2 == 0 {
+		s.accumulator += s.Rate
+	}
+}
+
+// Output returns the channel's current level, the top 5 bits of the accumulator
+func (s *VRC6Sawtooth) Output() uint8 {
+	return s.accumulator >> 3
+}
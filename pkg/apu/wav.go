@@ -0,0 +1,90 @@
+// Package apu implements the NES Audio Processing Unit emulation
+package apu
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// wavHeaderSize is the size of a canonical RIFF/WAVE header
+const wavHeaderSize = 44
+
+// WAVWriter writes mono 16-bit PCM to a .wav file
+// The sizes in the header are filled in by Close
+type WAVWriter struct {
+	w          io.WriteSeeker
+	sampleRate int
+	dataSize   uint32
+	buffer     []byte
+}
+
+// NewWAVWriter writes the header of a WAV file and returns a writer for its samples
+func NewWAVWriter(w io.WriteSeeker, sampleRate int) (*WAVWriter, error) {
+	writer := &WAVWriter{w: w, sampleRate: sampleRate}
+	if err := writer.writeHeader(); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+// writeHeader writes the RIFF header with the current data size
+func (w *WAVWriter) writeHeader() error {
+	header := make([]byte, wavHeaderSize)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], 36+w.dataSize)
+	copy(header[8:], "WAVE")
+
+	copy(header[12:], "fmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)                     // Chunk size
+	binary.LittleEndian.PutUint16(header[20:], 1)                      // PCM
+	binary.LittleEndian.PutUint16(header[22:], 1)                      // Mono
+	binary.LittleEndian.PutUint32(header[24:], uint32(w.sampleRate))   // Sample rate
+	binary.LittleEndian.PutUint32(header[28:], uint32(w.sampleRate)*2) // Byte rate
+	binary.LittleEndian.PutUint16(header[32:], 2)                      // Block align
+	binary.LittleEndian.PutUint16(header[34:], 16)                     // Bits per sample
+
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], w.dataSize)
+
+	if _, err := w.w.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to write WAV header: %w", err)
+	}
+	if _, err := w.w.Write(header); err != nil {
+		return fmt.Errorf("failed to write WAV header: %w", err)
+	}
+	return nil
+}
+
+// WriteSamples converts samples in the -1 to 1 range to 16-bit PCM and writes them
+func (w *WAVWriter) WriteSamples(samples []float32) error {
+	if cap(w.buffer) < len(samples)*2 {
+		w.buffer = make([]byte, len(samples)*2)
+	}
+	buffer := w.buffer[:len(samples)*2]
+
+	for i, sample := range samples {
+		if sample > 1 {
+			sample = 1
+		} else if sample < -1 {
+			sample = -1
+		}
+		binary.LittleEndian.PutUint16(buffer[i*2:], uint16(int16(sample*32767)))
+	}
+
+	if _, err := w.w.Write(buffer); err != nil {
+		return fmt.Errorf("failed to write WAV samples: %w", err)
+	}
+	w.dataSize += uint32(len(buffer))
+	return nil
+}
+
+// Close fills in the sizes in the header
+// It doesn't close the underlying file
+func (w *WAVWriter) Close() error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	_, err := w.w.Seek(0, io.SeekEnd)
+	return err
+}
@@ -18,6 +18,12 @@ type CPU struct {
 	// Interrupt flags
 	nmiPending bool // NMI interrupt pending
 	irqPending bool // IRQ interrupt pending
+	irqLine    uint8 // Sources holding the IRQ line low, one bit per IRQSource
+
+	// Cycle accounting
+	Cycles   uint64 // Total CPU cycles executed since reset
+	stall    uint16 // Cycles the CPU is halted for (e.g. during OAM DMA)
+	dmaAlign bool   // A DMA was requested, its alignment cycle is still to be decided
 
 	// Memory interface
 	Memory interface {
@@ -29,6 +35,13 @@ type CPU struct {
 	}
 }
 
+// IRQ sources that share the CPU's level-triggered IRQ line
+const (
+	IRQSourceFrameCounter uint8 = 1 << iota // APU frame counter
+	IRQSourceDMC                            // APU delta modulation channel
+	IRQSourceMapper                         // Cartridge hardware
+)
+
 // NewCPU creates a new CPU instance
 func NewCPU() *CPU {
 	return &CPU{}
@@ -60,6 +73,12 @@ func (c *CPU) Reset() {
 	// Clear interrupt flags
 	c.nmiPending = false
 	c.irqPending = false
+	c.irqLine = 0
+
+	// Clear cycle accounting
+	c.Cycles = 0
+	c.stall = 0
+	c.dmaAlign = false
 	
 	// Read reset vector at 0xFFFC and 0xFFFD
 	fmt.Printf("Reset vector: %04X\n", c.Memory.ReadWord(0xFFFC))
@@ -79,18 +98,48 @@ func (c *CPU) TriggerIRQ() {
 	}
 }
 
+// SetIRQ raises or releases the IRQ line for one source
+// The line is level-triggered: the CPU keeps taking the interrupt while any
+// source holds it and the interrupt disable flag is clear
+func (c *CPU) SetIRQ(source uint8, active bool) {
+	if active {
+		c.irqLine |= source
+	} else {
+		c.irqLine &^= source
+	}
+}
+
+// Stall halts the CPU for the given number of cycles
+func (c *CPU) Stall(cycles uint16) {
+	c.stall += cycles
+}
+
+// StallDMA halts the CPU for a DMA transfer
+// The transfer waits one more cycle when it starts on an odd cycle. It is
+// requested in the middle of the write that triggers it, so the alignment is
+// decided when the stall begins, once that instruction's cycles are counted
+func (c *CPU) StallDMA(cycles uint16) {
+	c.stall += cycles
+	c.dmaAlign = true
+}
+
 // handleInterrupts processes any pending interrupts
 func (c *CPU) handleInterrupts() uint8 {
 	if c.nmiPending {
 		c.nmiPending = false
 		return c.handleNMI()
-	} else if c.irqPending {
+	} else if c.irqPending || c.irqLineAsserted() {
 		c.irqPending = false
 		return c.handleIRQ()
 	}
 	return 0
 }
 
+// irqLineAsserted reports whether the IRQ line is held and not masked
+func (c *CPU) irqLineAsserted() bool {
+	return c.irqLine != 0 && c.GetFlag(FlagI) == 0
+}
+
 // handleNMI processes a non-maskable interrupt
 func (c *CPU) handleNMI() uint8 {
 	// Push PC and status to stack
@@ -127,10 +176,28 @@ func (c *CPU) GetInstruction(opcode byte) Instruction {
 }
 
 // Step executes a single CPU instruction
+// While the CPU is stalled, each call consumes a single stall cycle instead
 func (c *CPU) Step() (uint8, error) {
+	// A DMA starting on an odd cycle waits for one alignment cycle
+	if c.dmaAlign {
+		c.dmaAlign = false
+		if c.Cycles%2 == 1 {
+			c.stall++
+		}
+	}
+
+	// A stalled CPU does nothing but burn cycles
+	if c.stall > 0 {
+		c.stall--
+		c.Cycles++
+		return 1, nil
+	}
+
 	// Check for interrupts first
-	if c.nmiPending || c.irqPending {
-		return c.handleInterrupts(), nil
+	if c.nmiPending || c.irqPending || c.irqLineAsserted() {
+		cycles := c.handleInterrupts()
+		c.Cycles += uint64(cycles)
+		return cycles, nil
 	}
 	
 	// Read opcode
@@ -144,6 +211,7 @@ func (c *CPU) Step() (uint8, error) {
 	} else {
 		return 0, fmt.Errorf("missing method for instruction opcode: %02X", opcode)
 	}
+	c.Cycles += uint64(cycles)
 
 	return cycles, nil // Return cycles used and no error
 }
@@ -0,0 +1,150 @@
+package cpu
+
+import "testing"
+
+// testMemory is a flat 64KB address space where writing $4014 starts an
+// OAM DMA, like the NES memory map does
+type testMemory struct {
+	data [0x10000]byte
+	cpu  *CPU
+}
+
+func (m *testMemory) Read(address uint16) byte {
+	return m.data[address]
+}
+
+func (m *testMemory) Write(address uint16, value byte) {
+	m.data[address] = value
+	if address == 0x4014 {
+		m.cpu.StallDMA(513)
+	}
+}
+
+func (m *testMemory) ReadWord(address uint16) uint16 {
+	return uint16(m.data[address]) | uint16(m.data[address+1])<<8
+}
+
+func (m *testMemory) WriteWord(address uint16, value uint16) {
+	m.data[address] = byte(value)
+	m.data[address+1] = byte(value >> 8)
+}
+
+func (m *testMemory) ReadAddressIndirectPageBoundaryBug(address uint16) uint16 {
+	high := address&0xFF00 | uint16(byte(address)+1)
+	return uint16(m.data[address]) | uint16(m.data[high])<<8
+}
+
+// newTestCPU resets a CPU running program from $8000
+func newTestCPU(program ...byte) *CPU {
+	c := NewCPU()
+	m := &testMemory{cpu: c}
+	copy(m.data[0x8000:], program)
+	m.data[0xFFFC], m.data[0xFFFD] = 0x00, 0x80
+	c.SetMemory(m)
+	c.Reset()
+	return c
+}
+
+// stepUntilPC runs the CPU until PC reaches address and returns the cycles taken
+func stepUntilPC(t *testing.T, c *CPU, address uint16) int {
+	t.Helper()
+	total := 0
+	for i := 0; c.PC != address; i++ {
+		if i > 10000 {
+			t.Fatalf("PC never reached $%04X", address)
+		}
+		cycles, err := c.Step()
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += int(cycles)
+	}
+	return total
+}
+
+func TestOAMDMAStall(t *testing.T) {
+	tests := []struct {
+		name  string
+		nops  int // NOPs before the STA $4014, 2 cycles each
+		start uint64
+		want  int // Cycles from the write's instruction to the next one's end
+	}{
+		{"write ends on an even cycle", 0, 0, 4 + 513 + 2},
+		{"write ends on an odd cycle", 0, 1, 4 + 514 + 2},
+		{"after NOPs, even", 3, 0, 4 + 513 + 2},
+		{"after NOPs, odd", 3, 1, 4 + 514 + 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var program []byte
+			for i := 0; i < tt.nops; i++ {
+				program = append(program, 0xEA)
+			}
+			program = append(program, 0x8D, 0x14, 0x40, 0xEA) // STA $4014, NOP
+			c := newTestCPU(program...)
+			c.Cycles = tt.start
+
+			sta := uint16(0x8000 + tt.nops)
+			stepUntilPC(t, c, sta)
+			if got := stepUntilPC(t, c, sta+4); got != tt.want {
+				t.Errorf("took %d cycles, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStallHasNoAlignment(t *testing.T) {
+	for _, start := range []uint64{0, 1} {
+		c := newTestCPU(0xEA)
+		c.Cycles = start
+		c.Stall(4) // A DMC fetch
+		if got := stepUntilPC(t, c, 0x8001); got != 4+2 {
+			t.Errorf("starting at cycle %d: took %d cycles, want %d", start, got, 4+2)
+		}
+	}
+}
+
+func TestJSRAndRTS(t *testing.T) {
+	c := newTestCPU(0x20, 0x10, 0x80, 0xEA) // JSR $8010, NOP
+	m := c.Memory.(*testMemory)
+	m.data[0x8010] = 0x60 // RTS
+
+	if cycles, _ := c.Step(); cycles != 6 || c.PC != 0x8010 {
+		t.Fatalf("JSR: PC = $%04X after %d cycles, want $8010 after 6", c.PC, cycles)
+	}
+	if pushed := m.ReadWord(0x0100 + uint16(c.SP) + 1); pushed != 0x8002 {
+		t.Errorf("JSR pushed $%04X, want $8002", pushed)
+	}
+	if cycles, _ := c.Step(); cycles != 6 || c.PC != 0x8003 {
+		t.Errorf("RTS: PC = $%04X after %d cycles, want $8003 after 6", c.PC, cycles)
+	}
+}
+
+func TestRTI(t *testing.T) {
+	c := newTestCPU(0xEA)
+	m := c.Memory.(*testMemory)
+	m.data[0xFFFA], m.data[0xFFFB] = 0x00, 0x90
+	m.data[0x9000] = 0x40 // RTI
+
+	c.P = 0xC3 // N, V, Z and C set, I clear
+	sp := c.SP
+	c.TriggerNMI()
+	if _, err := c.Step(); err != nil || c.PC != 0x9000 {
+		t.Fatalf("NMI: PC = $%04X, err = %v, want $9000", c.PC, err)
+	}
+
+	cycles, err := c.Step()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cycles != 6 || c.PC != 0x8000 {
+		t.Errorf("RTI: PC = $%04X after %d cycles, want $8000 after 6", c.PC, cycles)
+	}
+	if c.P != 0xE3 {
+		t.Errorf("RTI: P = %#02x, want %#02x", c.P, 0xE3)
+	}
+	if c.SP != sp {
+		t.Errorf("RTI: SP = %#02x, want %#02x", c.SP, sp)
+	}
+}
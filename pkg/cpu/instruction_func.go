@@ -758,8 +758,8 @@ func JMPAbsolute(c *CPU) uint8 {
 
 func JSRAbsolute(c *CPU) uint8 {
 	address := c.AbsoluteMemoryDirection()
-	// a real cpu left the PC in the position PC + 1
-	c.pushStackWord(c.PC + 2 - 1) //TODO: check this
+	// Push the address of the last byte of the instruction, RTS adds 1 to it
+	c.pushStackWord(c.PC + 2)
 	c.PC = address
 
 	return 6 // cycles 6
@@ -784,6 +784,13 @@ func RTSImplied(c *CPU) uint8 {
 	c.MovePC(pulled - c.PC)
 } */
 
+func RTIImplied(c *CPU) uint8 {
+	c.P = (c.pullStack() & 0xEF) | 0x20 // Clear B flag, set bit 5
+	c.PC = c.pullStackWord()            // Unlike RTS, no 1 is added
+
+	return 6 // cycles 6
+}
+
 // Flag instructions
 
 // CLC - Clear Carry Flag
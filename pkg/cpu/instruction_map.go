@@ -77,7 +77,7 @@ var InstructionTable = map[byte]Instruction{
 	0x38: {0x38, "SEC", false, nil},
 
 	// RTI
-	0x40: {0x40, "RTI", false, nil},
+	0x40: {0x40, "RTI", false, RTIImplied},
 
 	// EOR
 	0x41: {0x41, "EOR", false, nil},
@@ -0,0 +1,21 @@
+// Package cpu implements the NES CPU (6502) emulation
+package cpu
+
+import "github.com/example/my-golang-project/pkg/savestate"
+
+// Serialize saves or loads the registers, pending interrupts and cycle count
+func (c *CPU) Serialize(s *savestate.Serializer) {
+	s.Section("CPU ")
+	s.Uint8(&c.A)
+	s.Uint8(&c.X)
+	s.Uint8(&c.Y)
+	s.Uint8(&c.P)
+	s.Uint8(&c.SP)
+	s.Uint16(&c.PC)
+	s.Bool(&c.nmiPending)
+	s.Bool(&c.irqPending)
+	s.Uint8(&c.irqLine)
+	s.Uint64(&c.Cycles)
+	s.Uint16(&c.stall)
+	s.Bool(&c.dmaAlign)
+}
@@ -0,0 +1,130 @@
+// Package debug provides debugging tools for the NES emulator
+package debug
+
+import (
+	"fmt"
+	"image/color"
+
+	"github.com/example/my-golang-project/pkg/apu"
+	"github.com/example/my-golang-project/pkg/nes"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"golang.org/x/image/font/basicfont"
+)
+
+const (
+	apuRowHeight   = 52  // Height of each channel's row
+	apuScopeWidth  = 256 // Width of the oscilloscope trace
+	apuScopeHeight = 40
+)
+
+// channelKeys toggle mute on each channel, or solo with Shift
+var channelKeys = [apu.ChannelCount]ebiten.Key{
+	ebiten.KeyDigit1, ebiten.KeyDigit2, ebiten.KeyDigit3, ebiten.KeyDigit4, ebiten.KeyDigit5,
+}
+
+// channelColors are the trace colors of each channel
+var channelColors = [apu.ChannelCount]color.RGBA{
+	{255, 120, 120, 255}, // Pulse 1
+	{255, 200, 100, 255}, // Pulse 2
+	{120, 200, 255, 255}, // Triangle
+	{200, 200, 200, 255}, // Noise
+	{150, 255, 150, 255}, // DMC
+}
+
+// APUDebugger shows the state of every APU channel with an oscilloscope trace,
+// and lets channels be muted or soloed
+type APUDebugger struct {
+	nes   *nes.NES
+	trace [apu.ScopeSize]uint8
+}
+
+// NewAPUDebugger creates a new APU debugger panel
+func NewAPUDebugger(nes *nes.NES) *APUDebugger {
+	return &APUDebugger{nes: nes}
+}
+
+// Update handles the mute and solo keys
+func (d *APUDebugger) Update() {
+	shift := ebiten.IsKeyPressed(ebiten.KeyShift)
+	for i, key := range channelKeys {
+		if !inpututil.IsKeyJustPressed(key) {
+			continue
+		}
+		channel := apu.Channel(i)
+		if shift {
+			d.nes.APU.SetChannelSolo(channel, !d.nes.APU.ChannelSoloed(channel))
+		} else {
+			d.nes.APU.SetChannelMuted(channel, !d.nes.APU.ChannelMuted(channel))
+		}
+	}
+}
+
+// Draw renders the panel with its top-left corner at x, y
+func (d *APUDebugger) Draw(screen *ebiten.Image, x, y int) {
+	face := basicfont.Face7x13
+
+	text.Draw(screen, "APU channels (1-5 mute, Shift+1-5 solo):", face, x, y, color.RGBA{100, 200, 255, 255})
+	y += lineHeight / 2
+
+	for i := 0; i < apu.ChannelCount; i++ {
+		channel := apu.Channel(i)
+		status := d.nes.APU.ChannelStatus(channel)
+		d.drawChannel(screen, x, y, status)
+		y += apuRowHeight
+	}
+}
+
+// drawChannel draws one channel's row: its registers on the left, the trace on the right
+func (d *APUDebugger) drawChannel(screen *ebiten.Image, x, y int, status apu.ChannelStatus) {
+	face := basicfont.Face7x13
+
+	name := status.Channel.String()
+	switch {
+	case d.nes.APU.ChannelSoloed(status.Channel):
+		name += " [SOLO]"
+	case d.nes.APU.ChannelMuted(status.Channel):
+		name += " [MUTE]"
+	}
+	nameColor := color.RGBA{255, 255, 255, 255}
+	if status.Muted {
+		nameColor = color.RGBA{120, 120, 120, 255}
+	}
+	text.Draw(screen, name, face, x, y+lineHeight, nameColor)
+
+	info := fmt.Sprintf("Period:%4d  Vol:%3d  Len:%3d", status.Period, status.Volume, status.LengthCounter)
+	if status.Channel == apu.ChannelPulse1 || status.Channel == apu.ChannelPulse2 {
+		info += fmt.Sprintf("  Duty:%d", status.Duty)
+	}
+	if !status.Enabled {
+		info += "  off"
+	}
+	text.Draw(screen, info, face, x, y+2*lineHeight, color.White)
+
+	// Oscilloscope trace, scaled to the channel's range
+	scopeX := x + 370
+	ebitenutil.DrawRect(screen, float64(scopeX), float64(y+4), apuScopeWidth, apuScopeHeight, color.RGBA{20, 20, 20, 255})
+
+	maxLevel := 15.0
+	if status.Channel == apu.ChannelDMC {
+		maxLevel = 127
+	}
+	traceColor := channelColors[status.Channel]
+	if status.Muted {
+		traceColor = color.RGBA{90, 90, 90, 255}
+	}
+
+	d.nes.APU.ScopeTrace(status.Channel, &d.trace)
+	step := float64(len(d.trace)) / apuScopeWidth
+	prevY := 0.0
+	for px := 0; px < apuScopeWidth; px++ {
+		level := float64(d.trace[int(float64(px)*step)])
+		py := float64(y+4+apuScopeHeight-1) - level/maxLevel*(apuScopeHeight-2)
+		if px > 0 {
+			ebitenutil.DrawLine(screen, float64(scopeX+px-1), prevY, float64(scopeX+px), py, traceColor)
+		}
+		prevY = py
+	}
+}
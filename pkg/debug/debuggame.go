@@ -13,6 +13,7 @@ import (
 // DebugGame implements ebiten.Game for the NES debugging interface
 type DebugGame struct {
 	cpuDebugger   *CPUDebugger
+	apuDebugger   *APUDebugger
 	nes           *nes.NES
 	renderer      *ppu.Renderer
 	isFirstRender bool
@@ -32,6 +33,7 @@ func (g *DebugGame) InitScreen() {
 func NewDebugGame(nes *nes.NES) *DebugGame {
 	game := &DebugGame{
 		cpuDebugger:   NewCPUDebugger(nes),
+		apuDebugger:   NewAPUDebugger(nes),
 		nes:           nes,
 		renderer:      ppu.NewRenderer(nes.PPU),
 		isFirstRender: false,
@@ -48,6 +50,7 @@ func (g *DebugGame) Update() error {
 	if err != nil {
 		return err
 	}
+	g.apuDebugger.Update()
 	
 	// Run multiple steps per frame for better performance when not paused
 	if !g.cpuDebugger.paused {
@@ -95,6 +98,9 @@ func (g *DebugGame) Draw(screen *ebiten.Image) {
 	op := &ebiten.DrawImageOptions{}
 	op.GeoM.Translate(800, 50) // Position the PPU output much further to the right
 	screen.DrawImage(g.renderer.GetFrameBuffer(), op)
+	
+	// Draw the APU channels below the PPU output
+	g.apuDebugger.Draw(screen, 670, 320)
 }
 
 // OnScreenRenderInit runs when the screen is first rendered
@@ -0,0 +1,163 @@
+// Package input implements the devices plugged into the NES controller ports
+package input
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// DefaultTurboRate is the number of presses per second of the turbo buttons
+const DefaultTurboRate = 15
+
+// Names of the buttons in a bindings file
+// TurboA and TurboB press A and B repeatedly while held
+const (
+	BindingTurboA = "TurboA"
+	BindingTurboB = "TurboB"
+)
+
+// ButtonNames maps the names used in bindings files to the controller buttons
+var ButtonNames = map[string]Button{
+	"A":      ButtonA,
+	"B":      ButtonB,
+	"Select": ButtonSelect,
+	"Start":  ButtonStart,
+	"Up":     ButtonUp,
+	"Down":   ButtonDown,
+	"Left":   ButtonLeft,
+	"Right":  ButtonRight,
+}
+
+// Bindings maps host keys and gamepad buttons to the controllers
+type Bindings struct {
+	TurboRate float64         `json:"turbo_rate"` // Turbo presses per second
+	Ports     [4]PortBindings `json:"ports"`      // Players 1 to 4, 3 and 4 need a Four Score
+
+	// Keys of the Power Pad's buttons, row by row as printed on side B,
+	// empty for none. Side A is the same mat flipped, so its columns are mirrored
+	PowerPad [PowerPadButtons]string `json:"power_pad"`
+}
+
+// PortBindings maps the inputs of one player's controller
+// Keys and buttons are listed by controller button name, including TurboA
+// and TurboB. Key names are the ones of ebiten.Key, e.g. "ArrowUp" or "X";
+// gamepad buttons are named after ebiten's standard layout, e.g. "RightBottom"
+type PortBindings struct {
+	Keyboard       map[string][]string `json:"keyboard"`
+	Gamepad        int                 `json:"gamepad"` // 1-based index of the gamepad, 0 for none
+	GamepadButtons map[string][]string `json:"gamepad_buttons"`
+	GamepadStick   bool                `json:"gamepad_stick"` // Left stick also moves the D-pad
+}
+
+// DefaultBindings returns the bindings used without a bindings file
+// Player 1 plays on the arrows and Z/X, player 2 on IJKL and comma/period,
+// and the first four gamepads drive one player each
+func DefaultBindings() Bindings {
+	gamepad := map[string][]string{
+		"A":           {"RightBottom"},
+		"B":           {"RightLeft"},
+		"Select":      {"CenterLeft"},
+		"Start":       {"CenterRight"},
+		"Up":          {"LeftTop"},
+		"Down":        {"LeftBottom"},
+		"Left":        {"LeftLeft"},
+		"Right":       {"LeftRight"},
+		BindingTurboA: {"RightRight"},
+		BindingTurboB: {"RightTop"},
+	}
+	return Bindings{
+		TurboRate: DefaultTurboRate,
+		Ports: [4]PortBindings{
+			{
+				Keyboard: map[string][]string{
+					"A":           {"X"},
+					"B":           {"Z"},
+					"Select":      {"ShiftRight"},
+					"Start":       {"Enter"},
+					"Up":          {"ArrowUp"},
+					"Down":        {"ArrowDown"},
+					"Left":        {"ArrowLeft"},
+					"Right":       {"ArrowRight"},
+					BindingTurboA: {"S"},
+					BindingTurboB: {"A"},
+				},
+				Gamepad:        1,
+				GamepadButtons: gamepad,
+				GamepadStick:   true,
+			},
+			{
+				Keyboard: map[string][]string{
+					"A":           {"Period"},
+					"B":           {"Comma"},
+					"Select":      {"BracketLeft"},
+					"Start":       {"BracketRight"},
+					"Up":          {"I"},
+					"Down":        {"K"},
+					"Left":        {"J"},
+					"Right":       {"L"},
+					BindingTurboA: {"Slash"},
+					BindingTurboB: {"Semicolon"},
+				},
+				Gamepad:        2,
+				GamepadButtons: gamepad,
+				GamepadStick:   true,
+			},
+			{Gamepad: 3, GamepadButtons: gamepad, GamepadStick: true},
+			{Gamepad: 4, GamepadButtons: gamepad, GamepadStick: true},
+		},
+		PowerPad: [PowerPadButtons]string{
+			"U", "I", "O", "P",
+			"J", "K", "L", "Semicolon",
+			"M", "Comma", "Period", "Slash",
+		},
+	}
+}
+
+// LoadBindings reads a JSON bindings file
+// Ports missing from the file have no bindings
+func LoadBindings(path string) (Bindings, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Bindings{}, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var b Bindings
+	if err := json.Unmarshal(data, &b); err != nil {
+		return Bindings{}, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if b.TurboRate <= 0 {
+		b.TurboRate = DefaultTurboRate
+	}
+	if err := b.Validate(); err != nil {
+		return Bindings{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return b, nil
+}
+
+// SaveBindings writes bindings to a JSON file, e.g. to start from the defaults
+func SaveBindings(path string, b Bindings) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Validate checks that every binding names a controller button
+// Key and gamepad button names are checked by the window that uses them
+func (b Bindings) Validate() error {
+	for i, port := range b.Ports {
+		for _, names := range []map[string][]string{port.Keyboard, port.GamepadButtons} {
+			for name := range names {
+				if _, ok := ButtonNames[name]; !ok && name != BindingTurboA && name != BindingTurboB {
+					return fmt.Errorf("player %d: unknown controller button %q", i+1, name)
+				}
+			}
+		}
+		if port.Gamepad < 0 {
+			return fmt.Errorf("player %d: invalid gamepad index %d", i+1, port.Gamepad)
+		}
+	}
+	return nil
+}
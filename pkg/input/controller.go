@@ -0,0 +1,69 @@
+// Package input implements the devices plugged into the NES controller ports
+package input
+
+// Button is a bit of the standard controller's report, in the order it is
+// shifted out
+type Button uint8
+
+const (
+	ButtonA Button = 1 << iota
+	ButtonB
+	ButtonSelect
+	ButtonStart
+	ButtonUp
+	ButtonDown
+	ButtonLeft
+	ButtonRight
+)
+
+// Controller is the standard NES joypad: a latch that captures the buttons
+// while the strobe is high, and an 8-bit shift register read one bit at a time
+type Controller struct {
+	buttons uint8 // Buttons currently held
+	strobe  bool  // Strobe bit, the register reloads continuously while set
+	shift   uint8 // Bits left to report, A first
+}
+
+// NewController creates a standard controller with no buttons held
+func NewController() *Controller {
+	return &Controller{}
+}
+
+// SetButton presses or releases a button
+func (c *Controller) SetButton(button Button, pressed bool) {
+	if pressed {
+		c.buttons |= uint8(button)
+	} else {
+		c.buttons &^= uint8(button)
+	}
+}
+
+// SetButtons replaces the state of all the buttons
+func (c *Controller) SetButtons(buttons uint8) {
+	c.buttons = buttons
+}
+
+// Buttons returns the buttons currently held
+func (c *Controller) Buttons() uint8 {
+	return c.buttons
+}
+
+// Write latches the buttons, bit 0 is the strobe
+func (c *Controller) Write(value uint8) {
+	c.strobe = value&0x01 != 0
+	if c.strobe {
+		c.shift = c.buttons
+	}
+}
+
+// Read returns the next button on D0
+// While the strobe is high it keeps returning A; after the 8 buttons,
+// official controllers return 1
+func (c *Controller) Read() uint8 {
+	if c.strobe {
+		return c.buttons & 0x01
+	}
+	bit := c.shift & 0x01
+	c.shift = c.shift>>1 | 0x80
+	return bit
+}
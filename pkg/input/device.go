@@ -0,0 +1,51 @@
+// Package input implements the devices plugged into the NES controller ports
+package input
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DeviceType selects the hardware plugged into the controller ports
+type DeviceType int
+
+const (
+	DeviceStandard        DeviceType = iota // A standard controller on each port
+	DeviceFourScore                         // Four Score adapter with four controllers
+	DeviceZapper                            // Controller on port 1, Zapper on port 2
+	DeviceArkanoid                          // Controller on port 1, NES Vaus paddle on port 2
+	DeviceArkanoidFamicom                   // Controllers, Famicom Vaus paddle on the expansion port
+	DevicePowerPadA                         // Controller on port 1, Power Pad side A on port 2
+	DevicePowerPadB                         // Controller on port 1, Power Pad side B on port 2
+	DeviceFamilyKeyboard                    // Controllers, Family BASIC keyboard on the expansion port
+)
+
+// deviceNames are the names of the device types on the command line
+var deviceNames = map[DeviceType]string{
+	DeviceStandard:        "standard",
+	DeviceFourScore:       "fourscore",
+	DeviceZapper:          "zapper",
+	DeviceArkanoid:        "arkanoid",
+	DeviceArkanoidFamicom: "arkanoid-famicom",
+	DevicePowerPadA:       "powerpad-a",
+	DevicePowerPadB:       "powerpad-b",
+	DeviceFamilyKeyboard:  "keyboard",
+}
+
+// ParseDeviceType converts a device name to a DeviceType
+func ParseDeviceType(name string) (DeviceType, error) {
+	for device, deviceName := range deviceNames {
+		if strings.EqualFold(name, deviceName) {
+			return device, nil
+		}
+	}
+	return DeviceStandard, fmt.Errorf("unknown input device: %s", name)
+}
+
+// String returns the name of the device type
+func (d DeviceType) String() string {
+	if name, ok := deviceNames[d]; ok {
+		return name
+	}
+	return fmt.Sprintf("DeviceType(%d)", int(d))
+}
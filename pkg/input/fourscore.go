@@ -0,0 +1,62 @@
+// Package input implements the devices plugged into the NES controller ports
+package input
+
+// fourScoreSignatures identify the adapter on each port after the two controllers
+var fourScoreSignatures = [2]uint8{0x08, 0x04}
+
+// FourScore is the four-player adapter that takes both controller ports
+// Each port reports 24 bits: its first controller, then the third or fourth
+// player's, then a signature telling games the adapter is there
+type FourScore struct {
+	ports [2]fourScorePort
+}
+
+// fourScorePort is the half of the adapter on one controller port
+type fourScorePort struct {
+	first     *Controller // Player 1 or 2
+	second    *Controller // Player 3 or 4
+	signature uint8
+	strobe    bool
+	shift     uint32
+}
+
+// NewFourScore creates a Four Score with the controllers of players 1 to 4
+func NewFourScore(controllers [4]*Controller) *FourScore {
+	f := &FourScore{}
+	for i := range f.ports {
+		f.ports[i] = fourScorePort{
+			first:     controllers[i],
+			second:    controllers[i+2],
+			signature: fourScoreSignatures[i],
+		}
+	}
+	return f
+}
+
+// Port returns the device to plug into controller port 0 or 1
+func (f *FourScore) Port(port int) InputDevice {
+	return &f.ports[port]
+}
+
+// latch returns the 24 bits the port reports
+func (p *fourScorePort) latch() uint32 {
+	return uint32(p.first.Buttons()) | uint32(p.second.Buttons())<<8 | uint32(p.signature)<<16
+}
+
+// Write latches the controllers, bit 0 is the strobe
+func (p *fourScorePort) Write(value uint8) {
+	p.strobe = value&0x01 != 0
+	if p.strobe {
+		p.shift = p.latch()
+	}
+}
+
+// Read returns the next bit on D0, 1 after the 24 bits
+func (p *fourScorePort) Read() uint8 {
+	if p.strobe {
+		return p.first.Buttons() & 0x01
+	}
+	bit := uint8(p.shift & 0x01)
+	p.shift = p.shift>>1 | 1<<23
+	return bit
+}
@@ -0,0 +1,18 @@
+// Package input implements the devices plugged into the NES controller ports
+package input
+
+// InputDevice is a device on one of the controller ports
+// Write receives the strobe bits written to $4016, and Read returns the
+// port's data lines D0-D4 when the CPU reads $4016 or $4017
+type InputDevice interface {
+	Write(value uint8)
+	Read() uint8
+}
+
+// ExpansionDevice is a device on the Famicom expansion port
+// It sees the writes to $4016 and drives data lines of both $4016 (port 0)
+// and $4017 (port 1), alongside the controllers
+type ExpansionDevice interface {
+	Write(value uint8)
+	Read(port int) uint8
+}
@@ -0,0 +1,213 @@
+package input
+
+import (
+	"slices"
+	"testing"
+)
+
+// readBits strobes a device and returns n reads masked to the given lines
+func readBits(device InputDevice, n int, mask uint8) []uint8 {
+	device.Write(1)
+	device.Write(0)
+	reads := make([]uint8, n)
+	for i := range reads {
+		reads[i] = device.Read() & mask
+	}
+	return reads
+}
+
+func TestController(t *testing.T) {
+	c := NewController()
+	c.SetButtons(uint8(ButtonA | ButtonStart | ButtonRight))
+
+	got := readBits(c, 10, 0x01)
+	want := []uint8{1, 0, 0, 1, 0, 0, 0, 1, 1, 1} // Then 1 past the 8 buttons
+	if !slices.Equal(got, want) {
+		t.Errorf("reads = %v, want %v", got, want)
+	}
+
+	// With the strobe high every read returns A
+	c.Write(1)
+	for i := 0; i < 3; i++ {
+		if bit := c.Read(); bit != 1 {
+			t.Errorf("read %d with the strobe high = %d, want A", i, bit)
+		}
+	}
+}
+
+func TestFourScore(t *testing.T) {
+	var controllers [4]*Controller
+	for i := range controllers {
+		controllers[i] = NewController()
+	}
+	controllers[0].SetButtons(uint8(ButtonA))
+	controllers[1].SetButtons(uint8(ButtonB))
+	controllers[2].SetButtons(uint8(ButtonStart))
+	controllers[3].SetButtons(uint8(ButtonRight))
+	f := NewFourScore(controllers)
+
+	tests := []struct {
+		port int
+		want uint32 // The 24 bits, first read in bit 0
+	}{
+		{0, uint32(ButtonA) | uint32(ButtonStart)<<8 | 0x08<<16},
+		{1, uint32(ButtonB) | uint32(ButtonRight)<<8 | 0x04<<16},
+	}
+	for _, tt := range tests {
+		reads := readBits(f.Port(tt.port), 26, 0x01)
+		var report uint32
+		for i, bit := range reads[:24] {
+			report |= uint32(bit) << i
+		}
+		if report != tt.want {
+			t.Errorf("port %d report = %#06x, want %#06x", tt.port, report, tt.want)
+		}
+		if reads[24] != 1 || reads[25] != 1 {
+			t.Errorf("port %d reads past the report = %v, want 1", tt.port, reads[24:])
+		}
+	}
+}
+
+// testScreen is a frame being drawn, for the Zapper
+type testScreen struct {
+	pixels        []uint8
+	scanline, dot int
+}
+
+func (s *testScreen) RenderingFrame() []uint8 {
+	return s.pixels
+}
+
+func (s *testScreen) RenderPosition() (int, int) {
+	return s.scanline, s.dot
+}
+
+func TestZapper(t *testing.T) {
+	// One white pixel at (100, 100)
+	screen := &testScreen{pixels: make([]uint8, zapperFrameWidth*zapperFrameHeight*4)}
+	offset := (100*zapperFrameWidth + 100) * 4
+	copy(screen.pixels[offset:], []uint8{0xFF, 0xFF, 0xFF, 0xFF})
+
+	tests := []struct {
+		name          string
+		x, y          int
+		scanline, dot int
+		light         bool
+	}{
+		{"not drawn yet", 100, 100, 99, 0, false},
+		{"beam on the pixel", 100, 100, 100, 100, false},
+		{"just drawn", 100, 100, 100, 102, true},
+		{"near the aim point", 102, 98, 101, 0, true},
+		{"last persistent scanline", 100, 100, 100 + zapperPersistence, 0, true},
+		{"faded", 100, 100, 101 + zapperPersistence, 0, false},
+		{"aimed away", 50, 100, 101, 0, false},
+		{"off screen", -1, -1, 101, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			z := NewZapper()
+			z.SetScreen(screen)
+			z.Aim(tt.x, tt.y)
+			screen.scanline, screen.dot = tt.scanline, tt.dot
+
+			// The light bit reads 0 when light is seen
+			if light := z.Read()&zapperLightBit == 0; light != tt.light {
+				t.Errorf("light = %v, want %v", light, tt.light)
+			}
+		})
+	}
+
+	z := NewZapper()
+	z.Trigger = true
+	if value := z.Read(); value != zapperLightBit|zapperTriggerBit {
+		t.Errorf("read with the trigger pulled = %#02x, want %#02x", value, zapperLightBit|zapperTriggerBit)
+	}
+}
+
+func TestVaus(t *testing.T) {
+	v := NewVaus()
+	v.Position = 0  // Reads vausMinimum, 0x62
+	v.Button = true // D4
+	got := readBits(v, 8, 0x18)
+	// 0x62 inverted is 0x9D, shifted out MSB first on D3
+	want := []uint8{0x18, 0x10, 0x10, 0x18, 0x18, 0x18, 0x10, 0x18}
+	if !slices.Equal(got, want) {
+		t.Errorf("reads = %#02x, want %#02x", got, want)
+	}
+
+	// The Famicom version reads on D1, the button on $4016
+	f := NewFamicomVaus()
+	f.Position = 255 // vausMaximum, 0xF2
+	port := f.ExpansionPort()
+	port.Write(1)
+	port.Write(0)
+	var reading uint8
+	for i := 0; i < 8; i++ {
+		reading = reading<<1 | port.Read(1)>>1
+	}
+	if reading != ^uint8(vausMaximum) {
+		t.Errorf("reading = %#02x, want %#02x", reading, ^uint8(vausMaximum))
+	}
+	if button := port.Read(0); button != 0 {
+		t.Errorf("$4016 = %#02x without the button, want 0", button)
+	}
+}
+
+func TestPowerPad(t *testing.T) {
+	p := NewPowerPad()
+	for _, button := range []int{2, 9, 4, 12} {
+		p.SetButton(button, true)
+	}
+
+	got := readBits(p, 10, 0x18)
+	// D3 shifts out buttons 2, 1, 5, 9, 6, 10, 11, 7 and D4 4, 3, 12, 8,
+	// then both read 1
+	want := []uint8{0x18, 0x00, 0x10, 0x08, 0x10, 0x10, 0x10, 0x10, 0x18, 0x18}
+	if !slices.Equal(got, want) {
+		t.Errorf("reads = %#02x, want %#02x", got, want)
+	}
+}
+
+func TestFamilyKeyboard(t *testing.T) {
+	k := NewFamilyKeyboard()
+	if !k.SetKey("A", true) || !k.SetKey("Space", true) {
+		t.Fatal("SetKey() of a known key failed")
+	}
+	if k.SetKey("Unknown", true) {
+		t.Error("SetKey() of an unknown key succeeded")
+	}
+
+	// Walk the matrix: reset to row 0, then alternate columns 0 and 1
+	pressed := map[[2]int]uint8{
+		{6, 0}: 0x02, // A is D1 of row 6, column 0
+		{8, 1}: 0x08, // Space is D3 of row 8, column 1
+	}
+	k.Write(0x05)
+	for row := 0; row < keyboardRows; row++ {
+		for column := 0; column < 2; column++ {
+			if row > 0 || column > 0 {
+				k.Write(0x04 | uint8(column)<<1)
+			}
+			want := 0x1E &^ pressed[[2]int{row, column}]
+			if got := k.Read(1); got != want {
+				t.Errorf("row %d, column %d = %#02x, want %#02x", row, column, got, want)
+			}
+			if got := k.Read(0); got != 0 {
+				t.Errorf("$4016 = %#02x, want 0", got)
+			}
+		}
+	}
+
+	// Past the last row nothing is pressed
+	k.Write(0x04)
+	if got := k.Read(1); got != 0x1E {
+		t.Errorf("past the last row = %#02x, want 0x1E", got)
+	}
+
+	// Disabled, the keyboard doesn't drive the lines
+	k.Write(0x01)
+	if got := k.Read(1); got != 0 {
+		t.Errorf("disabled = %#02x, want 0", got)
+	}
+}
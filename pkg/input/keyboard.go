@@ -0,0 +1,110 @@
+// Package input implements the devices plugged into the NES controller ports
+package input
+
+// keyboardRows is the number of rows of the Family BASIC keyboard matrix
+const keyboardRows = 9
+
+// keyboardMatrix names the keys of each row and column, D1 to D4
+var keyboardMatrix = [keyboardRows][2][4]string{
+	{{"]", "[", "Return", "F8"}, {"Stop", "Yen", "RShift", "Kana"}},
+	{{";", ":", "@", "F7"}, {"^", "-", "/", "_"}},
+	{{"K", "L", "O", "F6"}, {"0", "P", ",", "."}},
+	{{"J", "U", "I", "F5"}, {"8", "9", "N", "M"}},
+	{{"H", "G", "Y", "F4"}, {"6", "7", "V", "B"}},
+	{{"D", "R", "T", "F3"}, {"4", "5", "C", "F"}},
+	{{"A", "S", "W", "F2"}, {"3", "E", "Z", "X"}},
+	{{"Ctrl", "Q", "Esc", "F1"}, {"2", "1", "Grph", "LShift"}},
+	{{"Left", "Right", "Up", "ClrHome"}, {"Ins", "Del", "Space", "Down"}},
+}
+
+// keyboardKey is the position of a key in the matrix
+type keyboardKey struct {
+	row, column int
+	bit         uint8
+}
+
+// keyboardKeys finds the position of each key by name
+var keyboardKeys = map[string]keyboardKey{}
+
+func init() {
+	for row, columns := range keyboardMatrix {
+		for column, keys := range columns {
+			for bit, name := range keys {
+				keyboardKeys[name] = keyboardKey{row, column, 1 << bit}
+			}
+		}
+	}
+}
+
+// FamilyKeyboard is the Family BASIC keyboard on the Famicom expansion port
+// Writes to $4016 select a row and column of the matrix, and $4017 returns
+// the 4 keys there on D1-D4, 0 for pressed
+type FamilyKeyboard struct {
+	pressed [keyboardRows][2]uint8
+
+	enabled bool
+	row     int
+	column  int
+}
+
+// NewFamilyKeyboard creates a keyboard with no keys pressed
+func NewFamilyKeyboard() *FamilyKeyboard {
+	return &FamilyKeyboard{}
+}
+
+// FamilyKeyboardKeys returns the names of all the keys, as used by SetKey
+func FamilyKeyboardKeys() []string {
+	var names []string
+	for _, columns := range keyboardMatrix {
+		for _, keys := range columns {
+			names = append(names, keys[:]...)
+		}
+	}
+	return names
+}
+
+// SetKey presses or releases a key by its name in the matrix, e.g. "A" or "Return"
+// It reports false for unknown names
+func (k *FamilyKeyboard) SetKey(name string, pressed bool) bool {
+	key, ok := keyboardKeys[name]
+	if !ok {
+		return false
+	}
+	if pressed {
+		k.pressed[key.row][key.column] |= key.bit
+	} else {
+		k.pressed[key.row][key.column] &^= key.bit
+	}
+	return true
+}
+
+// ReleaseAll releases every key
+func (k *FamilyKeyboard) ReleaseAll() {
+	k.pressed = [keyboardRows][2]uint8{}
+}
+
+// Write selects the matrix position
+// Bit 0 resets to row 0, bit 1 is the column, and going from column 1
+// back to column 0 moves to the next row. Bit 2 enables the keyboard
+func (k *FamilyKeyboard) Write(value uint8) {
+	column := int(value>>1) & 0x01
+	k.enabled = value&0x04 != 0
+	if value&0x01 != 0 {
+		k.row = 0
+	} else if k.column == 1 && column == 0 {
+		k.row++
+	}
+	k.column = column
+}
+
+// Read returns the keys of the selected position on D1-D4 of $4017
+// Past the last row no keys are pressed, which is how BASIC detects the keyboard
+func (k *FamilyKeyboard) Read(port int) uint8 {
+	if port == 0 || !k.enabled {
+		return 0
+	}
+	if k.row >= keyboardRows {
+		return 0x1E
+	}
+	return (^k.pressed[k.row][k.column] & 0x0F) << 1
+}
@@ -0,0 +1,76 @@
+// Package input implements the devices plugged into the NES controller ports
+package input
+
+// PowerPadButtons is the number of buttons on the Power Pad mat
+const PowerPadButtons = 12
+
+// powerPadOrder are the buttons shifted out on D3 and D4, 1-based
+var powerPadOrder = [2][8]int{
+	{2, 1, 5, 9, 6, 10, 11, 7},
+	{4, 3, 12, 8},
+}
+
+// PowerPad is the Power Pad (Family Trainer) exercise mat on port 2
+// Its 12 buttons are shifted out 8 on D3 and 4 on D4, then both lines read 1
+type PowerPad struct {
+	buttons uint16 // Bit n-1 is button n
+	strobe  bool
+	shift   [2]uint8
+}
+
+// NewPowerPad creates a Power Pad with no buttons pressed
+func NewPowerPad() *PowerPad {
+	return &PowerPad{}
+}
+
+// SetButton presses or releases a 1-based button
+func (p *PowerPad) SetButton(button int, pressed bool) {
+	if button < 1 || button > PowerPadButtons {
+		return
+	}
+	if pressed {
+		p.buttons |= 1 << (button - 1)
+	} else {
+		p.buttons &^= 1 << (button - 1)
+	}
+}
+
+// SetButtons replaces the state of all the buttons, bit n-1 is button n
+func (p *PowerPad) SetButtons(buttons uint16) {
+	p.buttons = buttons
+}
+
+// latch returns the bits of each data line, the unused ones read 1
+func (p *PowerPad) latch() [2]uint8 {
+	latched := [2]uint8{0xFF, 0xFF}
+	for line, order := range powerPadOrder {
+		for i, button := range order {
+			if button == 0 {
+				continue
+			}
+			if p.buttons&(1<<(button-1)) == 0 {
+				latched[line] &^= 1 << i
+			}
+		}
+	}
+	return latched
+}
+
+// Write latches the buttons, bit 0 is the strobe
+func (p *PowerPad) Write(value uint8) {
+	p.strobe = value&0x01 != 0
+	if p.strobe {
+		p.shift = p.latch()
+	}
+}
+
+// Read returns the next bits on D3 and D4
+func (p *PowerPad) Read() uint8 {
+	if p.strobe {
+		p.shift = p.latch()
+	}
+	value := (p.shift[0]&0x01)<<3 | (p.shift[1]&0x01)<<4
+	p.shift[0] = p.shift[0]>>1 | 0x80
+	p.shift[1] = p.shift[1]>>1 | 0x80
+	return value
+}
@@ -0,0 +1,66 @@
+// Package input implements the devices plugged into the NES controller ports
+package input
+
+import (
+	"fmt"
+
+	"github.com/example/my-golang-project/pkg/savestate"
+)
+
+// Serialize saves or loads the buttons and the shift register
+func (c *Controller) Serialize(s *savestate.Serializer) {
+	s.Section("CTRL")
+	s.Uint8(&c.buttons)
+	s.Bool(&c.strobe)
+	s.Uint8(&c.shift)
+}
+
+// Serialize saves or loads the shift registers of both ports
+// The controllers are saved on their own
+func (f *FourScore) Serialize(s *savestate.Serializer) {
+	s.Section("4SCR")
+	for i := range f.ports {
+		s.Bool(&f.ports[i].strobe)
+		s.Uint32(&f.ports[i].shift)
+	}
+}
+
+// Serialize saves or loads the aim point and trigger
+func (z *Zapper) Serialize(s *savestate.Serializer) {
+	s.Section("ZAPP")
+	s.Int(&z.X)
+	s.Int(&z.Y)
+	s.Bool(&z.Trigger)
+}
+
+// Serialize saves or loads the knob, button and shift register
+func (v *Vaus) Serialize(s *savestate.Serializer) {
+	s.Section("VAUS")
+	s.Uint8(&v.Position)
+	s.Bool(&v.Button)
+	s.Bool(&v.famicom)
+	s.Bool(&v.strobe)
+	s.Uint8(&v.shift)
+}
+
+// Serialize saves or loads the buttons and shift registers
+func (p *PowerPad) Serialize(s *savestate.Serializer) {
+	s.Section("PPAD")
+	s.Uint16(&p.buttons)
+	s.Bool(&p.strobe)
+	s.Bytes(p.shift[:])
+}
+
+// Serialize saves or loads the held keys and the scanned row and column
+func (k *FamilyKeyboard) Serialize(s *savestate.Serializer) {
+	s.Section("KBRD")
+	for i := range k.pressed {
+		s.Bytes(k.pressed[i][:])
+	}
+	s.Bool(&k.enabled)
+	s.Int(&k.row)
+	s.Int(&k.column)
+	if k.row < 0 || k.column < 0 || k.column > 1 {
+		s.Fail(fmt.Errorf("invalid keyboard scan position %d/%d", k.row, k.column))
+	}
+}
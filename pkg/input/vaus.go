@@ -0,0 +1,83 @@
+// Package input implements the devices plugged into the NES controller ports
+package input
+
+// Range of the Vaus potentiometer reading, from fully left to fully right
+const (
+	vausMinimum = 0x62
+	vausMaximum = 0xF2
+)
+
+// Vaus is the Arkanoid paddle controller: a knob read as an 8-bit value,
+// shifted out MSB first and inverted, and a fire button
+// The NES version plugs into port 2 and uses D3 and D4; the Famicom version
+// plugs into the expansion port and uses D1 of $4016 and $4017
+type Vaus struct {
+	Position uint8 // Knob position, 0 fully left to 255 fully right
+	Button   bool
+
+	famicom bool
+	strobe  bool
+	shift   uint8
+}
+
+// NewVaus creates the NES Vaus controller
+func NewVaus() *Vaus {
+	return &Vaus{Position: 0x80}
+}
+
+// NewFamicomVaus creates the Famicom Vaus controller for the expansion port
+func NewFamicomVaus() *Vaus {
+	return &Vaus{Position: 0x80, famicom: true}
+}
+
+// potentiometer returns the knob reading
+func (v *Vaus) potentiometer() uint8 {
+	return uint8(vausMinimum + int(v.Position)*(vausMaximum-vausMinimum)/255)
+}
+
+// Write latches the knob reading, bit 0 is the strobe
+func (v *Vaus) Write(value uint8) {
+	v.strobe = value&0x01 != 0
+	if v.strobe {
+		v.shift = ^v.potentiometer()
+	}
+}
+
+// nextBit returns the next bit of the reading
+func (v *Vaus) nextBit() uint8 {
+	bit := v.shift >> 7
+	if !v.strobe {
+		v.shift <<= 1
+	}
+	return bit
+}
+
+// Read returns the reading on D3 and the button on D4, for port 2
+func (v *Vaus) Read() uint8 {
+	value := v.nextBit() << 3
+	if v.Button {
+		value |= 0x10
+	}
+	return value
+}
+
+// ExpansionPort returns the device to plug into the Famicom expansion port
+func (v *Vaus) ExpansionPort() ExpansionDevice {
+	return vausExpansion{v}
+}
+
+// vausExpansion is the Famicom Vaus as seen from the expansion port
+type vausExpansion struct {
+	*Vaus
+}
+
+// Read returns the button on D1 of $4016 and the reading on D1 of $4017
+func (v vausExpansion) Read(port int) uint8 {
+	if port == 0 {
+		if v.Button {
+			return 0x02
+		}
+		return 0
+	}
+	return v.nextBit() << 1
+}
@@ -0,0 +1,101 @@
+// Package input implements the devices plugged into the NES controller ports
+package input
+
+const (
+	// zapperLightBit is clear while the Zapper sees light
+	zapperLightBit = 0x08
+
+	// zapperTriggerBit is set while the trigger is pulled
+	zapperTriggerBit = 0x10
+
+	// zapperRadius is how far around the aim point the photodiode sees, in pixels
+	zapperRadius = 2
+
+	// zapperPersistence is how many scanlines a lit pixel keeps the photodiode
+	// on after the beam has drawn it
+	zapperPersistence = 20
+
+	// zapperBrightness is the average RGB level that counts as light
+	zapperBrightness = 0x55
+
+	zapperFrameWidth  = 256
+	zapperFrameHeight = 240
+)
+
+// Zapper is the NES light gun
+// It reads light from the pixels around where it is aimed as the beam draws
+// them, so games see the target flash on the scanlines they are checking
+type Zapper struct {
+	X, Y    int  // Aim point in frame pixels, negative when off screen
+	Trigger bool // Trigger pulled
+
+	// Reference to the PPU for the frame being drawn
+	Screen interface {
+		RenderingFrame() []uint8
+		RenderPosition() (scanline, dot int)
+	}
+}
+
+// NewZapper creates a Zapper aimed off screen
+func NewZapper() *Zapper {
+	return &Zapper{X: -1, Y: -1}
+}
+
+// SetScreen sets the PPU interface the light is read from
+func (z *Zapper) SetScreen(screen interface {
+	RenderingFrame() []uint8
+	RenderPosition() (scanline, dot int)
+}) {
+	z.Screen = screen
+}
+
+// Aim points the Zapper at a pixel of the frame, or off screen if it is outside
+func (z *Zapper) Aim(x, y int) {
+	if x < 0 || x >= zapperFrameWidth || y < 0 || y >= zapperFrameHeight {
+		x, y = -1, -1
+	}
+	z.X, z.Y = x, y
+}
+
+// Write does nothing, the Zapper has no strobe
+func (z *Zapper) Write(value uint8) {}
+
+// Read returns the light sense on D3 and the trigger on D4
+func (z *Zapper) Read() uint8 {
+	var value uint8
+	if !z.senseLight() {
+		value |= zapperLightBit
+	}
+	if z.Trigger {
+		value |= zapperTriggerBit
+	}
+	return value
+}
+
+// senseLight reports whether a bright pixel near the aim point was drawn recently
+func (z *Zapper) senseLight() bool {
+	if z.Screen == nil || z.X < 0 || z.Y < 0 {
+		return false
+	}
+
+	pixels := z.Screen.RenderingFrame()
+	scanline, dot := z.Screen.RenderPosition()
+
+	for y := z.Y - zapperRadius; y <= z.Y+zapperRadius; y++ {
+		// Only rows the beam has drawn within the persistence of the photodiode
+		if y < 0 || y >= zapperFrameHeight || y > scanline || scanline-y > zapperPersistence {
+			continue
+		}
+		for x := z.X - zapperRadius; x <= z.X+zapperRadius; x++ {
+			if x < 0 || x >= zapperFrameWidth || (y == scanline && x >= dot-1) {
+				continue
+			}
+			offset := (y*zapperFrameWidth + x) * 4
+			level := (int(pixels[offset]) + int(pixels[offset+1]) + int(pixels[offset+2])) / 3
+			if level >= zapperBrightness {
+				return true
+			}
+		}
+	}
+	return false
+}
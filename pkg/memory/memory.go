@@ -1,7 +1,11 @@
 // Package memory implements the NES memory system
 package memory
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/example/my-golang-project/pkg/input"
+)
 
 const (
 	// RAMSize represents the size of the NES's internal RAM in bytes
@@ -29,6 +33,36 @@ const (
 
 	ROMCartridgeMemorySize   = 0x8000
 	ROMCartridgeStartAddress = RAMCartridgeStartAddress + RAMCartridgeMemorySize
+
+	// APUChannelsEndAddress is the last register of the five sound channels
+	APUChannelsEndAddress = 0x4013
+
+	// APUStatusAddress is the only readable APU register
+	APUStatusAddress = 0x4015
+
+	// APUFrameCounterAddress is the frame counter register, sharing its address
+	// with the second controller port, which is read-only
+	APUFrameCounterAddress = 0x4017
+
+	// ControllerPort1Address strobes both ports on writes and reads port 1
+	ControllerPort1Address = 0x4016
+
+	// ControllerPort2Address reads port 2, writes go to the APU frame counter
+	ControllerPort2Address = 0x4017
+
+	// controllerDataMask are the data lines the controller ports drive,
+	// the upper bits of a read are open bus
+	controllerDataMask = 0x1F
+
+	// OAMDMAAddress is the register that starts a sprite DMA transfer
+	OAMDMAAddress = 0x4014
+
+	// OAMDATAAddress is the PPU register the DMA unit writes into
+	OAMDATAAddress = 0x2004
+
+	// OAMDMACycles is the number of cycles the CPU is halted during a DMA
+	// transfer, one extra alignment cycle is added when it starts on an odd cycle
+	OAMDMACycles = 513
 )
 
 // Memory represents the memory system of the NES
@@ -51,11 +85,38 @@ type Memory struct {
 	// Cartridge space: PRG ROM, PRG RAM, and mapper registers
 	ROMCartridgeSpace [ROMCartridgeMemorySize]byte
 	
+	// Last value seen on the CPU data bus, returned by unmapped reads
+	openBus byte
+
 	// Reference to PPU for register access
 	PPU interface {
 		ReadRegister(address uint16) uint8
 		WriteRegister(address uint16, value uint8)
 	}
+
+	// Reference to APU for sound register access
+	APU interface {
+		ReadRegister(address uint16) uint8
+		WriteRegister(address uint16, value uint8)
+	}
+
+	// Devices plugged into the two controller ports, nil when empty
+	Ports [2]input.InputDevice
+
+	// Device on the Famicom expansion port, nil when empty
+	Expansion input.ExpansionDevice
+
+	// Reference to cartridge hardware that decodes $4020-$FFFF itself
+	// ReadPRG returns false when nothing drives the bus at that address
+	Mapper interface {
+		ReadPRG(address uint16) (byte, bool)
+		WritePRG(address uint16, value byte)
+	}
+
+	// Reference to CPU for DMA stalls
+	CPU interface {
+		StallDMA(cycles uint16)
+	}
 }
 
 // New creates a new Memory instance
@@ -80,6 +141,40 @@ func (m *Memory) SetPPU(ppu interface {
 	m.PPU = ppu
 }
 
+// SetAPU sets the APU interface for sound register access
+func (m *Memory) SetAPU(apu interface {
+	ReadRegister(address uint16) uint8
+	WriteRegister(address uint16, value uint8)
+}) {
+	m.APU = apu
+}
+
+// SetInputDevice plugs a device into controller port 0 or 1, nil unplugs it
+func (m *Memory) SetInputDevice(port int, device input.InputDevice) {
+	m.Ports[port] = device
+}
+
+// SetExpansionDevice plugs a device into the Famicom expansion port, nil unplugs it
+func (m *Memory) SetExpansionDevice(device input.ExpansionDevice) {
+	m.Expansion = device
+}
+
+// SetMapper sets the cartridge hardware for $4020-$FFFF, nil restores the
+// flat PRG RAM and ROM arrays
+func (m *Memory) SetMapper(mapper interface {
+	ReadPRG(address uint16) (byte, bool)
+	WritePRG(address uint16, value byte)
+}) {
+	m.Mapper = mapper
+}
+
+// SetCPU sets the CPU interface used to halt the processor during DMA
+func (m *Memory) SetCPU(cpu interface {
+	StallDMA(cycles uint16)
+}) {
+	m.CPU = cpu
+}
+
 // Reset initializes the memory to its power-on state
 func (m *Memory) Reset() {
 	// Clear RAM
@@ -97,11 +192,21 @@ func (m *Memory) Reset() {
 		m.APUAndIORegisters[i] = 0
 	}
 
+	m.openBus = 0
+
 	// We don't clear CartridgeSpace as it should be loaded from ROM
 }
 
 // Read returns a byte from the specified memory address
+// The value read is left on the data bus, unmapped addresses return what was there
 func (m *Memory) Read(address uint16) byte {
+	value := m.read(address)
+	m.openBus = value
+	return value
+}
+
+// read decodes a CPU read without touching the data bus
+func (m *Memory) read(address uint16) byte {
 	switch {
 	case address < PPURegistersStartAddress: // 0x0 - 0x1FFF
 		// Internal RAM, mirrored every 0x0800 bytes
@@ -114,15 +219,43 @@ func (m *Memory) Read(address uint16) byte {
 		}
 		return m.PPURegisters[(address-0x2000)%PPURegistersSize]
 		
-	case address < TestingMemoryStartAddress: // 0x4000 - 0x4017
-		// APU and I/O registers
+	case address < APUStatusAddress: // 0x4000 - 0x4014
+		// Write-only APU registers and OAM DMA
+		return m.openBus
+		
+	case address == APUStatusAddress: // 0x4015
+		// APU status, bit 5 is not driven
+		if m.APU != nil {
+			return m.APU.ReadRegister(address) | m.openBus&0x20
+		}
 		return m.APUAndIORegisters[address-0x4000]
+
+	case address < TestingMemoryStartAddress: // 0x4016 - 0x4017
+		// Controller ports, an empty port leaves the data lines low
+		value := m.openBus &^ controllerDataMask
+		port := int(address - ControllerPort1Address)
+		if device := m.Ports[port]; device != nil {
+			value |= device.Read() & controllerDataMask
+		}
+		if m.Expansion != nil {
+			value |= m.Expansion.Read(port) & controllerDataMask
+		}
+		return value
 		
 	case address < UnmappedCartridgeStartAddress: // 0x4018 - 0x401F
-		panic("testing memory space")
+		// APU test registers, disabled on retail consoles
+		return m.openBus
 		
-	case address < RAMCartridgeStartAddress: // 0x4020 - 0x6000
-		return m.RAMCartridgeSpace[address-0x4020]
+	case m.Mapper != nil: // 0x4020 - 0xFFFF
+		// Cartridge hardware
+		if value, ok := m.Mapper.ReadPRG(address); ok {
+			return value
+		}
+		return m.openBus
+
+	case address < RAMCartridgeStartAddress: // 0x4020 - 0x5FFF
+		// Expansion area, nothing answers without a mapper
+		return m.openBus
 		
 	case address < ROMCartridgeStartAddress: // 0x6000 - 0x7FFF
 		return m.RAMCartridgeSpace[address-0x6000]
@@ -138,6 +271,9 @@ func (m *Memory) Read(address uint16) byte {
 
 // Write writes a byte to the specified memory address
 func (m *Memory) Write(address uint16, value byte) {
+	// The CPU drives the data bus during writes
+	m.openBus = value
+
 	switch {
 	case address < PPURegistersStartAddress: // 0x0 - 0x1FFF
 		// Internal RAM, mirrored every 0x0800 bytes
@@ -151,15 +287,39 @@ func (m *Memory) Write(address uint16, value byte) {
 			m.PPURegisters[(address-0x2000)%PPURegistersSize] = value
 		}
 		
+	case address == OAMDMAAddress: // 0x4014
+		// Sprite DMA
+		m.oamDMA(value)
+
+	case address == ControllerPort1Address: // 0x4016
+		// Strobe, seen by the devices on both ports and the expansion port
+		m.APUAndIORegisters[address-0x4000] = value
+		for _, device := range m.Ports {
+			if device != nil {
+				device.Write(value)
+			}
+		}
+		if m.Expansion != nil {
+			m.Expansion.Write(value)
+		}
+
+	case m.APU != nil && (address <= APUChannelsEndAddress || address == APUStatusAddress || address == APUFrameCounterAddress):
+		// Sound channels, APU status and frame counter
+		m.APU.WriteRegister(address, value)
+
 	case address < TestingMemoryStartAddress: // 0x4000 - 0x4017
 		// APU and I/O registers
 		m.APUAndIORegisters[address-0x4000] = value
 		
 	case address < UnmappedCartridgeStartAddress: // 0x4018 - 0x401F
-		panic("testing memory space")
+		// APU test registers, disabled on retail consoles
 		
-	case address < RAMCartridgeStartAddress: // 0x4020 - 0x6000
-		m.RAMCartridgeSpace[address-0x4020] = value
+	case m.Mapper != nil: // 0x4020 - 0xFFFF
+		// Cartridge hardware
+		m.Mapper.WritePRG(address, value)
+
+	case address < RAMCartridgeStartAddress: // 0x4020 - 0x5FFF
+		// Expansion area, nothing answers without a mapper
 		
 	case address < ROMCartridgeStartAddress: // 0x6000 - 0x7FFF
 		m.RAMCartridgeSpace[address-0x6000] = value
@@ -173,6 +333,23 @@ func (m *Memory) Write(address uint16, value byte) {
 	}
 }
 
+// oamDMA copies the 256 bytes of page $XX00 into the PPU's OAM
+// The bytes go through OAMDATA so they land starting at the current OAMADDR
+func (m *Memory) oamDMA(page byte) {
+	base := uint16(page) << 8
+	for i := uint16(0); i < 256; i++ {
+		value := m.Read(base + i)
+		if m.PPU != nil {
+			m.PPU.WriteRegister(OAMDATAAddress, value)
+		}
+	}
+
+	// The CPU is halted while the transfer happens
+	if m.CPU != nil {
+		m.CPU.StallDMA(OAMDMACycles)
+	}
+}
+
 // LoadPRGROM loads the program ROM into memory
 func (m *Memory) LoadPRGROM(prgROM []byte) {
 	// Copy PRG ROM data into the appropriate location in cartridge space
@@ -0,0 +1,69 @@
+package memory
+
+import "testing"
+
+// testAPU answers $4015 with every driven bit set
+type testAPU struct{}
+
+func (testAPU) ReadRegister(address uint16) uint8 {
+	return 0xDF
+}
+
+func (testAPU) WriteRegister(address uint16, value uint8) {}
+
+// testMapper drives the bus only at $8000-$FFFF
+type testMapper struct{}
+
+func (testMapper) ReadPRG(address uint16) (byte, bool) {
+	if address < 0x8000 {
+		return 0, false
+	}
+	return 0x60, true
+}
+
+func (testMapper) WritePRG(address uint16, value byte) {}
+
+func TestOpenBus(t *testing.T) {
+	tests := []struct {
+		name    string
+		address uint16
+		mapper  bool
+		bus     uint8 // Value left on the bus before the read
+		want    uint8
+	}{
+		{"write-only APU register", 0x4000, false, 0x5A, 0x5A},
+		{"OAM DMA", 0x4014, false, 0xA5, 0xA5},
+		{"APU status bit 5", APUStatusAddress, false, 0x20, 0xFF},
+		{"APU status without bit 5", APUStatusAddress, false, 0xC0, 0xDF},
+		{"empty controller port", ControllerPort1Address, false, 0xFF, 0xE0},
+		{"APU test registers", 0x4018, false, 0x3C, 0x3C},
+		{"end of the test registers", 0x401F, false, 0xC3, 0xC3},
+		{"expansion area", 0x4020, false, 0x42, 0x42},
+		{"end of the expansion area", 0x5FFF, false, 0x24, 0x24},
+		{"expansion area with a mapper", 0x5000, true, 0x81, 0x81},
+		{"mapper driving the bus", 0x8000, true, 0x81, 0x60},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := New()
+			m.SetAPU(testAPU{})
+			if tt.mapper {
+				m.SetMapper(testMapper{})
+			}
+			m.RAM[0] = tt.bus
+			m.Read(0x0000)
+
+			if got := m.Read(tt.address); got != tt.want {
+				t.Errorf("Read(%#04x) = %#02x, want %#02x", tt.address, got, tt.want)
+			}
+		})
+	}
+
+	// Writes leave their value on the bus too
+	m := New()
+	m.Write(0x0000, 0x99)
+	if got := m.Read(0x4018); got != 0x99 {
+		t.Errorf("Read($4018) after writing 0x99 = %#02x, want 0x99", got)
+	}
+}
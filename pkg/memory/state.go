@@ -0,0 +1,23 @@
+// Package memory implements the NES memory system
+package memory
+
+import "github.com/example/my-golang-project/pkg/savestate"
+
+// Serialize saves or loads the internal RAM, the register mirrors, the
+// expansion area, PRG RAM and the data bus
+// PRG ROM is not included, it comes from the cartridge; cartridge hardware
+// that implements Serialize saves its own state
+func (m *Memory) Serialize(s *savestate.Serializer) {
+	s.Section("MEM ")
+	s.Bytes(m.RAM[:])
+	s.Bytes(m.PPURegisters[:])
+	s.Bytes(m.APUAndIORegisters[:])
+	s.Bytes(m.UnmappedCartridgeSpace[:])
+	s.Bytes(m.RAMCartridgeSpace[:])
+	s.Uint8(&m.openBus)
+
+	s.Section("MAPR")
+	if mapper, ok := m.Mapper.(interface{ Serialize(s *savestate.Serializer) }); ok {
+		mapper.Serialize(s)
+	}
+}
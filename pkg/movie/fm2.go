@@ -0,0 +1,287 @@
+// Package movie implements recording and playback of controller input movies
+// in FCEUX's FM2 text format
+package movie
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Frame commands, the first field of an input log line
+const (
+	CommandReset     uint8 = 1 << iota // Soft reset
+	CommandPower                       // Power cycle
+	CommandFDSInsert                   // Famicom Disk System: insert or eject disk
+	CommandFDSSelect                   // Famicom Disk System: select side
+	CommandVSCoin                      // VS. System: insert coin
+)
+
+// Port device types of the port0, port1 and port2 header keys
+const (
+	PortNone    = 0
+	PortGamepad = 1
+	PortZapper  = 2
+)
+
+// gamepadButtons are the characters of a gamepad field, from bit 7 to bit 0
+const gamepadButtons = "RLDUTSBA"
+
+// fm2Version is the only version of the format
+const fm2Version = 3
+
+// Frame is the input of one frame
+type Frame struct {
+	Commands uint8
+	Buttons  [4]uint8 // Players 1 to 4 in the bit order of input.Button
+}
+
+// Movie is an input recording with its FM2 header
+type Movie struct {
+	EmuVersion    int
+	RerecordCount int
+	PAL           bool
+	ROMFilename   string
+	ROMChecksum   []byte // MD5 of the ROM, without the iNES header
+	GUID          string
+	FourScore     bool
+	Ports         [3]int // Devices on ports 1, 2 and the expansion port
+	Comments      []string
+	Subtitles     []string
+
+	// Save state the movie starts from, empty to start from power-on
+	SaveState []byte
+
+	Frames []Frame
+}
+
+// New creates an empty movie starting from power-on with two gamepads
+func New() *Movie {
+	return &Movie{Ports: [3]int{PortGamepad, PortGamepad, PortNone}}
+}
+
+// LoadFile reads an .fm2 file
+func LoadFile(path string) (*Movie, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Read(file)
+}
+
+// SaveFile writes the movie to an .fm2 file
+func (m *Movie) SaveFile(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := m.Write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Read parses an FM2 movie
+// Binary input logs and Zapper ports are not supported
+func Read(r io.Reader) (*Movie, error) {
+	m := New()
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024) // Save states can make long lines
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if text == "" {
+			continue
+		}
+
+		if text[0] == '|' {
+			frame, err := m.parseFrame(text)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			m.Frames = append(m.Frames, frame)
+			continue
+		}
+
+		key, value, _ := strings.Cut(text, " ")
+		if err := m.parseHeader(key, value); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// parseHeader stores one header key
+func (m *Movie) parseHeader(key, value string) error {
+	var err error
+	switch key {
+	case "version":
+		var version int
+		version, err = strconv.Atoi(value)
+		if err == nil && version != fm2Version {
+			return fmt.Errorf("unsupported FM2 version %d", version)
+		}
+	case "emuVersion":
+		m.EmuVersion, err = strconv.Atoi(value)
+	case "rerecordCount":
+		m.RerecordCount, err = strconv.Atoi(value)
+	case "palFlag":
+		m.PAL = value == "1"
+	case "romFilename":
+		m.ROMFilename = value
+	case "romChecksum":
+		m.ROMChecksum, err = decodeBinary(value)
+	case "guid":
+		m.GUID = value
+	case "fourscore":
+		m.FourScore = value == "1"
+	case "port0", "port1", "port2":
+		port := int(key[4] - '0')
+		m.Ports[port], err = strconv.Atoi(value)
+		if err == nil && port < 2 && m.Ports[port] == PortZapper {
+			return errors.New("Zapper movies are not supported")
+		}
+	case "comment":
+		m.Comments = append(m.Comments, value)
+	case "subtitle":
+		m.Subtitles = append(m.Subtitles, value)
+	case "binary":
+		if value == "1" {
+			return errors.New("binary FM2 input logs are not supported")
+		}
+	case "savestate":
+		m.SaveState, err = decodeBinary(value)
+	}
+	// Unknown keys, like FDS or NewPPU, don't change how the input plays
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return nil
+}
+
+// parseFrame parses an input log line: |commands|port0|port1|port2|
+// With the Four Score the four gamepads come before the expansion port
+func (m *Movie) parseFrame(text string) (Frame, error) {
+	var frame Frame
+	fields := strings.Split(strings.Trim(text, "|"), "|")
+	if len(fields) == 0 {
+		return frame, errors.New("empty input line")
+	}
+
+	commands, err := strconv.Atoi(strings.TrimSpace(fields[0]))
+	if err != nil {
+		return frame, fmt.Errorf("invalid commands %q", fields[0])
+	}
+	frame.Commands = uint8(commands)
+
+	players := 2
+	if m.FourScore {
+		players = 4
+	}
+	for i := 0; i < players && i+1 < len(fields); i++ {
+		if !m.FourScore && m.Ports[i] != PortGamepad {
+			continue
+		}
+		frame.Buttons[i] = parseGamepad(fields[i+1])
+	}
+	return frame, nil
+}
+
+// parseGamepad decodes a gamepad field, any character but '.' or ' ' is pressed
+func parseGamepad(field string) uint8 {
+	var buttons uint8
+	for i := 0; i < len(field) && i < len(gamepadButtons); i++ {
+		if field[i] != '.' && field[i] != ' ' {
+			buttons |= 0x80 >> i
+		}
+	}
+	return buttons
+}
+
+// formatGamepad encodes a gamepad field
+func formatGamepad(buttons uint8) string {
+	var field [8]byte
+	for i := range field {
+		field[i] = '.'
+		if buttons&(0x80>>i) != 0 {
+			field[i] = gamepadButtons[i]
+		}
+	}
+	return string(field[:])
+}
+
+// Write writes the movie in FM2 text format
+func (m *Movie) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "version %d\n", fm2Version)
+	fmt.Fprintf(bw, "emuVersion %d\n", m.EmuVersion)
+	fmt.Fprintf(bw, "rerecordCount %d\n", m.RerecordCount)
+	fmt.Fprintf(bw, "palFlag %d\n", boolDigit(m.PAL))
+	fmt.Fprintf(bw, "romFilename %s\n", m.ROMFilename)
+	fmt.Fprintf(bw, "romChecksum base64:%s\n", base64.StdEncoding.EncodeToString(m.ROMChecksum))
+	fmt.Fprintf(bw, "guid %s\n", m.GUID)
+	fmt.Fprintf(bw, "fourscore %d\n", boolDigit(m.FourScore))
+	fmt.Fprintf(bw, "microphone 0\n")
+	for i, port := range m.Ports {
+		fmt.Fprintf(bw, "port%d %d\n", i, port)
+	}
+	fmt.Fprintf(bw, "FDS 0\n")
+	fmt.Fprintf(bw, "NewPPU 0\n")
+	for _, comment := range m.Comments {
+		fmt.Fprintf(bw, "comment %s\n", comment)
+	}
+	for _, subtitle := range m.Subtitles {
+		fmt.Fprintf(bw, "subtitle %s\n", subtitle)
+	}
+	if len(m.SaveState) > 0 {
+		fmt.Fprintf(bw, "savestate base64:%s\n", base64.StdEncoding.EncodeToString(m.SaveState))
+	}
+
+	for _, frame := range m.Frames {
+		fmt.Fprintf(bw, "|%d|", frame.Commands)
+		if m.FourScore {
+			for _, buttons := range frame.Buttons {
+				fmt.Fprintf(bw, "%s|", formatGamepad(buttons))
+			}
+		} else {
+			for i := 0; i < 2; i++ {
+				if m.Ports[i] == PortGamepad {
+					bw.WriteString(formatGamepad(frame.Buttons[i]))
+				}
+				bw.WriteString("|")
+			}
+		}
+		bw.WriteString("|\n")
+	}
+	return bw.Flush()
+}
+
+// decodeBinary decodes a binary header value, "base64:" prefixed or hex
+func decodeBinary(value string) ([]byte, error) {
+	if data, ok := strings.CutPrefix(value, "base64:"); ok {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	return hex.DecodeString(strings.TrimPrefix(value, "0x"))
+}
+
+// boolDigit formats a flag as 0 or 1
+func boolDigit(flag bool) int {
+	if flag {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,149 @@
+package movie
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    *Movie
+		wantErr string
+	}{
+		{
+			name: "two gamepads",
+			text: "version 3\nemuVersion 22020\nrerecordCount 7\npalFlag 0\n" +
+				"romFilename game\nromChecksum base64:AAECAw==\nguid 1234\n" +
+				"fourscore 0\nport0 1\nport1 1\nport2 0\nFDS 0\ncomment author me\n" +
+				"|0|RLDUTSBA|........|\n|1|.......A|R.......||\n",
+			want: &Movie{
+				EmuVersion:    22020,
+				RerecordCount: 7,
+				ROMFilename:   "game",
+				ROMChecksum:   []byte{0, 1, 2, 3},
+				GUID:          "1234",
+				Ports:         [3]int{PortGamepad, PortGamepad, PortNone},
+				Comments:      []string{"author me"},
+				Frames: []Frame{
+					{Buttons: [4]uint8{0xFF, 0}},
+					{Commands: CommandReset, Buttons: [4]uint8{0x01, 0x80}},
+				},
+			},
+		},
+		{
+			name: "four score",
+			text: "version 3\nfourscore 1\npalFlag 1\nsavestate 0x0a0b\n" +
+				"|0|A.......|.L......|..D.....|...U....||\n",
+			want: &Movie{
+				PAL:       true,
+				FourScore: true,
+				Ports:     [3]int{PortGamepad, PortGamepad, PortNone},
+				SaveState: []byte{0x0A, 0x0B},
+				Frames:    []Frame{{Buttons: [4]uint8{0x80, 0x40, 0x20, 0x10}}},
+			},
+		},
+		{
+			name: "empty port",
+			text: "version 3\r\nport1 0\r\n\r\n|2|...UT...|RLDUTSBA||\r\n",
+			want: &Movie{
+				Ports:  [3]int{PortGamepad, PortNone, PortNone},
+				Frames: []Frame{{Commands: CommandPower, Buttons: [4]uint8{0x18, 0}}},
+			},
+		},
+		{name: "unsupported version", text: "version 2\n", wantErr: "line 1: unsupported FM2 version 2"},
+		{name: "zapper", text: "version 3\nport1 2\n", wantErr: "line 2: Zapper"},
+		{name: "binary log", text: "binary 1\n", wantErr: "binary FM2"},
+		{name: "invalid number", text: "rerecordCount many\n", wantErr: "invalid rerecordCount"},
+		{name: "invalid checksum", text: "romChecksum base64:!!\n", wantErr: "invalid romChecksum"},
+		{name: "invalid commands", text: "version 3\n|x|........|........||\n", wantErr: "line 2: invalid commands"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Read(strings.NewReader(tt.text))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Read() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Read() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	tests := []struct {
+		name  string
+		movie *Movie
+	}{
+		{
+			name: "two gamepads",
+			movie: &Movie{
+				EmuVersion:  1,
+				ROMFilename: "game",
+				ROMChecksum: []byte{0xDE, 0xAD, 0xBE, 0xEF},
+				GUID:        "guid",
+				Ports:       [3]int{PortGamepad, PortGamepad, PortNone},
+				Comments:    []string{"first", "second"},
+				Subtitles:   []string{"10 hello"},
+				SaveState:   []byte("NESSTATE"),
+				Frames: []Frame{
+					{Buttons: [4]uint8{0x81, 0x42}},
+					{Commands: CommandReset},
+				},
+			},
+		},
+		{
+			name: "four score on PAL",
+			movie: &Movie{
+				PAL:         true,
+				FourScore:   true,
+				ROMChecksum: []byte{},
+				Ports:       [3]int{PortGamepad, PortGamepad, PortNone},
+				Frames:      []Frame{{Buttons: [4]uint8{1, 2, 4, 8}}},
+			},
+		},
+		{
+			name: "second port empty",
+			movie: &Movie{
+				ROMChecksum: []byte{},
+				Ports:       [3]int{PortGamepad, PortNone, PortNone},
+				Frames:      []Frame{{Buttons: [4]uint8{0x10}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var written bytes.Buffer
+			if err := tt.movie.Write(&written); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+			got, err := Read(bytes.NewReader(written.Bytes()))
+			if err != nil {
+				t.Fatalf("Read() error = %v\n%s", err, written.String())
+			}
+			if !reflect.DeepEqual(got, tt.movie) {
+				t.Errorf("Read(Write()) = %+v, want %+v", got, tt.movie)
+			}
+
+			var rewritten bytes.Buffer
+			if err := got.Write(&rewritten); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+			if !bytes.Equal(written.Bytes(), rewritten.Bytes()) {
+				t.Errorf("second Write() differs:\n%s\nwant:\n%s", rewritten.String(), written.String())
+			}
+		})
+	}
+}
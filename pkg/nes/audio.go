@@ -0,0 +1,194 @@
+// Package nes implements the NES system integration
+package nes
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/example/my-golang-project/pkg/apu"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/audio"
+)
+
+const (
+	// AudioSampleRate is the rate of the audio stream played in the game window
+	AudioSampleRate = 48000
+
+	// audioLatency is how much audio is kept queued ahead of the player
+	audioLatency = 60 * time.Millisecond
+
+	// audioRingSeconds is the capacity of the ring buffer
+	audioRingSeconds = 0.5
+
+	// maxRateAdjustment is how far the APU's output rate may drift from
+	// nominal to keep the queue at the target latency, 0.5%
+	maxRateAdjustment = 0.005
+)
+
+// audioRing is a ring buffer of mono samples shared between the emulation,
+// which writes, and the audio player, which reads from its own goroutine
+type audioRing struct {
+	mu     sync.Mutex
+	buffer []float32
+	read   int
+	count  int
+	last   float32 // Last sample played, held and faded out on underruns
+}
+
+// newAudioRing creates a ring buffer holding capacity samples
+func newAudioRing(capacity int) *audioRing {
+	return &audioRing{buffer: make([]float32, capacity)}
+}
+
+// write queues samples, dropping the oldest ones when the ring is full
+func (r *audioRing) write(samples []float32) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, sample := range samples {
+		if r.count == len(r.buffer) {
+			r.read = (r.read + 1) % len(r.buffer)
+			r.count--
+		}
+		r.buffer[(r.read+r.count)%len(r.buffer)] = sample
+		r.count++
+	}
+}
+
+// buffered returns the number of queued samples
+func (r *audioRing) buffered() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.count
+}
+
+// Read implements io.Reader for the player, as 32-bit float stereo
+// It never blocks: when the emulation falls behind, the last sample is
+// faded to silence instead of leaving the player waiting
+func (r *audioRing) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	frames := len(p) / 8
+	for i := 0; i < frames; i++ {
+		if r.count > 0 {
+			r.last = r.buffer[r.read]
+			r.read = (r.read + 1) % len(r.buffer)
+			r.count--
+		} else {
+			r.last *= 0.995
+		}
+		bits := math.Float32bits(r.last)
+		binary.LittleEndian.PutUint32(p[i*8:], bits)
+		binary.LittleEndian.PutUint32(p[i*8+4:], bits)
+	}
+	return frames * 8, nil
+}
+
+// audioOutput streams the APU's samples to the speakers
+type audioOutput struct {
+	apu     *apu.APU
+	player  *audio.Player
+	ring    *audioRing
+	samples []float32 // Scratch buffer for APU.ReadSamples
+
+	volume float64
+	muted  bool
+}
+
+// newAudioOutput creates the audio context and starts playback
+// Ebiten only allows one audio context per process
+func newAudioOutput(a *apu.APU, volume float64, muted bool) (*audioOutput, error) {
+	a.SetSampleRate(AudioSampleRate)
+
+	context := audio.NewContext(AudioSampleRate)
+	ring := newAudioRing(int(AudioSampleRate * audioRingSeconds))
+	player, err := context.NewPlayerF32(ring)
+	if err != nil {
+		return nil, err
+	}
+	player.SetBufferSize(audioLatency / 2)
+
+	out := &audioOutput{
+		apu:     a,
+		player:  player,
+		ring:    ring,
+		samples: make([]float32, AudioSampleRate/10),
+		volume:  volume,
+		muted:   muted,
+	}
+	out.applyVolume()
+	player.Play()
+	return out, nil
+}
+
+// targetSamples is the queue length that gives the target latency
+func (o *audioOutput) targetSamples() int {
+	return int(audioLatency.Seconds() * AudioSampleRate)
+}
+
+// update moves the samples produced since the last call into the ring
+func (o *audioOutput) update() {
+	for {
+		n := o.apu.ReadSamples(o.samples)
+		if n == 0 {
+			break
+		}
+		o.ring.write(o.samples[:n])
+	}
+}
+
+// adaptRate nudges the APU's output rate so the queue stays near the target
+// latency, making up for the video and audio clocks drifting apart
+func (o *audioOutput) adaptRate() {
+	target := o.targetSamples()
+	err := float64(target-o.ring.buffered()) / float64(target)
+	adjustment := math.Max(-1, math.Min(1, err)) * maxRateAdjustment
+	o.apu.AdjustSampleRate(1 + adjustment)
+}
+
+// needsAudio reports whether the queue is below the target latency,
+// used to pace the emulation by the audio clock
+func (o *audioOutput) needsAudio() bool {
+	return o.ring.buffered() < o.targetSamples()
+}
+
+// setVolume sets the master volume, clamped to 0-1
+func (o *audioOutput) setVolume(volume float64) {
+	o.volume = math.Max(0, math.Min(1, volume))
+	o.applyVolume()
+}
+
+// toggleMute mutes or unmutes the output, keeping the volume
+func (o *audioOutput) toggleMute() {
+	o.muted = !o.muted
+	o.applyVolume()
+}
+
+// applyVolume sends the volume to the player
+func (o *audioOutput) applyVolume() {
+	if o.muted {
+		o.player.SetVolume(0)
+	} else {
+		o.player.SetVolume(o.volume)
+	}
+}
+
+// channelKeys toggle mute on each APU channel, or solo with Shift
+var channelKeys = [apu.ChannelCount]ebiten.Key{
+	ebiten.KeyDigit1, ebiten.KeyDigit2, ebiten.KeyDigit3, ebiten.KeyDigit4, ebiten.KeyDigit5,
+}
+
+// toggleChannel mutes or unmutes an APU channel, or toggles its solo
+func toggleChannel(a *apu.APU, channel apu.Channel, solo bool) {
+	if solo {
+		a.SetChannelSolo(channel, !a.ChannelSoloed(channel))
+		fmt.Printf("%s solo: %v\n", channel, a.ChannelSoloed(channel))
+	} else {
+		a.SetChannelMuted(channel, !a.ChannelMuted(channel))
+		fmt.Printf("%s muted: %v\n", channel, a.ChannelMuted(channel))
+	}
+}
@@ -0,0 +1,233 @@
+// Package nes implements the NES system integration
+package nes
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/example/my-golang-project/pkg/input"
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// stickThreshold is how far the left stick must be pushed to press a direction
+const stickThreshold = 0.5
+
+// gamepadButtonNames maps the names used in bindings files to ebiten's
+// standard gamepad layout
+var gamepadButtonNames = map[string]ebiten.StandardGamepadButton{
+	"RightBottom":      ebiten.StandardGamepadButtonRightBottom,
+	"RightRight":       ebiten.StandardGamepadButtonRightRight,
+	"RightLeft":        ebiten.StandardGamepadButtonRightLeft,
+	"RightTop":         ebiten.StandardGamepadButtonRightTop,
+	"FrontTopLeft":     ebiten.StandardGamepadButtonFrontTopLeft,
+	"FrontTopRight":    ebiten.StandardGamepadButtonFrontTopRight,
+	"FrontBottomLeft":  ebiten.StandardGamepadButtonFrontBottomLeft,
+	"FrontBottomRight": ebiten.StandardGamepadButtonFrontBottomRight,
+	"CenterLeft":       ebiten.StandardGamepadButtonCenterLeft,
+	"CenterRight":      ebiten.StandardGamepadButtonCenterRight,
+	"LeftStick":        ebiten.StandardGamepadButtonLeftStick,
+	"RightStick":       ebiten.StandardGamepadButtonRightStick,
+	"LeftTop":          ebiten.StandardGamepadButtonLeftTop,
+	"LeftBottom":       ebiten.StandardGamepadButtonLeftBottom,
+	"LeftLeft":         ebiten.StandardGamepadButtonLeftLeft,
+	"LeftRight":        ebiten.StandardGamepadButtonLeftRight,
+	"CenterCenter":     ebiten.StandardGamepadButtonCenterCenter,
+}
+
+// binding is the controller button an input presses
+type binding struct {
+	button input.Button
+	turbo  bool // Press the button repeatedly while held
+}
+
+// keyBinding binds a keyboard key
+type keyBinding struct {
+	key ebiten.Key
+	binding
+}
+
+// gamepadBinding binds a button of the standard gamepad layout
+type gamepadBinding struct {
+	pad ebiten.StandardGamepadButton
+	binding
+}
+
+// portControls are the resolved bindings of one player's controller
+type portControls struct {
+	keys    []keyBinding
+	gamepad int // 1-based index among the connected gamepads, 0 for none
+	buttons []gamepadBinding
+	stick   bool
+}
+
+// controls reads the keyboard and gamepads into the controllers once per frame
+type controls struct {
+	ports       [4]portControls
+	powerPad    [input.PowerPadButtons]*ebiten.Key // nil for unbound buttons
+	turboPeriod uint64                             // Frames per turbo press, half held and half released
+	frame       uint64
+	gamepadIDs  []ebiten.GamepadID
+}
+
+// newControls resolves the key and button names of the bindings
+func newControls(b input.Bindings, frameRate float64) (*controls, error) {
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+
+	rate := b.TurboRate
+	if rate <= 0 {
+		rate = input.DefaultTurboRate
+	}
+	c := &controls{turboPeriod: uint64(math.Max(2, math.Round(frameRate/rate)))}
+
+	for i, port := range b.Ports {
+		c.ports[i].gamepad = port.Gamepad
+		c.ports[i].stick = port.GamepadStick
+
+		for name, keys := range port.Keyboard {
+			target := bindingFor(name)
+			for _, keyName := range keys {
+				var key ebiten.Key
+				if err := key.UnmarshalText([]byte(keyName)); err != nil {
+					return nil, fmt.Errorf("player %d: unknown key %q", i+1, keyName)
+				}
+				c.ports[i].keys = append(c.ports[i].keys, keyBinding{key, target})
+			}
+		}
+
+		for name, buttons := range port.GamepadButtons {
+			target := bindingFor(name)
+			for _, buttonName := range buttons {
+				button, ok := gamepadButtonNames[buttonName]
+				if !ok {
+					return nil, fmt.Errorf("player %d: unknown gamepad button %q", i+1, buttonName)
+				}
+				c.ports[i].buttons = append(c.ports[i].buttons, gamepadBinding{button, target})
+			}
+		}
+	}
+
+	for i, keyName := range b.PowerPad {
+		if keyName == "" {
+			continue
+		}
+		key := new(ebiten.Key)
+		if err := key.UnmarshalText([]byte(keyName)); err != nil {
+			return nil, fmt.Errorf("power pad: unknown key %q", keyName)
+		}
+		c.powerPad[i] = key
+	}
+	return c, nil
+}
+
+// bindingFor returns what a validated controller button name presses
+func bindingFor(name string) binding {
+	switch name {
+	case input.BindingTurboA:
+		return binding{input.ButtonA, true}
+	case input.BindingTurboB:
+		return binding{input.ButtonB, true}
+	}
+	return binding{input.ButtonNames[name], false}
+}
+
+// update sets the buttons of the controllers from the held keys and buttons
+func (c *controls) update(controllers [4]*input.Controller) {
+	c.frame++
+	turboOn := c.frame%c.turboPeriod < c.turboPeriod/2
+
+	c.gamepadIDs = ebiten.AppendGamepadIDs(c.gamepadIDs[:0])
+	sort.Slice(c.gamepadIDs, func(i, j int) bool { return c.gamepadIDs[i] < c.gamepadIDs[j] })
+
+	for i, port := range c.ports {
+		if controllers[i] == nil {
+			continue
+		}
+
+		var buttons input.Button
+		press := func(b binding) {
+			if !b.turbo || turboOn {
+				buttons |= b.button
+			}
+		}
+
+		for _, k := range port.keys {
+			if ebiten.IsKeyPressed(k.key) {
+				press(k.binding)
+			}
+		}
+
+		if port.gamepad > 0 && port.gamepad <= len(c.gamepadIDs) {
+			id := c.gamepadIDs[port.gamepad-1]
+			if ebiten.IsStandardGamepadLayoutAvailable(id) {
+				for _, b := range port.buttons {
+					if ebiten.IsStandardGamepadButtonPressed(id, b.pad) {
+						press(b.binding)
+					}
+				}
+				if port.stick {
+					buttons |= stickButtons(id)
+				}
+			}
+		}
+
+		// A real D-pad can't press opposite directions, some games break if it does
+		if buttons&(input.ButtonUp|input.ButtonDown) == input.ButtonUp|input.ButtonDown {
+			buttons &^= input.ButtonUp | input.ButtonDown
+		}
+		if buttons&(input.ButtonLeft|input.ButtonRight) == input.ButtonLeft|input.ButtonRight {
+			buttons &^= input.ButtonLeft | input.ButtonRight
+		}
+
+		controllers[i].SetButtons(uint8(buttons))
+	}
+}
+
+// updatePowerPad sets the buttons of the Power Pad from the held keys
+func (c *controls) updatePowerPad(pad *input.PowerPad, sideA bool) {
+	var buttons uint16
+	for i, key := range c.powerPad {
+		if key == nil || !ebiten.IsKeyPressed(*key) {
+			continue
+		}
+		// Side A is side B flipped left to right
+		row, column := i/4, i%4
+		if sideA {
+			column = 3 - column
+		}
+		buttons |= 1 << (row*4 + column)
+	}
+	pad.SetButtons(buttons)
+}
+
+// powerPadKey reports whether a key is bound to a Power Pad button
+func (c *controls) powerPadKey(key ebiten.Key) bool {
+	for _, k := range c.powerPad {
+		if k != nil && *k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// stickButtons returns the directions the left stick of a gamepad points to
+func stickButtons(id ebiten.GamepadID) input.Button {
+	var buttons input.Button
+	x := ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisLeftStickHorizontal)
+	y := ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisLeftStickVertical)
+	switch {
+	case x < -stickThreshold:
+		buttons |= input.ButtonLeft
+	case x > stickThreshold:
+		buttons |= input.ButtonRight
+	}
+	switch {
+	case y < -stickThreshold:
+		buttons |= input.ButtonUp
+	case y > stickThreshold:
+		buttons |= input.ButtonDown
+	}
+	return buttons
+}
@@ -25,8 +25,8 @@ func RunExample(filePath string) {
 	// Load the ROM data
 	nes.LoadROM(prgROM.Data)
 
-	// Reset the NES components
-	nes.Reset()
+	// Power on the NES components
+	nes.PowerOn()
 
 	// Example of reading a value from memory
 	//address := uint16(0x8000) // Typical starting address for PRG ROM
@@ -2,45 +2,168 @@
 package nes
 
 import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/example/my-golang-project/pkg/apu"
+	"github.com/example/my-golang-project/pkg/input"
 	"github.com/example/my-golang-project/pkg/ppu"
 	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
 )
 
+// GameOptions holds the settings of the game window
+type GameOptions struct {
+	NTSCFilter bool             // Run the frames through the NTSC composite filter
+	NTSC       ppu.NTSCOptions  // Settings of the NTSC filter
+	Scale      ppu.ScaleOptions // Pixel-art upscaler, ignored with the NTSC filter
+	
+	// Audio settings
+	Volume    float64 // Master volume, 0-1
+	Mute      bool    // Start with the sound muted
+	AudioSync bool    // Pace the emulation by the audio clock instead of the frame rate
+	
+	// Keyboard and gamepad bindings of the controllers
+	Bindings input.Bindings
+	
+	// Path of the quick-save files without extension, slot n is saved to
+	// StatePath + ".ssn"; "state" when empty
+	StatePath string
+}
+
+// maxFramesPerUpdate limits how many frames audio sync may run in one tick
+const maxFramesPerUpdate = 3
+
+// hotkeyModifier makes the keys typed on the Family BASIC keyboard act as
+// hotkeys while it is held; the keyboard has no key it maps to
+const hotkeyModifier = ebiten.KeyControlRight
+
+// slotKeys are the keys of the quick-save slots 1 to 10
+var slotKeys = [...]ebiten.Key{
+	ebiten.KeyF1, ebiten.KeyF2, ebiten.KeyF3, ebiten.KeyF4, ebiten.KeyF5,
+	ebiten.KeyF6, ebiten.KeyF7, ebiten.KeyF8, ebiten.KeyF9, ebiten.KeyF10,
+}
+
 // Game implements ebiten.Game for the NES emulator
 type Game struct {
 	nes      *NES
 	renderer *ppu.Renderer
 	paused   bool
+	
+	// Sound output, nil if audio couldn't be initialized
+	audio     *audioOutput
+	audioSync bool
+	
+	// Keyboard and gamepad bindings, nil if they couldn't be resolved
+	controls *controls
+	
+	// Index into ppu.PalettePresets of the palette shown, -1 until P is pressed
+	paletteIndex int
+	
+	// Quick-save files, see GameOptions.StatePath
+	statePath string
 }
 
 // NewGame creates a new Game instance
-func NewGame(nes *NES) *Game {
+func NewGame(nes *NES, options GameOptions) *Game {
+	renderer := ppu.NewRenderer(nes.PPU)
+	if err := renderer.SetScaleOptions(options.Scale); err != nil {
+		fmt.Printf("Error setting scale filter: %v\n", err)
+	}
+	if options.NTSCFilter {
+		filter := ppu.NewNTSCFilter()
+		if err := filter.SetOptions(options.NTSC); err != nil {
+			fmt.Printf("Error setting NTSC filter: %v\n", err)
+		}
+		renderer.SetNTSCFilter(filter)
+	}
+	
+	audio, err := newAudioOutput(nes.APU, options.Volume, options.Mute)
+	if err != nil {
+		fmt.Printf("Error initializing audio: %v\n", err)
+		audio = nil
+	}
+	
+	controls, err := newControls(options.Bindings, nes.Region.FrameRate())
+	if err != nil {
+		fmt.Printf("Error in input bindings: %v\n", err)
+		controls = nil
+	}
+	
+	statePath := options.StatePath
+	if statePath == "" {
+		statePath = "state"
+	}
+	
 	return &Game{
 		nes:      nes,
-		renderer: ppu.NewRenderer(nes.PPU),
+		renderer: renderer,
 		paused:   false,
+		audio:    audio,
+		audioSync: options.AudioSync && audio != nil,
+		controls: controls,
+		paletteIndex: -1,
+		statePath: statePath,
 	}
 }
 
 // Update updates the game state
 func (g *Game) Update() error {
-	// Handle input
-	if ebiten.IsKeyPressed(ebiten.KeySpace) {
+	// Space toggles pause
+	if g.hotkeyPressed(ebiten.KeySpace) {
 		g.paused = !g.paused
 	}
 	
+	// P cycles through the built-in palettes
+	if g.hotkeyPressed(ebiten.KeyP) {
+		g.nextPalette()
+	}
+	
+	// F12 saves a screenshot of the output as shown
+	if inpututil.IsKeyJustPressed(ebiten.KeyF12) {
+		g.saveScreenshot()
+	}
+	
+	// F1-F10 save to a quick-save slot, Shift+F1-F10 load from it
+	// With the Family BASIC keyboard, F1-F8 need Right Ctrl held as well
+	for i, key := range slotKeys {
+		if !g.hotkeyPressed(key) {
+			continue
+		}
+		if ebiten.IsKeyPressed(ebiten.KeyShift) {
+			g.loadSlot(i + 1)
+		} else {
+			g.saveSlot(i + 1)
+		}
+	}
+	
+	// M mutes, - and = change the volume
+	if g.audio != nil {
+		if g.hotkeyPressed(ebiten.KeyM) {
+			g.audio.toggleMute()
+		}
+		if g.hotkeyPressed(ebiten.KeyMinus) {
+			g.audio.setVolume(g.audio.volume - 0.1)
+		}
+		if g.hotkeyPressed(ebiten.KeyEqual) {
+			g.audio.setVolume(g.audio.volume + 0.1)
+		}
+	}
+	
+	// 1-5 mute an APU channel, Shift+1-5 solo it
+	for i, key := range channelKeys {
+		if g.hotkeyPressed(key) {
+			toggleChannel(g.nes.APU, apu.Channel(i), ebiten.IsKeyPressed(ebiten.KeyShift))
+		}
+	}
+	
 	// Update the emulator if not paused
 	if !g.paused {
-		// Run multiple steps per frame for better performance
-		for i := 0; i < 1000; i++ {
-			if err := g.nes.Step(); err != nil {
-				return err
-			}
-			
-			// Break if a frame is complete
-			if g.nes.PPU.FrameComplete {
-				break
-			}
+		if err := g.runEmulation(); err != nil {
+			return err
 		}
 	}
 	
@@ -48,6 +171,124 @@ func (g *Game) Update() error {
 	return g.renderer.Update()
 }
 
+// hotkeyPressed reports whether an emulator hotkey was just pressed
+// Keys that drive the connected device don't act as hotkeys: the keys typed
+// on the Family BASIC keyboard, unless hotkeyModifier is held, and the mat's
+// keys with the Power Pad
+func (g *Game) hotkeyPressed(key ebiten.Key) bool {
+	switch g.nes.InputDevice {
+	case input.DeviceFamilyKeyboard:
+		if _, typed := familyKeyboardKeys[key]; typed && !ebiten.IsKeyPressed(hotkeyModifier) {
+			return false
+		}
+	case input.DevicePowerPadA, input.DevicePowerPadB:
+		if g.controls != nil && g.controls.powerPadKey(key) {
+			return false
+		}
+	}
+	return inpututil.IsKeyJustPressed(key)
+}
+
+// runEmulation runs the frames due in this tick and queues their audio
+func (g *Game) runEmulation() error {
+	// With audio sync, frames run while the audio queue is short, so the
+	// sound card's clock sets the speed
+	if g.audioSync {
+		for i := 0; i < maxFramesPerUpdate && g.audio.needsAudio(); i++ {
+			if err := g.runFrame(); err != nil {
+				return err
+			}
+			g.audio.update()
+		}
+		return nil
+	}
+	
+	if err := g.runFrame(); err != nil {
+		return err
+	}
+	if g.audio != nil {
+		g.audio.update()
+		g.audio.adaptRate()
+	}
+	return nil
+}
+
+// runFrame reads the controls and runs one frame
+// While a movie plays, the controllers follow the movie instead
+func (g *Game) runFrame() error {
+	if g.controls != nil && !g.nes.MoviePlaying() {
+		g.controls.update(g.nes.Controllers)
+	}
+	g.updatePeripherals()
+	return g.nes.RunFrame()
+}
+
+// nextPalette switches to the next built-in palette preset
+func (g *Game) nextPalette() {
+	g.paletteIndex = (g.paletteIndex + 1) % len(ppu.PalettePresets)
+	name := ppu.PalettePresets[g.paletteIndex]
+
+	palette, err := ppu.PresetPalette(name)
+	if err != nil {
+		fmt.Printf("Error switching palette: %v\n", err)
+		return
+	}
+	g.nes.PPU.SetColorPalette(palette)
+	g.renderer.Refresh()
+	fmt.Printf("Palette: %s\n", name)
+}
+
+// saveScreenshot writes the current output, filters and scaling included, to a PNG file
+func (g *Game) saveScreenshot() {
+	path := fmt.Sprintf("screenshot-%s.png", time.Now().Format("20060102-150405"))
+	if err := ppu.SavePNG(path, g.renderer.Screenshot()); err != nil {
+		fmt.Printf("Error saving screenshot: %v\n", err)
+		return
+	}
+	fmt.Printf("Screenshot saved to %s\n", path)
+}
+
+// slotPath returns the file of a quick-save slot
+func (g *Game) slotPath(slot int) string {
+	return fmt.Sprintf("%s.ss%d", g.statePath, slot)
+}
+
+// saveSlot saves the machine to a quick-save slot
+func (g *Game) saveSlot(slot int) {
+	var state bytes.Buffer
+	if err := g.nes.SaveState(&state); err != nil {
+		fmt.Printf("Error saving state: %v\n", err)
+		return
+	}
+	path := g.slotPath(slot)
+	if err := os.WriteFile(path, state.Bytes(), 0644); err != nil {
+		fmt.Printf("Error saving state: %v\n", err)
+		return
+	}
+	fmt.Printf("State saved to slot %d (%s)\n", slot, path)
+}
+
+// loadSlot restores the machine from a quick-save slot
+// Loading is refused during a movie, whose input follows the frames played
+func (g *Game) loadSlot(slot int) {
+	if g.nes.MoviePlaying() || g.nes.MovieRecording() {
+		fmt.Println("Can't load a state while a movie is playing or recording")
+		return
+	}
+	path := g.slotPath(slot)
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Printf("Error loading state: %v\n", err)
+		return
+	}
+	defer file.Close()
+	if err := g.nes.LoadState(file); err != nil {
+		fmt.Printf("Error loading state from %s: %v\n", path, err)
+		return
+	}
+	fmt.Printf("State loaded from slot %d (%s)\n", slot, path)
+}
+
 // Draw draws the game screen
 func (g *Game) Draw(screen *ebiten.Image) {
 	// Draw the NES output
@@ -56,18 +297,21 @@ func (g *Game) Draw(screen *ebiten.Image) {
 
 // Layout takes the outside size (e.g., the window size) and returns the logical screen size
 func (g *Game) Layout(outsideWidth, outsideHeight int) (int, int) {
-	// Return the NES screen size (256x240)
-	return 256, 240
+	// Return the NES screen size (256x240, larger with the NTSC filter)
+	return g.renderer.Layout()
 }
 
 // StartGame initializes and starts the NES game
-func StartGame(nes *NES) error {
-	game := NewGame(nes)
+func StartGame(nes *NES, options GameOptions) error {
+	game := NewGame(nes, options)
 	
 	// Configure window
 	ebiten.SetWindowSize(512, 480) // 256x240 scaled by 2
 	ebiten.SetWindowTitle("NES Emulator")
 	
+	// Run the game loop at the console's frame rate
+	ebiten.SetTPS(int(math.Round(nes.Region.FrameRate())))
+	
 	// Run the game
 	return ebiten.RunGame(game)
 }
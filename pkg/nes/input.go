@@ -0,0 +1,61 @@
+// Package nes implements the NES system integration
+package nes
+
+import (
+	"github.com/example/my-golang-project/pkg/input"
+)
+
+// DeviceFromHeader returns the input device requested by a NES 2.0 header
+// The second result is false when the header doesn't name a supported device
+func DeviceFromHeader(h *NESHeader) (input.DeviceType, bool) {
+	if !h.IsNES20() {
+		return input.DeviceStandard, false
+	}
+	switch h.ExpansionDevice() {
+	case ExpansionStandard:
+		return input.DeviceStandard, true
+	case ExpansionFourScore:
+		return input.DeviceFourScore, true
+	case ExpansionZapper:
+		return input.DeviceZapper, true
+	case ExpansionPowerPadA:
+		return input.DevicePowerPadA, true
+	case ExpansionPowerPadB:
+		return input.DevicePowerPadB, true
+	case ExpansionArkanoidNES:
+		return input.DeviceArkanoid, true
+	case ExpansionArkanoidFC:
+		return input.DeviceArkanoidFamicom, true
+	case ExpansionKeyboard:
+		return input.DeviceFamilyKeyboard, true
+	}
+	return input.DeviceStandard, false
+}
+
+// ConnectInput plugs a device into the controller or expansion ports
+// Port 1 keeps the first controller unless the device takes both ports
+func (n *NES) ConnectInput(device input.DeviceType) {
+	n.InputDevice = device
+	n.Memory.SetInputDevice(0, n.Controllers[0])
+	n.Memory.SetInputDevice(1, n.Controllers[1])
+	n.Memory.SetExpansionDevice(nil)
+
+	switch device {
+	case input.DeviceFourScore:
+		n.FourScore = input.NewFourScore(n.Controllers)
+		n.Memory.SetInputDevice(0, n.FourScore.Port(0))
+		n.Memory.SetInputDevice(1, n.FourScore.Port(1))
+	case input.DeviceZapper:
+		n.Memory.SetInputDevice(1, n.Zapper)
+	case input.DeviceArkanoid:
+		n.Vaus = input.NewVaus()
+		n.Memory.SetInputDevice(1, n.Vaus)
+	case input.DeviceArkanoidFamicom:
+		n.Vaus = input.NewFamicomVaus()
+		n.Memory.SetExpansionDevice(n.Vaus.ExpansionPort())
+	case input.DevicePowerPadA, input.DevicePowerPadB:
+		n.Memory.SetInputDevice(1, n.PowerPad)
+	case input.DeviceFamilyKeyboard:
+		n.Memory.SetExpansionDevice(n.Keyboard)
+	}
+}
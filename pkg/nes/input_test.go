@@ -0,0 +1,44 @@
+package nes
+
+import (
+	"testing"
+
+	"github.com/example/my-golang-project/pkg/input"
+)
+
+func TestDeviceFromHeader(t *testing.T) {
+	tests := []struct {
+		name      string
+		nes20     bool
+		expansion byte // Byte 15
+		want      input.DeviceType
+		ok        bool
+	}{
+		{"iNES", false, ExpansionZapper, input.DeviceStandard, false},
+		{"unspecified", true, ExpansionUnspecified, input.DeviceStandard, false},
+		{"standard", true, ExpansionStandard, input.DeviceStandard, true},
+		{"Four Score", true, ExpansionFourScore, input.DeviceFourScore, true},
+		{"Zapper", true, ExpansionZapper, input.DeviceZapper, true},
+		{"Power Pad side A", true, ExpansionPowerPadA, input.DevicePowerPadA, true},
+		{"Power Pad side B", true, ExpansionPowerPadB, input.DevicePowerPadB, true},
+		{"NES Vaus", true, ExpansionArkanoidNES, input.DeviceArkanoid, true},
+		{"Famicom Vaus", true, ExpansionArkanoidFC, input.DeviceArkanoidFamicom, true},
+		{"Family BASIC keyboard", true, ExpansionKeyboard, input.DeviceFamilyKeyboard, true},
+		{"upper bits ignored", true, 0xC0 | ExpansionZapper, input.DeviceZapper, true},
+		{"unsupported", true, 0x2A, input.DeviceStandard, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &NESHeader{}
+			if tt.nes20 {
+				h.Flags7 = 0x08
+			}
+			h.Reserved[4] = tt.expansion
+			got, ok := DeviceFromHeader(h)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("DeviceFromHeader() = %v, %v, want %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
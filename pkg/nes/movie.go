@@ -0,0 +1,133 @@
+// Package nes implements the NES system integration
+package nes
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/example/my-golang-project/pkg/input"
+	"github.com/example/my-golang-project/pkg/movie"
+)
+
+// movieState is a movie being recorded or played back
+// Input is applied and captured at frame boundaries, when the PPU enters
+// VBlank, so playback only depends on the emulated frames
+type movieState struct {
+	movie     *movie.Movie
+	recording bool
+	frame     int   // Frame being played or recorded
+	commands  uint8 // Commands to record with the current frame
+}
+
+// PlayMovie powers the console on and plays a movie's input from its first frame
+// A movie with a save state starts from it instead; only states written by
+// SaveState are supported, not FCEUX's
+// The controllers follow the movie until it ends or StopMovie is called
+func (n *NES) PlayMovie(m *movie.Movie) error {
+	n.startMovie(m)
+	if len(m.SaveState) > 0 {
+		if err := n.LoadState(bytes.NewReader(m.SaveState)); err != nil {
+			return fmt.Errorf("movie save state: %w", err)
+		}
+	}
+	n.movie = &movieState{movie: m}
+	n.applyMovieFrame()
+	return nil
+}
+
+// RecordMovie powers the console on and records the controllers into a new movie
+func (n *NES) RecordMovie() *movie.Movie {
+	m := movie.New()
+	m.PAL = n.Region == RegionPAL
+	m.FourScore = n.InputDevice == input.DeviceFourScore
+
+	n.startMovie(m)
+	n.movie = &movieState{movie: m, recording: true}
+	return m
+}
+
+// startMovie sets up the console for a movie and powers it on
+func (n *NES) startMovie(m *movie.Movie) {
+	if m.PAL {
+		n.SetRegion(RegionPAL)
+	} else if n.Region == RegionPAL {
+		n.SetRegion(RegionNTSC)
+	}
+	if m.FourScore {
+		n.ConnectInput(input.DeviceFourScore)
+	} else if n.InputDevice == input.DeviceFourScore {
+		n.ConnectInput(input.DeviceStandard)
+	}
+	n.PowerOn()
+}
+
+// StopMovie ends the playback or recording and returns the movie, nil if there was none
+func (n *NES) StopMovie() *movie.Movie {
+	if n.movie == nil {
+		return nil
+	}
+	m := n.movie.movie
+	n.movie = nil
+	return m
+}
+
+// MoviePlaying reports whether the controllers are following a movie
+func (n *NES) MoviePlaying() bool {
+	return n.movie != nil && !n.movie.recording
+}
+
+// MovieRecording reports whether the controllers are being recorded
+func (n *NES) MovieRecording() bool {
+	return n.movie != nil && n.movie.recording
+}
+
+// MovieFrame returns the current frame of the movie, 0 without a movie
+func (n *NES) MovieFrame() int {
+	if n.movie == nil {
+		return 0
+	}
+	return n.movie.frame
+}
+
+// movieFrameBoundary is called when a frame ends
+// Recording stores the input of the frame, playback sets up the next one
+func (n *NES) movieFrameBoundary() {
+	state := n.movie
+	if state.recording {
+		frame := movie.Frame{Commands: state.commands}
+		for i, controller := range n.Controllers {
+			frame.Buttons[i] = controller.Buttons()
+		}
+		state.movie.Frames = append(state.movie.Frames, frame)
+		state.commands = 0
+		state.frame++
+		return
+	}
+
+	state.frame++
+	if state.frame >= len(state.movie.Frames) {
+		fmt.Printf("Movie finished after %d frames\n", state.frame)
+		n.movie = nil
+		return
+	}
+	n.applyMovieFrame()
+}
+
+// applyMovieFrame sets the controllers and runs the commands of the current movie frame
+func (n *NES) applyMovieFrame() {
+	state := n.movie
+	if state.frame >= len(state.movie.Frames) {
+		return
+	}
+	frame := state.movie.Frames[state.frame]
+
+	switch {
+	case frame.Commands&movie.CommandPower != 0:
+		n.PowerOn()
+	case frame.Commands&movie.CommandReset != 0:
+		n.Reset()
+	}
+	for i, controller := range n.Controllers {
+		controller.SetButtons(frame.Buttons[i])
+	}
+}
@@ -2,8 +2,11 @@
 package nes
 
 import (
+	"github.com/example/my-golang-project/pkg/apu"
 	"github.com/example/my-golang-project/pkg/cpu"
+	"github.com/example/my-golang-project/pkg/input"
 	"github.com/example/my-golang-project/pkg/memory"
+	"github.com/example/my-golang-project/pkg/movie"
 	"github.com/example/my-golang-project/pkg/ppu"
 )
 
@@ -11,37 +14,97 @@ import (
 type NES struct {
 	CPU    *cpu.CPU
 	PPU    *ppu.PPU
+	APU    *apu.APU
 	Memory *memory.Memory
 
+	// Standard controllers of players 1 to 4, 3 and 4 need a Four Score
+	Controllers [4]*input.Controller
+
+	// Peripherals, only read when plugged in by ConnectInput
+	FourScore *input.FourScore // Created when connected
+	Zapper    *input.Zapper
+	Vaus      *input.Vaus // Created for the NES or Famicom version when connected
+	PowerPad  *input.PowerPad
+	Keyboard  *input.FamilyKeyboard
+
+	// Hardware plugged into the controller ports
+	InputDevice input.DeviceType
+
 	// System state
 	Running bool
 	Cycles  uint64
+
+	// Console timing
+	Region Region
+
+	// Movie being recorded or played back, nil when none
+	movie *movieState
+
+	// Fractional PPU dots carried between CPU cycles (PAL runs 3.2 per cycle)
+	ppuDotRemainder int
 }
 
 // New creates a new NES instance
 func New() *NES {
 	nes := &NES{
-		CPU:     cpu.NewCPU(),
-		PPU:     ppu.NewPPU(),
-		Memory:  memory.New(),
-		Running: false,
-		Cycles:  0,
+		CPU:    cpu.NewCPU(),
+		PPU:    ppu.NewPPU(),
+		APU:    apu.NewAPU(),
+		Memory: memory.New(),
+		Controllers: [4]*input.Controller{
+			input.NewController(), input.NewController(), input.NewController(), input.NewController(),
+		},
+		Zapper:   input.NewZapper(),
+		Vaus:     input.NewVaus(),
+		PowerPad: input.NewPowerPad(),
+		Keyboard: input.NewFamilyKeyboard(),
+		Running:  false,
+		Cycles:   0,
+		Region:   RegionNTSC,
 	}
 
 	// Connect components
 	nes.CPU.SetMemory(nes.Memory)
 	nes.PPU.SetCPU(nes.CPU)
 	nes.Memory.SetPPU(nes.PPU)
+	nes.Memory.SetCPU(nes.CPU)
+	nes.Memory.SetAPU(nes.APU)
+	nes.APU.SetMemory(nes.Memory)
+	nes.APU.SetCPU(nes.CPU)
+	nes.Zapper.SetScreen(nes.PPU)
+	nes.ConnectInput(input.DeviceStandard)
 
 	return nes
 }
 
-// Reset resets the NES to its initial state
-func (n *NES) Reset() {
+// SetRegion selects the console timing, call it before PowerOn
+func (n *NES) SetRegion(region Region) {
+	n.Region = region
+	n.PPU.SetTiming(region.PPUTiming())
+	n.APU.SetTiming(region.APUTiming())
+}
+
+// PowerOn puts the NES in its power-up state
+func (n *NES) PowerOn() {
 	n.Memory.Reset()
+	n.PPU.PowerOn()
+	n.APU.PowerOn()
+	n.CPU.Reset()
+	n.Cycles = 0
+	n.ppuDotRemainder = 0
+}
+
+// Reset presses the reset button
+// Unlike PowerOn, RAM and PPU memory keep their contents
+func (n *NES) Reset() {
+	if n.MovieRecording() {
+		n.movie.commands |= movie.CommandReset
+	}
 	n.PPU.Reset()
+	n.APU.Reset()
 	n.CPU.Reset()
 	n.Cycles = 0
+	n.ppuDotRemainder = 0
 }
 
 // LoadROM loads a ROM file into memory
@@ -60,9 +123,23 @@ func (n *NES) Step() error {
 		return err
 	}
 
-	// For each CPU cycle, the PPU runs 3 cycles
-	for i := uint8(0); i < cpuCycles*3; i++ {
+	// The APU runs off the CPU clock
+	for i := uint8(0); i < cpuCycles; i++ {
+		n.APU.Step()
+	}
+
+	// For each CPU cycle, the PPU runs 3 cycles (3.2 on PAL)
+	numerator, denominator := n.Region.ppuDotsPerCPUCycle()
+	n.ppuDotRemainder += int(cpuCycles) * numerator
+	frameComplete := n.PPU.FrameComplete
+	for n.ppuDotRemainder >= denominator {
 		n.PPU.Step()
+		n.ppuDotRemainder -= denominator
+	}
+
+	// A movie follows the frame boundaries, when the PPU enters VBlank
+	if n.movie != nil && n.PPU.FrameComplete && !frameComplete {
+		n.movieFrameBoundary()
 	}
 
 	// Update total cycles
@@ -71,6 +148,22 @@ func (n *NES) Step() error {
 	return nil
 }
 
+// RunFrame runs the emulation until the PPU completes the next frame
+func (n *NES) RunFrame() error {
+	// Leave the VBlank of the current frame first
+	for n.PPU.FrameComplete {
+		if err := n.Step(); err != nil {
+			return err
+		}
+	}
+	for !n.PPU.FrameComplete {
+		if err := n.Step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Run runs the NES emulation until stopped
 func (n *NES) Run() error {
 	n.Running = true
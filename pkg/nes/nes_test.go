@@ -0,0 +1,92 @@
+package nes
+
+import (
+	"testing"
+
+	"github.com/example/my-golang-project/pkg/input"
+)
+
+func TestResetKeepsRAM(t *testing.T) {
+	n := newTestNES(t, RegionNTSC, input.DeviceStandard, testProgram)
+	n.Memory.RAM[0x0700] = 0x42
+	n.PPU.VRAM[0x0123] = 0x45
+
+	n.Reset()
+	if n.Memory.RAM[0x0700] != 0x42 || n.PPU.VRAM[0x0123] != 0x45 {
+		t.Error("Reset cleared RAM or VRAM")
+	}
+
+	n.PowerOn()
+	if n.Memory.RAM[0x0700] != 0 {
+		t.Errorf("RAM = %#02x after PowerOn, want it cleared", n.Memory.RAM[0x0700])
+	}
+}
+
+func TestPPUDotsPerCPUCycle(t *testing.T) {
+	tests := []struct {
+		region                 Region
+		numerator, denominator uint64
+	}{
+		{RegionPAL, 16, 5},
+		{RegionDendy, 3, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.region.String(), func(t *testing.T) {
+			n := newTestNES(t, tt.region, input.DeviceStandard, testProgram)
+			timing := tt.region.PPUTiming()
+			frameDots := timing.Scanlines * 341
+			position := func() int {
+				return n.PPU.Scanline*341 + n.PPU.Cycle
+			}
+
+			// Neither region skips a dot, so the PPU's position counts its dots
+			last, startCycles := position(), n.Cycles
+			dots := uint64(0)
+			for n.Cycles-startCycles < 50000 {
+				if err := n.Step(); err != nil {
+					t.Fatal(err)
+				}
+				dots += uint64((position() - last + frameDots) % frameDots)
+				last = position()
+
+				cycles := n.Cycles - startCycles
+				if want := cycles * tt.numerator / tt.denominator; dots != want {
+					t.Fatalf("%d PPU dots after %d CPU cycles, want %d", dots, cycles, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRegionFromHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		nes20  bool
+		timing byte // Byte 12
+		flags9 byte
+		want   Region
+	}{
+		{"iNES", false, 0, 0, RegionNTSC},
+		{"iNES PAL bit", false, 0, 0x01, RegionPAL},
+		{"NES 2.0 NTSC", true, TimingNTSC, 0, RegionNTSC},
+		{"NES 2.0 PAL", true, TimingPAL, 0, RegionPAL},
+		{"NES 2.0 multi-region", true, TimingMultiRegion, 0, RegionNTSC},
+		{"NES 2.0 Dendy", true, TimingDendy, 0, RegionDendy},
+		{"NES 2.0 upper bits ignored", true, 0xFC | TimingDendy, 0, RegionDendy},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &NESHeader{}
+			if tt.nes20 {
+				h.Flags7 = 0x08
+			}
+			h.Reserved[1] = tt.timing
+			h.Flags9 = tt.flags9
+			if got := RegionFromHeader(h); got != tt.want {
+				t.Errorf("RegionFromHeader() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+// Package nes implements the NES system integration
+package nes
+
+import (
+	"fmt"
+	"image/color"
+	"time"
+
+	"github.com/example/my-golang-project/pkg/apu"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"golang.org/x/image/font/basicfont"
+)
+
+const (
+	nsfWindowWidth  = 320
+	nsfWindowHeight = 120
+	nsfTPS          = 60
+)
+
+// NSFGame implements ebiten.Game for the NSF player window
+type NSFGame struct {
+	player *NSFPlayer
+	audio  *audioOutput
+	paused bool
+}
+
+// NewNSFGame creates the player window and starts the file's first track
+func NewNSFGame(player *NSFPlayer, options GameOptions) *NSFGame {
+	audio, err := newAudioOutput(player.nes.APU, options.Volume, options.Mute)
+	if err != nil {
+		fmt.Printf("Error initializing audio: %v\n", err)
+		audio = nil
+	}
+	player.StartTrack(player.file.StartSong)
+	return &NSFGame{player: player, audio: audio}
+}
+
+// Update handles the keys and plays one tick worth of CPU cycles
+func (g *NSFGame) Update() error {
+	// Left and Right change the track
+	if inpututil.IsKeyJustPressed(ebiten.KeyRight) {
+		g.player.NextTrack()
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyLeft) {
+		g.player.PreviousTrack()
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeySpace) {
+		g.paused = !g.paused
+	}
+
+	// M mutes, - and = change the volume
+	if g.audio != nil {
+		if inpututil.IsKeyJustPressed(ebiten.KeyM) {
+			g.audio.toggleMute()
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyMinus) {
+			g.audio.setVolume(g.audio.volume - 0.1)
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyEqual) {
+			g.audio.setVolume(g.audio.volume + 0.1)
+		}
+	}
+
+	// 1-5 mute an APU channel, Shift+1-5 solo it
+	for i, key := range channelKeys {
+		if inpututil.IsKeyJustPressed(key) {
+			toggleChannel(g.player.nes.APU, apu.Channel(i), ebiten.IsKeyPressed(ebiten.KeyShift))
+		}
+	}
+
+	if g.paused {
+		return nil
+	}
+
+	// Move on when an NSFe file gives the track's length
+	if duration := g.player.Duration(); duration > 0 && g.player.Elapsed() >= duration {
+		g.player.NextTrack()
+	}
+
+	cycles := uint64(g.player.nes.APU.GetTiming().CPUClock / nsfTPS)
+	if err := g.player.Run(cycles); err != nil {
+		return err
+	}
+	if g.audio != nil {
+		g.audio.update()
+		g.audio.adaptRate()
+	}
+	return nil
+}
+
+// Draw shows the track and the file's information
+func (g *NSFGame) Draw(screen *ebiten.Image) {
+	face := basicfont.Face7x13
+	f := g.player.File()
+
+	title := f.TrackTitle(g.player.Track)
+	if title == "" {
+		title = f.Title
+	}
+
+	status := formatDuration(g.player.Elapsed())
+	if duration := g.player.Duration(); duration > 0 {
+		status += " / " + formatDuration(duration)
+	}
+	if g.paused {
+		status += "  [PAUSED]"
+	}
+
+	lines := []string{
+		fmt.Sprintf("Track %d/%d", g.player.Track, f.TotalSongs),
+		title,
+		f.Artist,
+		status,
+		"",
+		"Left/Right: track  Space: pause  1-5: mute",
+	}
+	for i, line := range lines {
+		text.Draw(screen, line, face, 10, 20+i*16, color.White)
+	}
+}
+
+// Layout returns the fixed size of the player window
+func (g *NSFGame) Layout(outsideWidth, outsideHeight int) (int, int) {
+	return nsfWindowWidth, nsfWindowHeight
+}
+
+// formatDuration formats a duration as minutes and seconds
+func formatDuration(d time.Duration) string {
+	seconds := int(d / time.Second)
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+// StartNSFPlayer opens the NSF player window
+func StartNSFPlayer(player *NSFPlayer, options GameOptions) error {
+	game := NewNSFGame(player, options)
+
+	ebiten.SetWindowSize(2*nsfWindowWidth, 2*nsfWindowHeight)
+	ebiten.SetWindowTitle(fmt.Sprintf("NSF Player - %s", player.File().Title))
+	ebiten.SetTPS(nsfTPS)
+
+	return ebiten.RunGame(game)
+}
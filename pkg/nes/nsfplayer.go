@@ -0,0 +1,165 @@
+// Package nes implements the NES system integration
+package nes
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/example/my-golang-project/pkg/apu"
+	"github.com/example/my-golang-project/pkg/nsf"
+)
+
+// supportedChips are the expansion sound chips NSF files can use
+// The VRC7's FM synthesis is not emulated, files using it play without it
+const supportedChips = nsf.ChipVRC6 | nsf.ChipFDS | nsf.ChipMMC5 | nsf.ChipN163 | nsf.ChipS5B
+
+// NSFPlayer plays the tracks of an NSF file on the emulated console
+type NSFPlayer struct {
+	nes    *NES
+	file   *nsf.File
+	mapper *nsf.Mapper
+
+	// Track being played, 1-based
+	Track int
+
+	playPeriod float64 // CPU cycles between PLAY calls
+	nextPlay   float64 // Cycle count of the next PLAY call
+}
+
+// NewNSFPlayer maps a file into the console and selects its region and
+// expansion sound
+func NewNSFPlayer(n *NES, f *nsf.File) *NSFPlayer {
+	p := &NSFPlayer{
+		nes:    n,
+		file:   f,
+		mapper: nsf.NewMapper(f),
+	}
+	n.Memory.SetMapper(p.mapper)
+
+	region := RegionNTSC
+	speed := f.SpeedNTSC
+	if f.PAL() {
+		region = RegionPAL
+		speed = f.SpeedPAL
+	}
+	n.SetRegion(region)
+	p.playPeriod = float64(speed) * n.APU.GetTiming().CPUClock / 1e6
+
+	if unsupported := f.Chips &^ supportedChips; unsupported != 0 {
+		fmt.Printf("Warning: expansion audio not supported: %s\n", strings.Join(nsf.ChipNames(unsupported), ", "))
+	}
+
+	return p
+}
+
+// File returns the file being played
+func (p *NSFPlayer) File() *nsf.File {
+	return p.file
+}
+
+// StartTrack powers the console on and calls INIT for a 1-based track
+func (p *NSFPlayer) StartTrack(track int) {
+	if track < 1 || track > p.file.TotalSongs {
+		track = p.file.StartSong
+	}
+	p.Track = track
+
+	p.startExpansions()
+
+	p.mapper.Reset()
+	p.nes.PowerOn()
+
+	// Sound registers as the NSF specification leaves them for INIT
+	for address := uint16(0x4000); address <= 0x4013; address++ {
+		p.nes.Memory.Write(address, 0x00)
+	}
+	p.nes.Memory.Write(0x4015, 0x0F)
+	p.nes.Memory.Write(0x4017, 0x40)
+
+	// INIT takes the track in A and the region in X
+	p.nes.CPU.A = uint8(track - 1)
+	p.nes.CPU.X = 0
+	if p.nes.Region == RegionPAL {
+		p.nes.CPU.X = 1
+	}
+	p.nes.CPU.PC = nsf.DriverAddress
+	p.nextPlay = p.playPeriod
+}
+
+// startExpansions connects fresh expansion sound chips for a track
+func (p *NSFPlayer) startExpansions() {
+	var mix apu.ExpansionMix
+	if p.file.Chips&nsf.ChipVRC6 != 0 {
+		vrc6 := apu.NewVRC6()
+		mix = append(mix, vrc6)
+		p.mapper.SetExpansion(nsf.ChipVRC6, vrc6)
+	}
+	if p.file.Chips&nsf.ChipFDS != 0 {
+		fds := apu.NewFDS()
+		mix = append(mix, fds)
+		p.mapper.SetExpansion(nsf.ChipFDS, fds)
+	}
+	if p.file.Chips&nsf.ChipMMC5 != 0 {
+		mmc5 := apu.NewMMC5()
+		mix = append(mix, mmc5)
+		p.mapper.SetExpansion(nsf.ChipMMC5, mmc5)
+	}
+	if p.file.Chips&nsf.ChipN163 != 0 {
+		n163 := apu.NewN163()
+		mix = append(mix, n163)
+		p.mapper.SetExpansion(nsf.ChipN163, n163)
+	}
+	if p.file.Chips&nsf.ChipS5B != 0 {
+		s5b := apu.NewSunsoft5B()
+		mix = append(mix, s5b)
+		p.mapper.SetExpansion(nsf.ChipS5B, s5b)
+	}
+	if len(mix) > 0 {
+		p.nes.APU.SetExpansion(mix)
+	}
+}
+
+// NextTrack starts the following track, wrapping around
+func (p *NSFPlayer) NextTrack() {
+	p.StartTrack(p.Track%p.file.TotalSongs + 1)
+}
+
+// PreviousTrack starts the preceding track, wrapping around
+func (p *NSFPlayer) PreviousTrack() {
+	p.StartTrack((p.Track+p.file.TotalSongs-2)%p.file.TotalSongs + 1)
+}
+
+// Elapsed returns how long the current track has been playing
+func (p *NSFPlayer) Elapsed() time.Duration {
+	seconds := float64(p.nes.Cycles) / p.nes.APU.GetTiming().CPUClock
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// Duration returns the length of the current track, or 0 when the file doesn't say
+func (p *NSFPlayer) Duration() time.Duration {
+	ms := p.file.TrackDuration(p.Track)
+	if ms < 0 {
+		return 0
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// Run emulates the given number of CPU cycles, calling PLAY at the file's rate
+// PLAY is only called from the idle loop, so a late INIT or PLAY delays it
+func (p *NSFPlayer) Run(cycles uint64) error {
+	end := p.nes.Cycles + cycles
+	for p.nes.Cycles < end {
+		if p.nes.CPU.PC == nsf.IdleAddress && float64(p.nes.Cycles) >= p.nextPlay {
+			p.nes.CPU.PC = nsf.PlayAddress
+			p.nextPlay += p.playPeriod
+			if p.nextPlay < float64(p.nes.Cycles) {
+				p.nextPlay = float64(p.nes.Cycles) + p.playPeriod
+			}
+		}
+		if err := p.nes.Step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
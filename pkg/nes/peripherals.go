@@ -0,0 +1,112 @@
+// Package nes implements the NES system integration
+package nes
+
+import (
+	"github.com/example/my-golang-project/pkg/input"
+	"github.com/example/my-golang-project/pkg/ppu"
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// familyKeyboardKeys maps host keys to the keys of the Family BASIC keyboard
+// Keys without a host equivalent sit where they are on a Japanese layout
+var familyKeyboardKeys = map[ebiten.Key]string{
+	ebiten.KeyEnter:         "Return",
+	ebiten.KeyEscape:        "Esc",
+	ebiten.KeyControlLeft:   "Ctrl",
+	ebiten.KeyShiftLeft:     "LShift",
+	ebiten.KeyShiftRight:    "RShift",
+	ebiten.KeyAltLeft:       "Grph",
+	ebiten.KeyAltRight:      "Kana",
+	ebiten.KeySpace:         "Space",
+	ebiten.KeyArrowLeft:     "Left",
+	ebiten.KeyArrowRight:    "Right",
+	ebiten.KeyArrowUp:       "Up",
+	ebiten.KeyArrowDown:     "Down",
+	ebiten.KeyHome:          "ClrHome",
+	ebiten.KeyInsert:        "Ins",
+	ebiten.KeyBackspace:     "Del",
+	ebiten.KeyDelete:        "Del",
+	ebiten.KeyEnd:           "Stop",
+	ebiten.KeyBracketLeft:   "[",
+	ebiten.KeyBracketRight:  "]",
+	ebiten.KeySemicolon:     ";",
+	ebiten.KeyQuote:         ":",
+	ebiten.KeyBackquote:     "@",
+	ebiten.KeyMinus:         "-",
+	ebiten.KeyEqual:         "^",
+	ebiten.KeyBackslash:     "Yen",
+	ebiten.KeyIntlBackslash: "_",
+	ebiten.KeyComma:         ",",
+	ebiten.KeyPeriod:        ".",
+	ebiten.KeySlash:         "/",
+	ebiten.KeyF1:            "F1",
+	ebiten.KeyF2:            "F2",
+	ebiten.KeyF3:            "F3",
+	ebiten.KeyF4:            "F4",
+	ebiten.KeyF5:            "F5",
+	ebiten.KeyF6:            "F6",
+	ebiten.KeyF7:            "F7",
+	ebiten.KeyF8:            "F8",
+}
+
+func init() {
+	for key := ebiten.KeyA; key <= ebiten.KeyZ; key++ {
+		familyKeyboardKeys[key] = key.String()
+	}
+	for key := ebiten.KeyDigit0; key <= ebiten.KeyDigit9; key++ {
+		familyKeyboardKeys[key] = string(rune('0' + key - ebiten.KeyDigit0))
+	}
+}
+
+// updatePeripherals reads the mouse and keyboard into the connected peripheral
+func (g *Game) updatePeripherals() {
+	switch g.nes.InputDevice {
+	case input.DeviceZapper:
+		g.updateZapper()
+	case input.DeviceArkanoid, input.DeviceArkanoidFamicom:
+		g.updateVaus()
+	case input.DevicePowerPadA, input.DevicePowerPadB:
+		if g.controls != nil {
+			g.controls.updatePowerPad(g.nes.PowerPad, g.nes.InputDevice == input.DevicePowerPadA)
+		}
+	case input.DeviceFamilyKeyboard:
+		g.updateFamilyKeyboard()
+	}
+}
+
+// cursorPosition returns the mouse cursor in NES frame pixels
+func (g *Game) cursorPosition() (int, int) {
+	// The cursor is in screen coordinates, scaled from the NES frame
+	width, height := g.renderer.Layout()
+	x, y := ebiten.CursorPosition()
+	return x * ppu.FrameWidth / width, y * ppu.FrameHeight / height
+}
+
+// updateZapper aims the Zapper at the mouse cursor, the left button pulls the trigger
+func (g *Game) updateZapper() {
+	g.nes.Zapper.Aim(g.cursorPosition())
+	g.nes.Zapper.Trigger = ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft)
+}
+
+// updateVaus turns the paddle's knob to follow the mouse across the window,
+// the left button fires
+func (g *Game) updateVaus() {
+	x, _ := g.cursorPosition()
+	x = max(0, min(ppu.FrameWidth-1, x))
+	g.nes.Vaus.Position = uint8(x * 255 / (ppu.FrameWidth - 1))
+	g.nes.Vaus.Button = ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft)
+}
+
+// updateFamilyKeyboard presses the keyboard keys held on the host
+func (g *Game) updateFamilyKeyboard() {
+	g.nes.Keyboard.ReleaseAll()
+	// Keys pressed with hotkeyModifier are hotkeys, not typing
+	if ebiten.IsKeyPressed(hotkeyModifier) {
+		return
+	}
+	for key, name := range familyKeyboardKeys {
+		if ebiten.IsKeyPressed(key) {
+			g.nes.Keyboard.SetKey(name, true)
+		}
+	}
+}
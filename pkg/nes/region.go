@@ -0,0 +1,103 @@
+// Package nes implements the NES system integration
+package nes
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/example/my-golang-project/pkg/apu"
+	"github.com/example/my-golang-project/pkg/ppu"
+)
+
+// Region selects the console timing to emulate
+type Region int
+
+const (
+	RegionNTSC  Region = iota // North America and Japan
+	RegionPAL                 // Europe and Australia
+	RegionDendy               // Dendy and other PAL famiclones
+)
+
+// ParseRegion converts a region name to a Region
+func ParseRegion(name string) (Region, error) {
+	switch strings.ToLower(name) {
+	case "ntsc":
+		return RegionNTSC, nil
+	case "pal":
+		return RegionPAL, nil
+	case "dendy":
+		return RegionDendy, nil
+	}
+	return RegionNTSC, fmt.Errorf("unknown region: %s", name)
+}
+
+// RegionFromHeader returns the region requested by a ROM header
+// Multi-region NES 2.0 ROMs run as NTSC
+func RegionFromHeader(h *NESHeader) Region {
+	if h.IsNES20() {
+		switch h.TimingMode() {
+		case TimingPAL:
+			return RegionPAL
+		case TimingDendy:
+			return RegionDendy
+		}
+		return RegionNTSC
+	}
+
+	// iNES 1.0 keeps a rarely set PAL bit in flags 9
+	if h.Flags9&0x01 != 0 {
+		return RegionPAL
+	}
+	return RegionNTSC
+}
+
+// String returns the name of the region
+func (r Region) String() string {
+	switch r {
+	case RegionPAL:
+		return "PAL"
+	case RegionDendy:
+		return "Dendy"
+	}
+	return "NTSC"
+}
+
+// FrameRate returns the number of frames per second
+func (r Region) FrameRate() float64 {
+	switch r {
+	case RegionPAL, RegionDendy:
+		return 50.0070
+	}
+	return 60.0988
+}
+
+// PPUTiming returns the frame layout of the region's PPU
+func (r Region) PPUTiming() ppu.Timing {
+	switch r {
+	case RegionPAL:
+		return ppu.PALTiming
+	case RegionDendy:
+		return ppu.DendyTiming
+	}
+	return ppu.NTSCTiming
+}
+
+// APUTiming returns the clock and tables of the region's APU
+func (r Region) APUTiming() apu.Timing {
+	switch r {
+	case RegionPAL:
+		return apu.PALTiming
+	case RegionDendy:
+		return apu.DendyTiming
+	}
+	return apu.NTSCTiming
+}
+
+// ppuDotsPerCPUCycle returns the PPU to CPU clock ratio as a fraction
+// NTSC and Dendy run 3 dots per cycle, PAL runs 3.2
+func (r Region) ppuDotsPerCPUCycle() (numerator int, denominator int) {
+	if r == RegionPAL {
+		return 16, 5
+	}
+	return 3, 1
+}
@@ -19,6 +19,42 @@ type NESHeader struct {
 	Reserved   [5]byte // Reserved, should be zero
 }
 
+// NES 2.0 CPU/PPU timing modes (byte 12)
+const (
+	TimingNTSC        = 0
+	TimingPAL         = 1
+	TimingMultiRegion = 2
+	TimingDendy       = 3
+)
+
+// NES 2.0 default expansion devices (byte 15)
+const (
+	ExpansionUnspecified = 0x00
+	ExpansionStandard    = 0x01
+	ExpansionFourScore   = 0x02
+	ExpansionZapper      = 0x08 // Zapper on port 2
+	ExpansionPowerPadA   = 0x0B
+	ExpansionPowerPadB   = 0x0C
+	ExpansionArkanoidNES = 0x0F
+	ExpansionArkanoidFC  = 0x10 // Famicom Vaus on the expansion port
+	ExpansionKeyboard    = 0x23 // Family BASIC keyboard
+)
+
+// IsNES20 reports whether the header uses the NES 2.0 format
+func (h *NESHeader) IsNES20() bool {
+	return h.Flags7&0x0C == 0x08
+}
+
+// TimingMode returns the NES 2.0 CPU/PPU timing mode (byte 12)
+func (h *NESHeader) TimingMode() byte {
+	return h.Reserved[1] & 0x03
+}
+
+// ExpansionDevice returns the NES 2.0 default expansion device (byte 15)
+func (h *NESHeader) ExpansionDevice() byte {
+	return h.Reserved[4] & 0x3F
+}
+
 // PRGROM represents the Program ROM data of an NES ROM file
 type PRGROM struct {
 	Size int64  // Size in bytes
@@ -118,4 +154,4 @@ func mirroringType(flags6 byte) string {
 		return "Vertical"
 	}
 	return "Horizontal"
-}
\ No newline at end of file
+}
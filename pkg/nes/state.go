@@ -0,0 +1,159 @@
+// Package nes implements the NES system integration
+package nes
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/example/my-golang-project/pkg/input"
+	"github.com/example/my-golang-project/pkg/savestate"
+)
+
+// stateMagic starts every save state file
+const stateMagic = "NESSTATE"
+
+// StateVersion is the version of the save state layout
+// Increase it when a component saves more or different fields
+const StateVersion = 1
+
+// SaveState writes a snapshot of the whole machine: CPU, RAM, PPU, APU,
+// cartridge hardware and the devices in the controller ports
+func (n *NES) SaveState(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	s := savestate.NewWriter(bw)
+	n.serialize(s)
+	if err := s.Err(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// LoadState restores a snapshot written by SaveState
+// The region and input device switch to the ones saved. If the state can't
+// be loaded, the machine is left as it was
+func (n *NES) LoadState(r io.Reader) error {
+	var backup bytes.Buffer
+	if err := n.SaveState(&backup); err != nil {
+		return err
+	}
+
+	s := savestate.NewReader(bufio.NewReader(r))
+	n.serialize(s)
+	if err := s.Err(); err != nil {
+		if restoreErr := n.restoreState(backup.Bytes()); restoreErr != nil {
+			return fmt.Errorf("%w (restoring the previous state failed: %v)", err, restoreErr)
+		}
+		return fmt.Errorf("invalid save state: %w", err)
+	}
+	return nil
+}
+
+// restoreState loads a state saved by this machine
+func (n *NES) restoreState(data []byte) error {
+	s := savestate.NewReader(bytes.NewReader(data))
+	n.serialize(s)
+	return s.Err()
+}
+
+// serialize saves or loads the machine in the order of the format
+func (n *NES) serialize(s *savestate.Serializer) {
+	magic := []byte(stateMagic)
+	s.Bytes(magic)
+	if s.Err() == nil && string(magic) != stateMagic {
+		s.Fail(fmt.Errorf("not a save state"))
+		return
+	}
+	version := uint32(StateVersion)
+	s.Uint32(&version)
+	if s.Err() == nil && version != StateVersion {
+		s.Fail(fmt.Errorf("unsupported save state version %d", version))
+		return
+	}
+
+	// A state only makes sense for the program it was saved with
+	checksum := n.programChecksum()
+	saved := checksum
+	s.Uint32(&saved)
+	if s.Err() == nil && saved != checksum {
+		s.Fail(fmt.Errorf("save state is for a different ROM"))
+		return
+	}
+
+	n.serializeSetup(s)
+	if s.Err() != nil {
+		return
+	}
+
+	s.Section("NES ")
+	s.Uint64(&n.Cycles)
+	s.Int(&n.ppuDotRemainder)
+
+	n.CPU.Serialize(s)
+	n.Memory.Serialize(s)
+	n.PPU.Serialize(s)
+	n.APU.Serialize(s)
+	n.serializeInput(s)
+}
+
+// programChecksum identifies the program running: the PRG ROM, and the
+// cartridge hardware's own program if it has one, like an NSF file
+func (n *NES) programChecksum() uint32 {
+	checksum := crc32.ChecksumIEEE(n.Memory.ROMCartridgeSpace[:])
+	if mapper, ok := n.Memory.Mapper.(interface{ Checksum() uint32 }); ok {
+		var buf [4]byte
+		binary.LittleEndian.PutUint32(buf[:], mapper.Checksum())
+		checksum = crc32.Update(checksum, crc32.IEEETable, buf[:])
+	}
+	return checksum
+}
+
+// serializeSetup saves or loads the region and the input device, and
+// switches to them when loading, so the rest of the state fits the machine
+func (n *NES) serializeSetup(s *savestate.Serializer) {
+	region := int(n.Region)
+	device := int(n.InputDevice)
+	s.Int(&region)
+	s.Int(&device)
+	if !s.Loading() || s.Err() != nil {
+		return
+	}
+
+	if Region(region) < RegionNTSC || Region(region) > RegionDendy {
+		s.Fail(fmt.Errorf("invalid region %d", region))
+		return
+	}
+	if input.DeviceType(device) < input.DeviceStandard || input.DeviceType(device) > input.DeviceFamilyKeyboard {
+		s.Fail(fmt.Errorf("invalid input device %d", device))
+		return
+	}
+	if Region(region) != n.Region {
+		n.SetRegion(Region(region))
+	}
+	if input.DeviceType(device) != n.InputDevice {
+		n.ConnectInput(input.DeviceType(device))
+	}
+}
+
+// serializeInput saves or loads the controllers and the connected peripheral
+func (n *NES) serializeInput(s *savestate.Serializer) {
+	for _, controller := range n.Controllers {
+		controller.Serialize(s)
+	}
+
+	switch n.InputDevice {
+	case input.DeviceFourScore:
+		n.FourScore.Serialize(s)
+	case input.DeviceZapper:
+		n.Zapper.Serialize(s)
+	case input.DeviceArkanoid, input.DeviceArkanoidFamicom:
+		n.Vaus.Serialize(s)
+	case input.DevicePowerPadA, input.DevicePowerPadB:
+		n.PowerPad.Serialize(s)
+	case input.DeviceFamilyKeyboard:
+		n.Keyboard.Serialize(s)
+	}
+}
@@ -0,0 +1,150 @@
+package nes
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/example/my-golang-project/pkg/input"
+)
+
+// testProgram sets up the PPU and the APU, then loops incrementing a
+// counter that feeds a pulse channel and the PPU, and storing controller reads
+var testProgram = []byte{
+	0x78, 0xD8, 0xA2, 0xFF, 0x9A, // SEI, CLD, LDX #$FF, TXS
+	0xA9, 0x1E, 0x8D, 0x01, 0x20, // Show background and sprites
+	0xA9, 0x0F, 0x8D, 0x15, 0x40, // Enable the channels
+	0xA9, 0xBF, 0x8D, 0x00, 0x40, // Pulse 1 duty and volume
+	0xE6, 0x10, 0xAD, 0x10, 0x00, // loop: INC $10, LDA $10
+	0x8D, 0x02, 0x40, 0x8D, 0x05, 0x20, 0x8D, 0x07, 0x20, // Pulse 1 period, scroll, VRAM
+	0xA9, 0x01, 0x8D, 0x16, 0x40, 0xA9, 0x00, 0x8D, 0x16, 0x40, // Strobe the controllers
+	0xAD, 0x16, 0x40, 0x95, 0x20, 0x9D, 0x00, 0x03, 0xE8, // Store a read
+	0x4C, 0x14, 0x80, // JMP loop
+}
+
+// newTestNES powers on a machine running testProgram
+func newTestNES(t *testing.T, region Region, device input.DeviceType, program []byte) *NES {
+	t.Helper()
+	prg := make([]byte, 0x8000)
+	copy(prg, program)
+	prg[0x7FFC], prg[0x7FFD] = 0x00, 0x80
+
+	n := New()
+	n.SetRegion(region)
+	n.ConnectInput(device)
+	if err := n.LoadROM(prg); err != nil {
+		t.Fatal(err)
+	}
+	n.PowerOn()
+	return n
+}
+
+// runFrames runs the machine with button A of player 1 held on odd frames
+func runFrames(t *testing.T, n *NES, frames int) {
+	t.Helper()
+	for i := 0; i < frames; i++ {
+		n.Controllers[0].SetButton(input.ButtonA, i%2 == 1)
+		if err := n.RunFrame(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// saveState returns a save state of the machine
+func saveState(t *testing.T, n *NES) []byte {
+	t.Helper()
+	var state bytes.Buffer
+	if err := n.SaveState(&state); err != nil {
+		t.Fatal(err)
+	}
+	return state.Bytes()
+}
+
+func TestSaveLoadSave(t *testing.T) {
+	tests := []struct {
+		name   string
+		region Region
+		device input.DeviceType
+	}{
+		{"NTSC", RegionNTSC, input.DeviceStandard},
+		{"PAL", RegionPAL, input.DeviceStandard},
+		{"Dendy", RegionDendy, input.DeviceStandard},
+		{"Four Score", RegionNTSC, input.DeviceFourScore},
+		{"Zapper", RegionNTSC, input.DeviceZapper},
+		{"Arkanoid", RegionNTSC, input.DeviceArkanoid},
+		{"Famicom Arkanoid", RegionNTSC, input.DeviceArkanoidFamicom},
+		{"Power Pad", RegionNTSC, input.DevicePowerPadA},
+		{"Family BASIC keyboard", RegionNTSC, input.DeviceFamilyKeyboard},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := newTestNES(t, tt.region, tt.device, testProgram)
+			runFrames(t, original, 10)
+			saved := saveState(t, original)
+
+			// A machine powered on with defaults switches to the saved setup
+			restored := newTestNES(t, RegionNTSC, input.DeviceStandard, testProgram)
+			if err := restored.LoadState(bytes.NewReader(saved)); err != nil {
+				t.Fatalf("LoadState() error = %v", err)
+			}
+			if restored.Region != tt.region || restored.InputDevice != tt.device {
+				t.Fatalf("loaded setup = %v, %v, want %v, %v", restored.Region, restored.InputDevice, tt.region, tt.device)
+			}
+			if resaved := saveState(t, restored); !bytes.Equal(resaved, saved) {
+				t.Fatal("state saved after loading differs from the state loaded")
+			}
+
+			// Both machines go on in lockstep
+			runFrames(t, original, 5)
+			runFrames(t, restored, 5)
+			if !bytes.Equal(saveState(t, restored), saveState(t, original)) {
+				t.Error("loaded machine diverged from the original")
+			}
+		})
+	}
+}
+
+func TestLoadStateErrors(t *testing.T) {
+	source := newTestNES(t, RegionNTSC, input.DeviceStandard, testProgram)
+	runFrames(t, source, 3)
+	valid := saveState(t, source)
+
+	otherProgram := append(append([]byte{}, testProgram...), 0xEA)
+	other := newTestNES(t, RegionNTSC, input.DeviceStandard, otherProgram)
+
+	badVersion := append([]byte{}, valid...)
+	badVersion[len(stateMagic)]++
+
+	badRegion := append([]byte{}, valid...)
+	badRegion[len(stateMagic)+8] = 9 // After the version and the checksum
+
+	tests := []struct {
+		name    string
+		state   []byte
+		wantErr string
+	}{
+		{"empty", nil, "EOF"},
+		{"not a state", []byte("NESSTATX and more"), "not a save state"},
+		{"newer version", badVersion, "unsupported save state version"},
+		{"different ROM", saveState(t, other), "different ROM"},
+		{"invalid region", badRegion, "invalid region"},
+		{"truncated", valid[:len(valid)/2], "EOF"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := newTestNES(t, RegionPAL, input.DeviceZapper, testProgram)
+			runFrames(t, n, 2)
+			before := saveState(t, n)
+
+			err := n.LoadState(bytes.NewReader(tt.state))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("LoadState() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+			if !bytes.Equal(saveState(t, n), before) {
+				t.Error("failed LoadState() changed the machine")
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+// Package nsf implements loading of NSF and NSFe music files
+package nsf
+
+import "encoding/binary"
+
+// Addresses of the driver routine the mapper places in the expansion area
+const (
+	DriverAddress = 0x4100 // JSR INIT, then the idle loop
+	IdleAddress   = 0x4103 // JMP to itself, the CPU waits here between calls
+	PlayAddress   = 0x4106 // JSR PLAY, then back to the idle loop
+)
+
+// Mapper memory layout
+const (
+	bankRegisterStart = 0x5FF8 // Bank registers of the 8 slots at $8000-$FFFF
+	ramStart          = 0x6000
+	ramSize           = 0x2000
+	romStart          = 0x8000
+	bankSize          = 0x1000
+	mmc5ExRAMStart    = 0x5C00
+	mmc5ExRAMSize     = 0x3F6 // Up to the FDS bank registers at $5FF6
+
+	// FDS files have RAM at $6000-$FFFF, loaded with ten banks that
+	// $5FF6-$5FFF switch by copying
+	fdsBankRegisterStart = 0x5FF6
+	fdsSlots             = 10
+)
+
+// Mapper is the cartridge hardware of an NSF player: 8KB of RAM at $6000,
+// 32KB of song data at $8000 in eight 4KB banks, and a small driver at $4100
+// that calls INIT and PLAY
+type Mapper struct {
+	file   *File
+	driver [12]byte
+	ram    [ramSize]byte
+	rom    []byte   // Program padded to whole 4KB banks
+	banks  [8]uint8 // Bank mapped in each 4KB slot
+
+	// RAM at $6000-$FFFF of FDS files, nil for others
+	fdsRAM []byte
+
+	// MMC5 extras NSF files may use: its extended RAM as work RAM, and
+	// the 8x8 bit multiplier at $5205/$5206
+	exram        [mmc5ExRAMSize]byte
+	multiplicand uint8
+	multiplier   uint8
+
+	// Expansion sound chips receiving the writes to their registers, by
+	// chip bit; chips with readable registers also implement ReadRegister
+	Expansions map[uint8]interface {
+		WriteRegister(address uint16, value uint8)
+	}
+}
+
+// NewMapper creates the mapper of a file
+func NewMapper(f *File) *Mapper {
+	m := &Mapper{file: f, Expansions: map[uint8]interface {
+		WriteRegister(address uint16, value uint8)
+	}{}}
+
+	// JSR INIT; JMP $4103; JSR PLAY; JMP $4103
+	m.driver = [12]byte{0x20, 0, 0, 0x4C, 0x03, 0x41, 0x20, 0, 0, 0x4C, 0x03, 0x41}
+	binary.LittleEndian.PutUint16(m.driver[1:], f.InitAddress)
+	binary.LittleEndian.PutUint16(m.driver[7:], f.PlayAddress)
+
+	// Bankswitched programs start at the load address' offset in its bank,
+	// others are laid out flat from the load address, from $6000 on FDS
+	// files and $8000 on others
+	base, slots := romStart, 8
+	if f.Chips&ChipFDS != 0 {
+		base, slots = ramStart, fdsSlots
+		m.fdsRAM = make([]byte, fdsSlots*bankSize)
+	}
+	padding := int(f.LoadAddress) & (bankSize - 1)
+	if !f.Bankswitched() {
+		padding = int(f.LoadAddress) - base
+	}
+	size := padding + len(f.Program)
+	if size%bankSize != 0 {
+		size += bankSize - size%bankSize
+	}
+	if size < slots*bankSize {
+		size = slots * bankSize
+	}
+	m.rom = make([]byte, size)
+	copy(m.rom[padding:], f.Program)
+
+	m.Reset()
+	return m
+}
+
+// SetExpansion connects the sound chip of one of the file's chip bits,
+// nil removes it
+func (m *Mapper) SetExpansion(chip uint8, expansion interface {
+	WriteRegister(address uint16, value uint8)
+}) {
+	if expansion == nil {
+		delete(m.Expansions, chip)
+		return
+	}
+	m.Expansions[chip] = expansion
+}
+
+// Reset restores the initial banks and clears the RAM, done before every track
+func (m *Mapper) Reset() {
+	for i := range m.ram {
+		m.ram[i] = 0
+	}
+	for i := range m.exram {
+		m.exram[i] = 0
+	}
+	m.multiplicand, m.multiplier = 0, 0
+
+	// Bankswitched FDS files start with $6000-$7FFF in the banks of $E000-$FFFF
+	if m.fdsRAM != nil {
+		for slot := 0; slot < fdsSlots; slot++ {
+			bank := uint8(slot)
+			if m.file.Bankswitched() {
+				bank = m.file.Banks[(slot+6)%8]
+			}
+			m.loadFDSBank(slot, bank)
+		}
+		return
+	}
+	if m.file.Bankswitched() {
+		m.banks = m.file.Banks
+	} else {
+		for i := range m.banks {
+			m.banks[i] = uint8(i)
+		}
+	}
+}
+
+// loadFDSBank copies a bank into one of the 4KB slots of the FDS RAM
+func (m *Mapper) loadFDSBank(slot int, bank uint8) {
+	offset := int(bank) * bankSize % len(m.rom)
+	copy(m.fdsRAM[slot*bankSize:(slot+1)*bankSize], m.rom[offset:])
+}
+
+// ReadPRG reads the driver, RAM, song data or expansion registers
+func (m *Mapper) ReadPRG(address uint16) (byte, bool) {
+	switch {
+	case address >= DriverAddress && address < DriverAddress+uint16(len(m.driver)):
+		return m.driver[address-DriverAddress], true
+	case m.fdsRAM != nil && address >= ramStart:
+		return m.fdsRAM[address-ramStart], true
+	case address >= romStart:
+		slot := (address - romStart) / bankSize
+		offset := int(m.banks[slot])*bankSize + int(address%bankSize)
+		return m.rom[offset%len(m.rom)], true
+	case address >= ramStart:
+		return m.ram[address-ramStart], true
+	}
+
+	if m.file.Chips&ChipFDS != 0 && (address >= 0x4040 && address < 0x4080 || address == 0x4090 || address == 0x4092) {
+		return m.readExpansion(ChipFDS, address)
+	}
+	if m.file.Chips&ChipN163 != 0 && address >= 0x4800 && address < 0x5000 {
+		return m.readExpansion(ChipN163, address)
+	}
+	if m.file.Chips&ChipMMC5 != 0 {
+		product := uint16(m.multiplicand) * uint16(m.multiplier)
+		switch {
+		case address >= mmc5ExRAMStart && address < mmc5ExRAMStart+mmc5ExRAMSize:
+			return m.exram[address-mmc5ExRAMStart], true
+		case address == 0x5205:
+			return byte(product), true
+		case address == 0x5206:
+			return byte(product >> 8), true
+		case address == 0x5015:
+			return m.readExpansion(ChipMMC5, address)
+		}
+	}
+	return 0, false
+}
+
+// WritePRG handles the bank registers, RAM and expansion sound registers
+func (m *Mapper) WritePRG(address uint16, value byte) {
+	switch {
+	case m.fdsRAM != nil && address >= fdsBankRegisterStart && address < ramStart:
+		m.loadFDSBank(int(address-fdsBankRegisterStart), value)
+	case m.fdsRAM != nil && address >= ramStart:
+		// $E000-$FFFF holds the BIOS on the real FDS and can't be written
+		if address < 0xE000 {
+			m.fdsRAM[address-ramStart] = value
+		}
+	case address >= 0x4040 && address <= 0x408A && m.file.Chips&ChipFDS != 0:
+		m.writeExpansion(ChipFDS, address, value)
+	case address >= bankRegisterStart && address < ramStart:
+		m.banks[address-bankRegisterStart] = value
+	case address >= ramStart && address < romStart:
+		m.ram[address-ramStart] = value
+	case address >= 0x9000 && address < 0xC000 && m.file.Chips&ChipVRC6 != 0:
+		m.writeExpansion(ChipVRC6, address&0xF003, value)
+	}
+
+	// The N163's data port, sound control and address port
+	if m.file.Chips&ChipN163 != 0 && (address >= 0x4800 && address < 0x5000 || address >= 0xE000 && address < 0xE800 || address >= 0xF800) {
+		m.writeExpansion(ChipN163, address, value)
+	}
+	// The Sunsoft 5B's register select and data
+	if m.file.Chips&ChipS5B != 0 && address >= 0xC000 {
+		m.writeExpansion(ChipS5B, address, value)
+	}
+
+	if m.file.Chips&ChipMMC5 != 0 {
+		switch {
+		case address >= mmc5ExRAMStart && address < mmc5ExRAMStart+mmc5ExRAMSize:
+			m.exram[address-mmc5ExRAMStart] = value
+		case address == 0x5205:
+			m.multiplicand = value
+		case address == 0x5206:
+			m.multiplier = value
+		case address >= 0x5000 && address <= 0x5015:
+			m.writeExpansion(ChipMMC5, address, value)
+		}
+	}
+}
+
+// readExpansion reads a register of a chip, if it has readable ones
+func (m *Mapper) readExpansion(chip uint8, address uint16) (byte, bool) {
+	expansion, ok := m.Expansions[chip].(interface{ ReadRegister(address uint16) uint8 })
+	if !ok {
+		return 0, false
+	}
+	return expansion.ReadRegister(address), true
+}
+
+// writeExpansion passes a register write to a chip
+func (m *Mapper) writeExpansion(chip uint8, address uint16, value uint8) {
+	if expansion := m.Expansions[chip]; expansion != nil {
+		expansion.WriteRegister(address, value)
+	}
+}
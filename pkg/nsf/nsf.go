@@ -0,0 +1,265 @@
+// Package nsf implements loading of NSF and NSFe music files
+package nsf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Expansion sound chips, bits of the NSF header's chip byte
+const (
+	ChipVRC6 uint8 = 1 << iota
+	ChipVRC7
+	ChipFDS
+	ChipMMC5
+	ChipN163
+	ChipS5B
+)
+
+// chipNames are the names of the expansion chips, in bit order
+var chipNames = []string{"VRC6", "VRC7", "FDS", "MMC5", "Namco 163", "Sunsoft 5B"}
+
+// Region flags of the NSF header
+const (
+	RegionPAL  uint8 = 0x01 // Tune is for PAL consoles
+	RegionDual uint8 = 0x02 // Tune plays on both
+)
+
+// Default play rates in microseconds, used when the file leaves them at 0
+const (
+	defaultSpeedNTSC = 16639
+	defaultSpeedPAL  = 19997
+)
+
+// nsfHeaderSize is the size of the NSF header
+const nsfHeaderSize = 0x80
+
+// File is a parsed NSF or NSFe file
+type File struct {
+	TotalSongs  int
+	StartSong   int // 1-based
+	LoadAddress uint16
+	InitAddress uint16
+	PlayAddress uint16
+
+	Title     string
+	Artist    string
+	Copyright string
+
+	SpeedNTSC uint16 // Microseconds between PLAY calls on NTSC
+	SpeedPAL  uint16 // Microseconds between PLAY calls on PAL
+
+	Banks   [8]uint8 // Initial bank of each 4KB slot at $8000-$FFFF
+	Region  uint8    // RegionPAL and RegionDual bits
+	Chips   uint8    // Expansion sound chips
+	Program []byte   // Song data and code, loaded at LoadAddress
+
+	// NSFe only, empty or 0 when unknown
+	TrackTitles    []string
+	TrackDurations []int // Milliseconds, -1 when unknown
+}
+
+// LoadFile reads an .nsf or .nsfe file
+func LoadFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return Parse(data)
+}
+
+// Parse decodes NSF or NSFe data, telling them apart by their signature
+func Parse(data []byte) (*File, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("NESM\x1A")):
+		return parseNSF(data)
+	case bytes.HasPrefix(data, []byte("NSFE")):
+		return parseNSFE(data)
+	}
+	return nil, errors.New("not an NSF or NSFe file")
+}
+
+// Bankswitched reports whether the tune uses the $5FF8-$5FFF bank registers
+func (f *File) Bankswitched() bool {
+	for _, bank := range f.Banks {
+		if bank != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// PAL reports whether the tune should play at PAL speed
+// Dual-region tunes play at NTSC speed
+func (f *File) PAL() bool {
+	return f.Region&RegionDual == 0 && f.Region&RegionPAL != 0
+}
+
+// ChipNames returns the names of the expansion chips in a set of chip bits
+func ChipNames(chips uint8) []string {
+	var names []string
+	for i, name := range chipNames {
+		if chips&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// TrackTitle returns the title of a 1-based track, or an empty string
+func (f *File) TrackTitle(song int) string {
+	if song < 1 || song > len(f.TrackTitles) {
+		return ""
+	}
+	return f.TrackTitles[song-1]
+}
+
+// TrackDuration returns the length of a 1-based track in milliseconds, or -1
+func (f *File) TrackDuration(song int) int {
+	if song < 1 || song > len(f.TrackDurations) {
+		return -1
+	}
+	return f.TrackDurations[song-1]
+}
+
+// parseNSF decodes the classic NSF format: a fixed 128-byte header and the program
+func parseNSF(data []byte) (*File, error) {
+	if len(data) < nsfHeaderSize {
+		return nil, fmt.Errorf("NSF file too short: %d bytes", len(data))
+	}
+
+	f := &File{
+		TotalSongs:  int(data[0x06]),
+		StartSong:   int(data[0x07]),
+		LoadAddress: binary.LittleEndian.Uint16(data[0x08:]),
+		InitAddress: binary.LittleEndian.Uint16(data[0x0A:]),
+		PlayAddress: binary.LittleEndian.Uint16(data[0x0C:]),
+		Title:       cString(data[0x0E:0x2E]),
+		Artist:      cString(data[0x2E:0x4E]),
+		Copyright:   cString(data[0x4E:0x6E]),
+		SpeedNTSC:   binary.LittleEndian.Uint16(data[0x6E:]),
+		SpeedPAL:    binary.LittleEndian.Uint16(data[0x78:]),
+		Region:      data[0x7A] & 0x03,
+		Chips:       data[0x7B],
+		Program:     data[nsfHeaderSize:],
+	}
+	copy(f.Banks[:], data[0x70:0x78])
+
+	// NSF2 can give the program length, anything after it is metadata
+	length := int(data[0x7D]) | int(data[0x7E])<<8 | int(data[0x7F])<<16
+	if data[0x05] >= 2 && length > 0 && length < len(f.Program) {
+		f.Program = f.Program[:length]
+	}
+
+	return f, f.validate()
+}
+
+// parseNSFE decodes the chunked NSFe format
+func parseNSFE(data []byte) (*File, error) {
+	f := &File{}
+	hasInfo, hasData := false, false
+
+	offset := 4
+	for offset+8 <= len(data) {
+		size := int(binary.LittleEndian.Uint32(data[offset:]))
+		id := string(data[offset+4 : offset+8])
+		offset += 8
+		if size < 0 || offset+size > len(data) {
+			return nil, fmt.Errorf("NSFe chunk %q runs past the end of the file", id)
+		}
+		chunk := data[offset : offset+size]
+		offset += size
+
+		switch id {
+		case "INFO":
+			if len(chunk) < 9 {
+				return nil, errors.New("NSFe INFO chunk too short")
+			}
+			f.LoadAddress = binary.LittleEndian.Uint16(chunk[0:])
+			f.InitAddress = binary.LittleEndian.Uint16(chunk[2:])
+			f.PlayAddress = binary.LittleEndian.Uint16(chunk[4:])
+			f.Region = chunk[6] & 0x03
+			f.Chips = chunk[7]
+			f.TotalSongs = int(chunk[8])
+			f.StartSong = 1
+			if len(chunk) > 9 {
+				f.StartSong = int(chunk[9]) + 1
+			}
+			hasInfo = true
+		case "DATA":
+			f.Program = chunk
+			hasData = true
+		case "BANK":
+			copy(f.Banks[:], chunk)
+		case "RATE":
+			if len(chunk) >= 2 {
+				f.SpeedNTSC = binary.LittleEndian.Uint16(chunk[0:])
+			}
+			if len(chunk) >= 4 {
+				f.SpeedPAL = binary.LittleEndian.Uint16(chunk[2:])
+			}
+		case "auth":
+			fields := strings.Split(string(chunk), "\x00")
+			for i, target := range []*string{&f.Title, &f.Artist, &f.Copyright} {
+				if i < len(fields) {
+					*target = fields[i]
+				}
+			}
+		case "tlbl":
+			f.TrackTitles = strings.Split(strings.TrimSuffix(string(chunk), "\x00"), "\x00")
+		case "time":
+			for i := 0; i+4 <= len(chunk); i += 4 {
+				f.TrackDurations = append(f.TrackDurations, int(int32(binary.LittleEndian.Uint32(chunk[i:]))))
+			}
+		case "NEND":
+			offset = len(data)
+		default:
+			// Chunks starting with an uppercase letter must be understood
+			if id[0] >= 'A' && id[0] <= 'Z' {
+				return nil, fmt.Errorf("unsupported NSFe chunk %q", id)
+			}
+		}
+	}
+
+	if !hasInfo || !hasData {
+		return nil, errors.New("NSFe file without INFO or DATA chunk")
+	}
+	return f, f.validate()
+}
+
+// validate fills in defaults and checks the fields needed to play the file
+func (f *File) validate() error {
+	if f.TotalSongs < 1 {
+		return errors.New("NSF file has no songs")
+	}
+	if f.StartSong < 1 || f.StartSong > f.TotalSongs {
+		f.StartSong = 1
+	}
+	if f.SpeedNTSC == 0 {
+		f.SpeedNTSC = defaultSpeedNTSC
+	}
+	if f.SpeedPAL == 0 {
+		f.SpeedPAL = defaultSpeedPAL
+	}
+	// FDS files may load into the RAM at $6000
+	lowest := uint16(romStart)
+	if f.Chips&ChipFDS != 0 {
+		lowest = ramStart
+	}
+	if !f.Bankswitched() && f.LoadAddress < lowest {
+		return fmt.Errorf("invalid NSF load address $%04X", f.LoadAddress)
+	}
+	return nil
+}
+
+// cString converts a zero-padded string field
+func cString(field []byte) string {
+	if i := bytes.IndexByte(field, 0); i >= 0 {
+		field = field[:i]
+	}
+	return string(field)
+}
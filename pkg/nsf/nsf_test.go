@@ -0,0 +1,386 @@
+package nsf
+
+import (
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// nsfHeader builds a classic NSF file around a program
+func nsfHeader(songs, start uint8, load uint16, program []byte) []byte {
+	data := make([]byte, nsfHeaderSize, nsfHeaderSize+len(program))
+	copy(data, "NESM\x1A\x01")
+	data[0x06] = songs
+	data[0x07] = start
+	binary.LittleEndian.PutUint16(data[0x08:], load)
+	binary.LittleEndian.PutUint16(data[0x0A:], load+0x10)
+	binary.LittleEndian.PutUint16(data[0x0C:], load+0x20)
+	copy(data[0x0E:], "Title")
+	copy(data[0x2E:], "Artist")
+	copy(data[0x4E:], "2024 Someone")
+	return append(data, program...)
+}
+
+// nsfeChunk encodes one NSFe chunk
+func nsfeChunk(id string, payload []byte) []byte {
+	chunk := make([]byte, 8, 8+len(payload))
+	binary.LittleEndian.PutUint32(chunk, uint32(len(payload)))
+	copy(chunk[4:], id)
+	return append(chunk, payload...)
+}
+
+// nsfeFile joins chunks behind the NSFe signature
+func nsfeFile(chunks ...[]byte) []byte {
+	data := []byte("NSFE")
+	for _, chunk := range chunks {
+		data = append(data, chunk...)
+	}
+	return data
+}
+
+// nsfeInfo builds an INFO chunk payload
+func nsfeInfo(load uint16, chips, songs, start uint8) []byte {
+	info := make([]byte, 10)
+	binary.LittleEndian.PutUint16(info[0:], load)
+	binary.LittleEndian.PutUint16(info[2:], load+0x10)
+	binary.LittleEndian.PutUint16(info[4:], load+0x20)
+	info[7] = chips
+	info[8] = songs
+	info[9] = start
+	return info
+}
+
+func TestParseNSF(t *testing.T) {
+	program := []byte{0xA9, 0x00, 0x60}
+
+	bankswitched := nsfHeader(3, 1, 0x8000, program)
+	copy(bankswitched[0x70:], []byte{0, 1, 2, 3, 4, 5, 6, 7})
+
+	nsf2 := nsfHeader(1, 1, 0x8000, append(append([]byte{}, program...), "metadata"...))
+	nsf2[0x05] = 2
+	nsf2[0x7D] = byte(len(program))
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    *File
+		wantErr string
+	}{
+		{
+			name: "plain",
+			data: nsfHeader(5, 2, 0x8000, program),
+			want: &File{
+				TotalSongs: 5, StartSong: 2,
+				LoadAddress: 0x8000, InitAddress: 0x8010, PlayAddress: 0x8020,
+				Title: "Title", Artist: "Artist", Copyright: "2024 Someone",
+				SpeedNTSC: defaultSpeedNTSC, SpeedPAL: defaultSpeedPAL,
+				Program: program,
+			},
+		},
+		{
+			name: "start song out of range",
+			data: nsfHeader(2, 9, 0x8000, program),
+			want: &File{
+				TotalSongs: 2, StartSong: 1,
+				LoadAddress: 0x8000, InitAddress: 0x8010, PlayAddress: 0x8020,
+				Title: "Title", Artist: "Artist", Copyright: "2024 Someone",
+				SpeedNTSC: defaultSpeedNTSC, SpeedPAL: defaultSpeedPAL,
+				Program: program,
+			},
+		},
+		{
+			name: "bankswitched",
+			data: bankswitched,
+			want: &File{
+				TotalSongs: 3, StartSong: 1,
+				LoadAddress: 0x8000, InitAddress: 0x8010, PlayAddress: 0x8020,
+				Title: "Title", Artist: "Artist", Copyright: "2024 Someone",
+				SpeedNTSC: defaultSpeedNTSC, SpeedPAL: defaultSpeedPAL,
+				Banks:   [8]uint8{0, 1, 2, 3, 4, 5, 6, 7},
+				Program: program,
+			},
+		},
+		{
+			name: "NSF2 program length",
+			data: nsf2,
+			want: &File{
+				TotalSongs: 1, StartSong: 1,
+				LoadAddress: 0x8000, InitAddress: 0x8010, PlayAddress: 0x8020,
+				Title: "Title", Artist: "Artist", Copyright: "2024 Someone",
+				SpeedNTSC: defaultSpeedNTSC, SpeedPAL: defaultSpeedPAL,
+				Program: program,
+			},
+		},
+		{name: "unknown signature", data: []byte("NES\x1A"), wantErr: "not an NSF"},
+		{name: "truncated header", data: nsfHeader(1, 1, 0x8000, nil)[:0x40], wantErr: "too short"},
+		{name: "no songs", data: nsfHeader(0, 1, 0x8000, program), wantErr: "no songs"},
+		{name: "load address in RAM", data: nsfHeader(1, 1, 0x6000, program), wantErr: "load address"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.data)
+			checkParse(t, got, err, tt.want, tt.wantErr)
+		})
+	}
+}
+
+func TestParseNSFE(t *testing.T) {
+	program := []byte{0xEA, 0x60}
+	auth := []byte("Song\x00Composer\x00Label\x00")
+	labels := []byte("First\x00Second\x00")
+	times := make([]byte, 8)
+	binary.LittleEndian.PutUint32(times[0:], 90000)
+	binary.LittleEndian.PutUint32(times[4:], 0xFFFFFFFF)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    *File
+		wantErr string
+	}{
+		{
+			name: "all chunks",
+			data: nsfeFile(
+				nsfeChunk("INFO", nsfeInfo(0x8000, ChipVRC6, 2, 1)),
+				nsfeChunk("DATA", program),
+				nsfeChunk("RATE", []byte{0x1A, 0x41, 0x20, 0x4E}),
+				nsfeChunk("auth", auth),
+				nsfeChunk("tlbl", labels),
+				nsfeChunk("time", times),
+				nsfeChunk("text", []byte("ignored")),
+				nsfeChunk("NEND", nil),
+			),
+			want: &File{
+				TotalSongs: 2, StartSong: 2,
+				LoadAddress: 0x8000, InitAddress: 0x8010, PlayAddress: 0x8020,
+				Title: "Song", Artist: "Composer", Copyright: "Label",
+				SpeedNTSC: 0x411A, SpeedPAL: 0x4E20,
+				Chips:          ChipVRC6,
+				Program:        program,
+				TrackTitles:    []string{"First", "Second"},
+				TrackDurations: []int{90000, -1},
+			},
+		},
+		{
+			name:    "chunk past the end",
+			data:    nsfeFile(nsfeChunk("INFO", nsfeInfo(0x8000, 0, 1, 0)))[:12],
+			wantErr: "runs past the end",
+		},
+		{
+			name:    "short INFO",
+			data:    nsfeFile(nsfeChunk("INFO", []byte{0, 0x80}), nsfeChunk("DATA", program)),
+			wantErr: "INFO chunk too short",
+		},
+		{
+			name:    "missing DATA",
+			data:    nsfeFile(nsfeChunk("INFO", nsfeInfo(0x8000, 0, 1, 0))),
+			wantErr: "without INFO or DATA",
+		},
+		{
+			name: "unknown required chunk",
+			data: nsfeFile(
+				nsfeChunk("INFO", nsfeInfo(0x8000, 0, 1, 0)),
+				nsfeChunk("DATA", program),
+				nsfeChunk("XTRA", nil),
+			),
+			wantErr: "unsupported NSFe chunk",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.data)
+			checkParse(t, got, err, tt.want, tt.wantErr)
+		})
+	}
+}
+
+// checkParse compares the result of Parse with the expected file or error
+func checkParse(t *testing.T, got *File, err error, want *File, wantErr string) {
+	t.Helper()
+	if wantErr != "" {
+		if err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Fatalf("Parse() error = %v, want it to contain %q", err, wantErr)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse() = %+v, want %+v", got, want)
+	}
+}
+
+func TestTrackInfo(t *testing.T) {
+	f := &File{TrackTitles: []string{"One"}, TrackDurations: []int{1000, -1}}
+	tests := []struct {
+		song     int
+		title    string
+		duration int
+	}{
+		{1, "One", 1000},
+		{2, "", -1},
+		{3, "", -1},
+	}
+	for _, tt := range tests {
+		if title := f.TrackTitle(tt.song); title != tt.title {
+			t.Errorf("TrackTitle(%d) = %q, want %q", tt.song, title, tt.title)
+		}
+		if duration := f.TrackDuration(tt.song); duration != tt.duration {
+			t.Errorf("TrackDuration(%d) = %d, want %d", tt.song, duration, tt.duration)
+		}
+	}
+}
+
+// testChip records the register writes it receives
+type testChip struct {
+	writes map[uint16]uint8
+}
+
+func (c *testChip) WriteRegister(address uint16, value uint8) {
+	c.writes[address] = value
+}
+
+func (c *testChip) ReadRegister(address uint16) uint8 {
+	return c.writes[address] ^ 0xFF
+}
+
+func TestMapperExpansions(t *testing.T) {
+	f, err := Parse(nsfHeader(1, 1, 0x8000, []byte{0x60}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Chips = ChipVRC6 | ChipMMC5
+	m := NewMapper(f)
+	vrc6 := &testChip{writes: map[uint16]uint8{}}
+	mmc5 := &testChip{writes: map[uint16]uint8{}}
+	m.SetExpansion(ChipVRC6, vrc6)
+	m.SetExpansion(ChipMMC5, mmc5)
+
+	m.WritePRG(0x9001, 0x11)
+	m.WritePRG(0xB00E, 0x22) // Mirror of $B002
+	m.WritePRG(0x5003, 0x33)
+	if vrc6.writes[0x9001] != 0x11 || vrc6.writes[0xB002] != 0x22 {
+		t.Errorf("VRC6 writes = %v", vrc6.writes)
+	}
+	if mmc5.writes[0x5003] != 0x33 || len(mmc5.writes) != 1 {
+		t.Errorf("MMC5 writes = %v", mmc5.writes)
+	}
+
+	m.WritePRG(0x5015, 0x03)
+	if value, ok := m.ReadPRG(0x5015); !ok || value != 0xFC {
+		t.Errorf("$5015 = %#02x, %v, want the chip's register", value, ok)
+	}
+
+	// The MMC5's multiplier and extended RAM
+	m.WritePRG(0x5205, 200)
+	m.WritePRG(0x5206, 100)
+	low, _ := m.ReadPRG(0x5205)
+	high, _ := m.ReadPRG(0x5206)
+	if product := uint16(high)<<8 | uint16(low); product != 20000 {
+		t.Errorf("product = %d, want 20000", product)
+	}
+	m.WritePRG(0x5C10, 0x44)
+	if value, ok := m.ReadPRG(0x5C10); !ok || value != 0x44 {
+		t.Errorf("extended RAM = %#02x, %v, want %#02x", value, ok, 0x44)
+	}
+	if _, ok := m.ReadPRG(0x5FF6); ok {
+		t.Error("$5FF6 read as extended RAM")
+	}
+}
+
+func TestMapperFDS(t *testing.T) {
+	t.Run("flat", func(t *testing.T) {
+		data := nsfHeader(1, 1, 0x6000, []byte{0x11, 0x22})
+		data[0x7B] = ChipFDS
+		f, err := Parse(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := NewMapper(f)
+		fds := &testChip{writes: map[uint16]uint8{}}
+		m.SetExpansion(ChipFDS, fds)
+
+		if value, _ := m.ReadPRG(0x6001); value != 0x22 {
+			t.Errorf("$6001 = %#02x, want %#02x", value, 0x22)
+		}
+		m.WritePRG(0x9000, 0x33) // RAM, not the VRC6
+		if value, _ := m.ReadPRG(0x9000); value != 0x33 {
+			t.Errorf("$9000 = %#02x after a write, want %#02x", value, 0x33)
+		}
+		m.WritePRG(0xE000, 0x44)
+		if value, _ := m.ReadPRG(0xE000); value != 0 {
+			t.Errorf("$E000 = %#02x after a write, want it unchanged", value)
+		}
+
+		m.WritePRG(0x4089, 0x80)
+		m.WritePRG(0x4040, 0x3F)
+		if fds.writes[0x4089] != 0x80 || fds.writes[0x4040] != 0x3F {
+			t.Errorf("FDS writes = %v", fds.writes)
+		}
+		if value, ok := m.ReadPRG(0x4040); !ok || value != 0xC0 {
+			t.Errorf("$4040 = %#02x, %v, want the chip's register", value, ok)
+		}
+
+		m.Reset()
+		if value, _ := m.ReadPRG(0x9000); value != 0 {
+			t.Errorf("$9000 = %#02x after a reset, want 0", value)
+		}
+	})
+
+	t.Run("bankswitched", func(t *testing.T) {
+		program := make([]byte, 8*bankSize)
+		for bank := range 8 {
+			program[bank*bankSize] = byte(0xB0 + bank)
+		}
+		data := nsfHeader(1, 1, 0x8000, program)
+		data[0x7B] = ChipFDS
+		copy(data[0x70:], []byte{0, 1, 2, 3, 4, 5, 6, 7})
+		f, err := Parse(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := NewMapper(f)
+
+		// $6000 and $7000 start with the banks of $E000 and $F000
+		for address, want := range map[uint16]byte{0x6000: 0xB6, 0x7000: 0xB7, 0x8000: 0xB0, 0xF000: 0xB7} {
+			if value, _ := m.ReadPRG(address); value != want {
+				t.Errorf("$%04X = %#02x, want %#02x", address, value, want)
+			}
+		}
+		m.WritePRG(0x5FF6, 3)
+		if value, _ := m.ReadPRG(0x6000); value != 0xB3 {
+			t.Errorf("$6000 = %#02x after switching, want %#02x", value, 0xB3)
+		}
+	})
+}
+
+func TestMapperN163AndS5B(t *testing.T) {
+	f, err := Parse(nsfHeader(1, 1, 0x8000, []byte{0x60}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Chips = ChipN163 | ChipS5B
+	m := NewMapper(f)
+	n163 := &testChip{writes: map[uint16]uint8{}}
+	s5b := &testChip{writes: map[uint16]uint8{}}
+	m.SetExpansion(ChipN163, n163)
+	m.SetExpansion(ChipS5B, s5b)
+
+	m.WritePRG(0xF800, 0x11)
+	m.WritePRG(0x4800, 0x22)
+	m.WritePRG(0xC000, 0x33)
+	m.WritePRG(0x9000, 0x44) // Neither chip's
+	if len(n163.writes) != 2 || n163.writes[0xF800] != 0x11 || n163.writes[0x4800] != 0x22 {
+		t.Errorf("N163 writes = %v", n163.writes)
+	}
+	if len(s5b.writes) != 2 || s5b.writes[0xF800] != 0x11 || s5b.writes[0xC000] != 0x33 {
+		t.Errorf("Sunsoft 5B writes = %v", s5b.writes)
+	}
+	if value, ok := m.ReadPRG(0x4800); !ok || value != 0xDD {
+		t.Errorf("$4800 = %#02x, %v, want the chip's register", value, ok)
+	}
+}
@@ -0,0 +1,37 @@
+// Package nsf implements loading of NSF and NSFe music files
+package nsf
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+
+	"github.com/example/my-golang-project/pkg/savestate"
+)
+
+// Serialize saves or loads the work RAM, the bank registers, and the FDS
+// RAM and MMC5 extras of files that use them
+func (m *Mapper) Serialize(s *savestate.Serializer) {
+	s.Section("NSF ")
+	s.Bytes(m.ram[:])
+	s.Bytes(m.banks[:])
+	if m.fdsRAM != nil {
+		s.Bytes(m.fdsRAM)
+	}
+	if m.file.Chips&ChipMMC5 != 0 {
+		s.Bytes(m.exram[:])
+		s.Uint8(&m.multiplicand)
+		s.Uint8(&m.multiplier)
+	}
+}
+
+// Checksum identifies the loaded program, so a state is only loaded with the
+// file it was saved with: the song data, its load address, the initial banks
+// and the INIT and PLAY addresses
+func (m *Mapper) Checksum() uint32 {
+	var load [2]byte
+	binary.LittleEndian.PutUint16(load[:], m.file.LoadAddress)
+	crc := crc32.ChecksumIEEE(load[:])
+	crc = crc32.Update(crc, crc32.IEEETable, m.file.Program)
+	crc = crc32.Update(crc, crc32.IEEETable, m.file.Banks[:])
+	return crc32.Update(crc, crc32.IEEETable, m.driver[:])
+}
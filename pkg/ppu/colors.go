@@ -75,7 +75,62 @@ var NESPalette = []color.RGBA{
 	{0x00, 0x00, 0x00, 0xFF}, // 0x3F - Negro
 }
 
+// emphasisAttenuation es cuánto se atenúa cada canal no enfatizado
+const emphasisAttenuation = 0.816328
+
+// EmphasisPalette contiene NESPalette con cada combinación de los bits de
+// énfasis de PPUMASK, indexada como énfasis<<6 | color
+var EmphasisPalette = buildEmphasisPalette(NESPalette, false)
+
 // GetColor devuelve el color RGBA correspondiente al índice de la paleta
 func GetColor(paletteIndex uint8) color.RGBA {
 	return NESPalette[paletteIndex&0x3F]
 }
+
+// GetEmphasizedColor devuelve el color RGBA de un índice de 9 bits
+// (bits 0-5 color, bits 6-8 énfasis rojo/verde/azul)
+func GetEmphasizedColor(index uint16) color.RGBA {
+	return EmphasisPalette[index&0x1FF]
+}
+
+// buildEmphasisPalette genera las 512 entradas a partir de los 64 colores base
+// En los PPU compuestos cada bit de énfasis oscurece los otros canales,
+// en los PPU RGB (rgb = true) pone los canales enfatizados al máximo
+func buildEmphasisPalette(base []color.RGBA, rgb bool) ColorPalette {
+	var palette ColorPalette
+	for emphasis := 0; emphasis < 8; emphasis++ {
+		for i := 0; i < 64; i++ {
+			c := base[i]
+			r, g, b := float64(c.R), float64(c.G), float64(c.B)
+
+			if rgb {
+				if emphasis&0x01 != 0 {
+					r = 0xFF
+				}
+				if emphasis&0x02 != 0 {
+					g = 0xFF
+				}
+				if emphasis&0x04 != 0 {
+					b = 0xFF
+				}
+			} else {
+				// Cada bit activo atenúa los otros dos canales
+				if emphasis&0x01 != 0 {
+					g *= emphasisAttenuation
+					b *= emphasisAttenuation
+				}
+				if emphasis&0x02 != 0 {
+					r *= emphasisAttenuation
+					b *= emphasisAttenuation
+				}
+				if emphasis&0x04 != 0 {
+					r *= emphasisAttenuation
+					g *= emphasisAttenuation
+				}
+			}
+
+			palette[emphasis<<6|i] = color.RGBA{uint8(r), uint8(g), uint8(b), 0xFF}
+		}
+	}
+	return palette
+}
@@ -0,0 +1,73 @@
+// Package ppu implements the NES Picture Processing Unit emulation
+package ppu
+
+import (
+	"hash/fnv"
+	"image"
+)
+
+const (
+	// FrameWidth is the width of the PPU output in pixels
+	FrameWidth = 256
+
+	// FrameHeight is the height of the PPU output in pixels
+	FrameHeight = 240
+)
+
+// Frame returns the palette indices of the last complete frame, row by row
+// Each entry has 9 bits: bits 0-5 are the color and bits 6-8 the red, green
+// and blue emphasis, so it is exactly what the PPU output, before any palette
+// The slice belongs to the PPU and is overwritten once the next frame starts rendering
+func (p *PPU) Frame() []uint16 {
+	return p.frontIndices
+}
+
+// FramePhase returns the NTSC subcarrier phase at the start of the last
+// complete frame, in twelfths of a cycle
+func (p *PPU) FramePhase() int {
+	return p.frontPhase
+}
+
+// HashFrame returns a hash of a frame's palette indices, so frames can be
+// compared without depending on the palette in use
+func HashFrame(frame []uint16) uint64 {
+	h := fnv.New64a()
+	buf := make([]byte, 2*len(frame))
+	for i, index := range frame {
+		buf[i*2] = byte(index)
+		buf[i*2+1] = byte(index >> 8)
+	}
+	h.Write(buf)
+	return h.Sum64()
+}
+
+// RenderFrame converts a frame of palette indices to RGBA with the given palette
+// If dst is nil or the wrong size a new image is allocated
+func RenderFrame(frame []uint16, palette *ColorPalette, dst *image.RGBA) *image.RGBA {
+	if dst == nil || dst.Rect.Dx() != FrameWidth || dst.Rect.Dy() != FrameHeight {
+		dst = image.NewRGBA(image.Rect(0, 0, FrameWidth, FrameHeight))
+	}
+
+	for i, index := range frame {
+		c := palette[index&0x1FF]
+		offset := i * 4
+		dst.Pix[offset] = c.R
+		dst.Pix[offset+1] = c.G
+		dst.Pix[offset+2] = c.B
+		dst.Pix[offset+3] = 0xFF
+	}
+	return dst
+}
+
+// RenderingFrame returns the RGBA pixels of the frame being rendered, row by row
+// Only the pixels before RenderPosition belong to this frame, the rest are
+// still those of the frame before the last one
+func (p *PPU) RenderingFrame() []uint8 {
+	return p.backBuffer
+}
+
+// RenderPosition returns the scanline and dot the PPU is about to draw
+// Scanlines past the visible area mean the frame is complete
+func (p *PPU) RenderPosition() (scanline, dot int) {
+	return p.Scanline, p.Cycle
+}
@@ -0,0 +1,221 @@
+// Package ppu implements the NES Picture Processing Unit emulation
+package ppu
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+const (
+	// NTSCWidth is the width of an image produced by the NTSC filter
+	NTSCWidth = 602
+
+	// ntscSamplesPerDot is how many signal samples the PPU outputs per pixel,
+	// the color subcarrier lasts 12 samples
+	ntscSamplesPerDot = 8
+
+	// Voltage levels relative to sync of the composite signal
+	ntscBlack       = 0.518
+	ntscWhite       = 1.962
+	ntscAttenuation = 0.746
+
+	// ntscPhaseOffset lines the decoder's color burst reference up with the
+	// PPU's hues, in samples
+	ntscPhaseOffset = 3.9
+)
+
+// ntscLevels holds the low and high voltages of the square wave for each
+// of the four brightness levels
+var ntscLevels = [8]float64{
+	0.350, 0.518, 0.962, 1.550, // Signal low
+	1.094, 1.506, 1.962, 1.962, // Signal high
+}
+
+// NTSCFilter turns palette indices into an image that looks like the
+// console's composite output, with color fringing and dot crawl
+// It works on the PPU's palette indices, so it runs on the CPU without a GPU
+type NTSCFilter struct {
+	Sharpness  float64 // 0 is soft, 1 is sharp
+	Saturation float64 // Chroma gain, 1 is neutral
+	Hue        float64 // Hue shift in degrees
+	DotCrawl   bool    // Let the subcarrier phase move from frame to frame
+
+	signal []float64 // Composite signal of the scanline being decoded
+	output *image.RGBA
+
+	// Subcarrier reference for each of the 12 phases, hue shift included
+	cosTable [12]float64
+	sinTable [12]float64
+}
+
+// NTSCOptions are the user settings of the NTSC filter
+type NTSCOptions struct {
+	Sharpness  float64 // 0 is soft, 1 is sharp
+	Saturation float64 // Chroma gain, 0 is grayscale and 1 is neutral
+}
+
+// DefaultNTSCOptions returns the neutral settings
+func DefaultNTSCOptions() NTSCOptions {
+	return NTSCOptions{Sharpness: 0.5, Saturation: 1.0}
+}
+
+// NewNTSCFilter creates an NTSC filter with neutral settings
+func NewNTSCFilter() *NTSCFilter {
+	options := DefaultNTSCOptions()
+	return &NTSCFilter{
+		Sharpness:  options.Sharpness,
+		Saturation: options.Saturation,
+		Hue:        0,
+		DotCrawl:   true,
+		signal:     make([]float64, 256*ntscSamplesPerDot),
+		output:     image.NewRGBA(image.Rect(0, 0, NTSCWidth, 240)),
+	}
+}
+
+// SetOptions applies the user settings, keeping the current ones if they are out of range
+func (f *NTSCFilter) SetOptions(options NTSCOptions) error {
+	if options.Sharpness < 0 || options.Sharpness > 1 {
+		return fmt.Errorf("NTSC sharpness must be between 0 and 1, got %g", options.Sharpness)
+	}
+	if options.Saturation < 0 || options.Saturation > 2 {
+		return fmt.Errorf("NTSC saturation must be between 0 and 2, got %g", options.Saturation)
+	}
+	f.Sharpness = options.Sharpness
+	f.Saturation = options.Saturation
+	return nil
+}
+
+// FilterFrame filters the last complete frame of the PPU
+// The returned image is reused by the next call
+func (f *NTSCFilter) FilterFrame(p *PPU) *image.RGBA {
+	phase := 0
+	if f.DotCrawl {
+		phase = p.FramePhase()
+	}
+	return f.Filter(p.Frame(), phase)
+}
+
+// Filter converts a 256x240 buffer of 9-bit palette indices into a
+// NTSCWidth x 240 image, starting the frame at the given subcarrier phase
+// The returned image is reused by the next call
+func (f *NTSCFilter) Filter(indices []uint16, phase int) *image.RGBA {
+	hue := f.Hue * math.Pi / 180
+	for i := 0; i < 12; i++ {
+		angle := math.Pi*(float64(i)+ntscPhaseOffset)/6 + hue
+		f.cosTable[i] = math.Cos(angle)
+		f.sinTable[i] = math.Sin(angle)
+	}
+
+	for y := 0; y < 240; y++ {
+		// Every scanline is 341 dots long, which shifts the subcarrier
+		linePhase := (phase + y*341*ntscSamplesPerDot) % 12
+		f.encodeScanline(indices[y*256:(y+1)*256], linePhase)
+		f.decodeScanline(y, linePhase)
+	}
+	return f.output
+}
+
+// encodeScanline generates the composite signal for one line of pixels
+func (f *NTSCFilter) encodeScanline(pixels []uint16, phase int) {
+	for x, pixel := range pixels {
+		for s := 0; s < ntscSamplesPerDot; s++ {
+			sample := x*ntscSamplesPerDot + s
+			f.signal[sample] = ntscSignal(pixel, phase+sample)
+		}
+	}
+}
+
+// ntscSignal returns the normalized signal level of a pixel at a subcarrier phase
+func ntscSignal(pixel uint16, phase int) float64 {
+	hue := int(pixel & 0x0F)
+	level := int(pixel>>4) & 0x03
+	emphasis := pixel >> 6
+
+	// Colors $xE and $xF are black at level 1
+	if hue > 13 {
+		level = 1
+	}
+
+	low := ntscLevels[level]
+	high := ntscLevels[4+level]
+	if hue == 0 {
+		low = high // Grays only output the high level
+	}
+	if hue > 12 {
+		high = low // Blacks only output the low level
+	}
+
+	inPhase := func(hue int) bool {
+		return (hue+phase)%12 < 6
+	}
+
+	signal := low
+	if inPhase(hue) {
+		signal = high
+	}
+
+	// Emphasis attenuates the signal during part of each subcarrier cycle
+	if (emphasis&0x01 != 0 && inPhase(0)) ||
+		(emphasis&0x02 != 0 && inPhase(4)) ||
+		(emphasis&0x04 != 0 && inPhase(8)) {
+		signal *= ntscAttenuation
+	}
+
+	return (signal - ntscBlack) / (ntscWhite - ntscBlack)
+}
+
+// decodeScanline demodulates the composite signal back into RGB the way a TV does
+func (f *NTSCFilter) decodeScanline(y int, phase int) {
+	// A narrower luma window keeps more detail
+	lumaHalf := 6 - int(math.Round(f.Sharpness*4))
+	if lumaHalf < 2 {
+		lumaHalf = 2
+	}
+	if lumaHalf > 6 {
+		lumaHalf = 6
+	}
+
+	samples := len(f.signal)
+
+	for x := 0; x < NTSCWidth; x++ {
+		center := x * samples / NTSCWidth
+
+		var luma, i, q float64
+		for s := center - 6; s < center+6; s++ {
+			if s < 0 || s >= samples {
+				continue
+			}
+			level := f.signal[s]
+
+			if s >= center-lumaHalf && s < center+lumaHalf {
+				luma += level / float64(2*lumaHalf)
+			}
+
+			i += level * f.cosTable[(phase+s)%12] / 12
+			q += level * f.sinTable[(phase+s)%12] / 12
+		}
+
+		i *= 2 * f.Saturation
+		q *= 2 * f.Saturation
+
+		f.output.SetRGBA(x, y, color.RGBA{
+			ntscClamp(luma + 0.946882*i + 0.623557*q),
+			ntscClamp(luma - 0.274788*i - 0.635691*q),
+			ntscClamp(luma - 1.108545*i + 1.709007*q),
+			0xFF,
+		})
+	}
+}
+
+// ntscClamp converts a decoded channel to an 8-bit value
+func ntscClamp(value float64) uint8 {
+	if value <= 0 {
+		return 0
+	}
+	if value >= 1 {
+		return 0xFF
+	}
+	return uint8(value * 255)
+}
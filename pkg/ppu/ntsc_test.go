@@ -0,0 +1,87 @@
+package ppu
+
+import (
+	"image/color"
+	"testing"
+)
+
+// closeRGBA reports whether two colors differ by at most 1 per channel,
+// the rounding error of the decoder
+func closeRGBA(a, b color.RGBA) bool {
+	near := func(x, y uint8) bool {
+		return x-y <= 1 || y-x <= 1
+	}
+	return near(a.R, b.R) && near(a.G, b.G) && near(a.B, b.B) && a.A == b.A
+}
+
+// solidFrame returns a frame filled with one palette index
+func solidFrame(index uint16) []uint16 {
+	frame := make([]uint16, FrameWidth*FrameHeight)
+	for i := range frame {
+		frame[i] = index
+	}
+	return frame
+}
+
+func TestNTSCFilterSolid(t *testing.T) {
+	tests := []struct {
+		name  string
+		index uint16
+		want  color.RGBA
+	}{
+		{"white", 0x20, color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}},
+		{"gray", 0x10, color.RGBA{174, 174, 174, 0xFF}},
+		{"black", 0x0F, color.RGBA{0, 0, 0, 0xFF}},
+	}
+
+	f := NewNTSCFilter()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := f.Filter(solidFrame(tt.index), 0)
+			if w, h := img.Rect.Dx(), img.Rect.Dy(); w != NTSCWidth || h != FrameHeight {
+				t.Fatalf("size = %dx%d, want %dx%d", w, h, NTSCWidth, FrameHeight)
+			}
+			// The edges fade, the decoder's window runs past the picture there
+			for y := 0; y < FrameHeight; y++ {
+				for x := 4; x < NTSCWidth-4; x++ {
+					if got := img.RGBAAt(x, y); !closeRGBA(got, tt.want) {
+						t.Fatalf("pixel (%d, %d) = %v, want %v", x, y, got, tt.want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestNTSCFilterColor(t *testing.T) {
+	f := NewNTSCFilter()
+	red := f.Filter(solidFrame(0x16), 0)
+	first := red.RGBAAt(NTSCWidth/2, 0)
+	if first.R <= first.G || first.R <= first.B {
+		t.Errorf("color $16 decodes to %v, want red", first)
+	}
+
+	// The same frame and phase give the same image
+	pixels := append([]uint8(nil), red.Pix...)
+	again := f.Filter(solidFrame(0x16), 0)
+	for i := range pixels {
+		if again.Pix[i] != pixels[i] {
+			t.Fatalf("byte %d differs between two runs: %d, %d", i, again.Pix[i], pixels[i])
+		}
+	}
+
+	// A line moves the subcarrier phase on by 341*8 samples, 4 of 12, so
+	// lines 3 apart start on the same phase
+	for x := 4; x < NTSCWidth-4; x++ {
+		if a, b := red.RGBAAt(x, 0), red.RGBAAt(x, 3); a != b {
+			t.Fatalf("pixel %d of lines 0 and 3 = %v, %v, want them equal", x, a, b)
+		}
+	}
+
+	// Grayscale has no chroma left
+	f.Saturation = 0
+	gray := f.Filter(solidFrame(0x16), 0).RGBAAt(NTSCWidth/2, 0)
+	if gray.R != gray.G || gray.G != gray.B {
+		t.Errorf("color $16 with saturation 0 = %v, want gray", gray)
+	}
+}
@@ -0,0 +1,145 @@
+// Package ppu implements the NES Picture Processing Unit emulation
+package ppu
+
+import (
+	"fmt"
+	"image/color"
+	"os"
+	"strings"
+)
+
+// ColorPalette maps 9-bit palette indices (color plus emphasis) to RGBA
+type ColorPalette [512]color.RGBA
+
+// Built-in palette presets
+const (
+	Preset2C02  = "2c02"  // Composite NTSC PPU
+	Preset2C03  = "2c03"  // RGB PPU used in arcade and PlayChoice-10 boards
+	Preset2C05  = "2c05"  // RGB PPU used in Vs. System boards
+	PresetFCEUX = "fceux" // FCEUX's default palette
+)
+
+// PalettePresets lists the built-in presets in the order they are cycled through
+var PalettePresets = []string{Preset2C02, Preset2C03, Preset2C05, PresetFCEUX}
+
+// rgbPPUColors is the 2C03 palette, each channel is a 3-bit DAC level
+// The 2C05 shares it, only its register layout differs
+var rgbPPUColors = [64]uint16{
+	0333, 0014, 0006, 0326, 0403, 0503, 0510, 0420, 0320, 0120, 0031, 0040, 0022, 0000, 0000, 0000,
+	0555, 0036, 0027, 0407, 0507, 0704, 0700, 0630, 0430, 0140, 0040, 0053, 0044, 0000, 0000, 0000,
+	0777, 0357, 0447, 0637, 0707, 0737, 0740, 0750, 0660, 0360, 0070, 0276, 0077, 0000, 0000, 0000,
+	0777, 0567, 0657, 0757, 0747, 0755, 0764, 0772, 0773, 0572, 0473, 0474, 0467, 0000, 0000, 0000,
+}
+
+// fceuxColors is the default palette of the FCEUX emulator
+var fceuxColors = [64]uint32{
+	0x747474, 0x24188C, 0x0000A8, 0x44009C, 0x8C0074, 0xA80010, 0xA40000, 0x7C0800,
+	0x402C00, 0x004400, 0x005000, 0x003C14, 0x183C5C, 0x000000, 0x000000, 0x000000,
+	0xBCBCBC, 0x0070EC, 0x2038EC, 0x8000F0, 0xBC00BC, 0xE40058, 0xD82800, 0xC84C0C,
+	0x887000, 0x009400, 0x00A800, 0x009038, 0x008088, 0x000000, 0x000000, 0x000000,
+	0xFCFCFC, 0x3CBCFC, 0x5C94FC, 0xCC88FC, 0xF478FC, 0xFC74B4, 0xFC7460, 0xFC9838,
+	0xF0BC3C, 0x80D010, 0x4CDC48, 0x58F898, 0x00E8D8, 0x787878, 0x000000, 0x000000,
+	0xFCFCFC, 0xA8E4FC, 0xC4D4FC, 0xD4C8FC, 0xFCC4FC, 0xFCC4D8, 0xFCBCB0, 0xFCD8A8,
+	0xFCE4A0, 0xE0FCA0, 0xA8F0BC, 0xB0FCCC, 0x9CFCF0, 0xC4C4C4, 0x000000, 0x000000,
+}
+
+// PresetPalette returns a copy of a built-in palette
+func PresetPalette(name string) (*ColorPalette, error) {
+	var palette ColorPalette
+
+	switch strings.ToLower(name) {
+	case Preset2C02:
+		palette = EmphasisPalette
+
+	case Preset2C03, Preset2C05:
+		base := make([]color.RGBA, 64)
+		for i, levels := range rgbPPUColors {
+			base[i] = color.RGBA{
+				dacLevel(levels >> 6),
+				dacLevel(levels >> 3),
+				dacLevel(levels),
+				0xFF,
+			}
+		}
+		palette = buildEmphasisPalette(base, true)
+
+	case PresetFCEUX:
+		base := make([]color.RGBA, 64)
+		for i, rgb := range fceuxColors {
+			base[i] = color.RGBA{uint8(rgb >> 16), uint8(rgb >> 8), uint8(rgb), 0xFF}
+		}
+		palette = buildEmphasisPalette(base, false)
+
+	default:
+		return nil, fmt.Errorf("unknown palette preset: %s", name)
+	}
+
+	return &palette, nil
+}
+
+// dacLevel converts a 3-bit RGB PPU DAC level to an 8-bit channel value
+func dacLevel(level uint16) uint8 {
+	return uint8((level & 0x07) * 255 / 7)
+}
+
+// LoadPalette returns a built-in preset by name or loads a .pal file by path
+func LoadPalette(nameOrPath string) (*ColorPalette, error) {
+	if strings.HasSuffix(strings.ToLower(nameOrPath), ".pal") {
+		return LoadPaletteFile(nameOrPath)
+	}
+	return PresetPalette(nameOrPath)
+}
+
+// LoadPaletteFile loads a .pal file with 64 or 512 RGB triplets
+// 64-entry files get their emphasis colors generated like the 2C02's
+func LoadPaletteFile(path string) (*ColorPalette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePalette(data)
+}
+
+// ParsePalette decodes the contents of a .pal file
+func ParsePalette(data []byte) (*ColorPalette, error) {
+	var palette ColorPalette
+
+	switch len(data) {
+	case 64 * 3:
+		base := make([]color.RGBA, 64)
+		for i := range base {
+			base[i] = color.RGBA{data[i*3], data[i*3+1], data[i*3+2], 0xFF}
+		}
+		palette = buildEmphasisPalette(base, false)
+
+	case 512 * 3:
+		for i := range palette {
+			palette[i] = color.RGBA{data[i*3], data[i*3+1], data[i*3+2], 0xFF}
+		}
+
+	default:
+		return nil, fmt.Errorf("invalid palette size: %d bytes, expected %d or %d", len(data), 64*3, 512*3)
+	}
+
+	return &palette, nil
+}
+
+// ExportPaletteFile writes all 512 entries of a palette to a .pal file
+func ExportPaletteFile(path string, palette *ColorPalette) error {
+	data := make([]byte, 0, len(palette)*3)
+	for _, c := range palette {
+		data = append(data, c.R, c.G, c.B)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// SetColorPalette selects the palette used to convert pixels to RGBA
+// It takes effect from the next pixel drawn
+func (p *PPU) SetColorPalette(palette *ColorPalette) {
+	p.colors = palette
+}
+
+// GetColorPalette returns the palette used to convert pixels to RGBA
+func (p *PPU) GetColorPalette() *ColorPalette {
+	return p.colors
+}
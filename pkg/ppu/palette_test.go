@@ -0,0 +1,143 @@
+package ppu
+
+import (
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writePalette writes a .pal file of n RGB triplets, entry i colored (i, 2i, 3i)
+func writePalette(t *testing.T, n int) string {
+	t.Helper()
+	data := make([]byte, 0, n*3)
+	for i := 0; i < n; i++ {
+		data = append(data, byte(i), byte(i*2), byte(i*3))
+	}
+	path := filepath.Join(t.TempDir(), "test.pal")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPaletteFile(t *testing.T) {
+	// Green and blue emphasis dim red twice and green and blue once
+	dim := float64(emphasisAttenuation)
+	r, g, b := 32.0, 64.0, 96.0
+	r, g, b = r*dim*dim, g*dim, b*dim
+
+	tests := []struct {
+		name    string
+		entries int
+		check   map[int]color.RGBA // Expected colors by 9-bit index
+		wantErr string
+	}{
+		{
+			name:    "64 entries",
+			entries: 64,
+			check: map[int]color.RGBA{
+				0x00:  {0, 0, 0, 0xFF},
+				0x3F:  {63, 126, 189, 0xFF},
+				0x20:  {32, 64, 96, 0xFF},
+				0x1A0: {uint8(r), uint8(g), uint8(b), 0xFF},
+			},
+		},
+		{
+			name:    "512 entries",
+			entries: 512,
+			check: map[int]color.RGBA{
+				0x00:  {0, 0, 0, 0xFF},
+				0x3F:  {63, 126, 189, 0xFF},
+				0x1A0: {0xA0, 0x40, 0xE0, 0xFF},
+				0x1FF: {0xFF, 0xFE, 0xFD, 0xFF},
+			},
+		},
+		{name: "too short", entries: 63, wantErr: "invalid palette size: 189 bytes"},
+		{name: "between sizes", entries: 128, wantErr: "invalid palette size"},
+		{name: "empty", entries: 0, wantErr: "invalid palette size"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			palette, err := LoadPaletteFile(writePalette(t, tt.entries))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadPaletteFile() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadPaletteFile() error = %v", err)
+			}
+			for index, want := range tt.check {
+				if got := palette[index]; got != want {
+					t.Errorf("palette[%#x] = %v, want %v", index, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadPaletteFileMissing(t *testing.T) {
+	if _, err := LoadPaletteFile(filepath.Join(t.TempDir(), "missing.pal")); err == nil {
+		t.Error("LoadPaletteFile() of a missing file succeeded")
+	}
+}
+
+func TestExportPaletteFile(t *testing.T) {
+	for _, name := range PalettePresets {
+		t.Run(name, func(t *testing.T) {
+			preset, err := PresetPalette(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(t.TempDir(), name+".pal")
+			if err := ExportPaletteFile(path, preset); err != nil {
+				t.Fatal(err)
+			}
+			loaded, err := LoadPalette(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *loaded != *preset {
+				t.Error("exported palette loads differently")
+			}
+		})
+	}
+}
+
+func TestLoadPalettePreset(t *testing.T) {
+	palette, err := LoadPalette("FCEUX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (color.RGBA{0x74, 0x74, 0x74, 0xFF}); palette[0] != want {
+		t.Errorf("palette[0] = %v, want %v", palette[0], want)
+	}
+	if _, err := LoadPalette("unknown"); err == nil {
+		t.Error("LoadPalette() of an unknown preset succeeded")
+	}
+}
+
+func TestEmphasisPalette(t *testing.T) {
+	tests := []struct {
+		name  string
+		index uint16
+		want  color.RGBA
+	}{
+		{"none", 0x30, color.RGBA{255, 254, 255, 0xFF}},
+		{"red dims green and blue", 0x040 | 0x30, color.RGBA{255, 207, 208, 0xFF}},
+		{"green dims red and blue", 0x080 | 0x16, color.RGBA{147, 49, 26, 0xFF}},
+		{"all dim every channel twice", 0x1C0 | 0x30, color.RGBA{169, 169, 169, 0xFF}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EmphasisPalette[tt.index]; got != tt.want {
+				t.Errorf("EmphasisPalette[%#03x] = %v, want %v", tt.index, got, tt.want)
+			}
+		})
+	}
+}
@@ -5,6 +5,16 @@ import (
 	"image/color"
 )
 
+const (
+	// ioLatchDecayFrames is how many frames a bit of the I/O latch holds
+	// its value without being refreshed (roughly 600ms)
+	ioLatchDecayFrames = 36
+
+	// nmiRaceDots is how many dots after VBlank is set a PPUSTATUS read
+	// still cancels the NMI: the dot it is set on and the next one
+	nmiRaceDots = 2
+)
+
 // PPU represents the Picture Processing Unit of the NES
 type PPU struct {
 	// PPU registers
@@ -37,15 +47,44 @@ type PPU struct {
 	nmiOccurred bool
 	nmiOutput   bool
 	nmiPrevious bool
-	nmiDelay    uint8
+	nmiDelay    uint8 // Dots until a latched NMI is sent to the CPU, 0 when none
+	
+	// VBlank race: set when PPUSTATUS is read the dot before VBlank starts
+	suppressVBlank bool
+	
+	// Odd frames skip a dot on the pre-render line while rendering
+	oddFrame bool
+	
+	// Frame layout for the console region
+	timing Timing
+	
+	// Colors used to convert pixels to RGBA
+	colors *ColorPalette
 	
 	// Data buffer for PPUDATA reads
 	readBuffer uint8
+
+	// PPU dots left until the warm-up period ends
+	warmUp int
+
+	// I/O data latch, read back from write-only registers (PPU open bus)
+	ioLatch      uint8
+	ioLatchDecay [8]uint8 // Frames left before each latch bit decays to 0
 	
 	// Rendering buffers
 	frontBuffer []uint8 // RGBA buffer (256x240x4)
 	backBuffer  []uint8 // RGBA buffer (256x240x4)
 	
+	// Palette index buffers (256x240), 9 bits each: color plus emphasis
+	frontIndices []uint16
+	backIndices  []uint16
+	
+	// NTSC color subcarrier phase at the start of a frame, in twelfths of a
+	// cycle, used by the NTSC filter to reproduce dot crawl
+	framePhase int
+	frontPhase int
+	frameDots  int
+	
 	// Reference to CPU for NMI triggering
 	CPU interface {
 		TriggerNMI()
@@ -58,8 +97,12 @@ func NewPPU() *PPU {
 		VRAM: make([]uint8, 0x4000),
 		OAM:  make([]uint8, 256),
 		Palette: make([]uint8, 32),
+		timing: NTSCTiming,
+		colors: &EmphasisPalette,
 		frontBuffer: make([]uint8, 256*240*4), // RGBA buffer
 		backBuffer: make([]uint8, 256*240*4),  // RGBA buffer
+		frontIndices: make([]uint16, 256*240),
+		backIndices: make([]uint16, 256*240),
 	}
 }
 
@@ -70,63 +113,108 @@ func (p *PPU) SetCPU(cpu interface {
 	p.CPU = cpu
 }
 
-// Reset resets the PPU to its initial state
-func (p *PPU) Reset() {
+// PowerOn puts the PPU in its power-up state
+// Nametables, OAM and palette are cleared, which real hardware leaves undefined
+func (p *PPU) PowerOn() {
 	p.PPUCTRL = 0
 	p.PPUMASK = 0
-	p.PPUSTATUS = 0
+	p.PPUSTATUS = 0xA0 // VBlank and sprite overflow usually read set at power-up
 	p.OAMADDR = 0
 	p.PPUSCROLL = 0
 	p.PPUADDR = 0
 	p.PPUDATA = 0
-	
+
+	// Pattern tables belong to the cartridge and are left alone
+	for i := 0x2000; i < len(p.VRAM); i++ {
+		p.VRAM[i] = 0
+	}
+	for i := range p.OAM {
+		p.OAM[i] = 0
+	}
+	for i := range p.Palette {
+		p.Palette[i] = 0
+	}
+
 	p.v = 0
 	p.t = 0
 	p.x = 0
 	p.w = 0
-	
+
 	p.Scanline = 0
 	p.Cycle = 0
 	p.FrameComplete = false
-	
+
 	p.nmiOccurred = false
 	p.nmiOutput = false
 	p.nmiPrevious = false
 	p.nmiDelay = 0
-	
+	p.suppressVBlank = false
+	p.oddFrame = false
+
 	p.readBuffer = 0
-	
-	// Initialize buffers with a recognizable pattern
-	for y := 0; y < 240; y++ {
-		for x := 0; x < 256; x++ {
-			offset := (y*256 + x) * 4
-			
-			// Create a checkerboard pattern
-			if ((x / 16) + (y / 16)) % 2 == 0 {
-				// Blue squares
-				p.frontBuffer[offset] = 0
-				p.frontBuffer[offset+1] = 0
-				p.frontBuffer[offset+2] = 255
-				p.frontBuffer[offset+3] = 255
-				
-				p.backBuffer[offset] = 0
-				p.backBuffer[offset+1] = 0
-				p.backBuffer[offset+2] = 255
-				p.backBuffer[offset+3] = 255
-			} else {
-				// White squares
-				p.frontBuffer[offset] = 255
-				p.frontBuffer[offset+1] = 255
-				p.frontBuffer[offset+2] = 255
-				p.frontBuffer[offset+3] = 255
-				
-				p.backBuffer[offset] = 255
-				p.backBuffer[offset+1] = 255
-				p.backBuffer[offset+2] = 255
-				p.backBuffer[offset+3] = 255
-			}
-		}
+	p.warmUp = p.timing.WarmUpDots
+
+	p.ioLatch = 0
+	p.ioLatchDecay = [8]uint8{}
+
+	p.clearBuffers()
+}
+
+// Reset handles the console reset button
+// OAM, palette and VRAM contents survive, as do PPUSTATUS, OAMADDR and the VRAM address
+func (p *PPU) Reset() {
+	p.PPUCTRL = 0
+	p.PPUMASK = 0
+	p.PPUSCROLL = 0
+	p.PPUDATA = 0
+
+	p.t = 0
+	p.x = 0
+	p.w = 0
+
+	p.Scanline = 0
+	p.Cycle = 0
+	p.FrameComplete = false
+
+	p.nmiOccurred = false
+	p.nmiOutput = false
+	p.nmiPrevious = false
+	p.nmiDelay = 0
+	p.suppressVBlank = false
+	p.oddFrame = false
+
+	p.readBuffer = 0
+
+	// The NES resets the PPU along with the CPU, so the warm-up applies again
+	p.warmUp = p.timing.WarmUpDots
+
+	p.clearBuffers()
+}
+
+// clearBuffers fills both rendering buffers with black
+func (p *PPU) clearBuffers() {
+	for i := 0; i < len(p.frontBuffer); i += 4 {
+		p.frontBuffer[i] = 0
+		p.frontBuffer[i+1] = 0
+		p.frontBuffer[i+2] = 0
+		p.frontBuffer[i+3] = 255
+
+		p.backBuffer[i] = 0
+		p.backBuffer[i+1] = 0
+		p.backBuffer[i+2] = 0
+		p.backBuffer[i+3] = 255
 	}
+
+	// 0x0F is black in every palette
+	for i := range p.frontIndices {
+		p.frontIndices[i] = 0x0F
+		p.backIndices[i] = 0x0F
+	}
+}
+
+// WarmingUp reports whether the PPU is still ignoring writes after power-on or reset
+func (p *PPU) WarmingUp() bool {
+	return p.warmUp > 0
 }
 
 // ReadRegister reads from a PPU register
@@ -135,32 +223,33 @@ func (p *PPU) ReadRegister(address uint16) uint8 {
 	reg := address % 8
 	
 	switch reg {
-	case 0x0: // PPUCTRL ($2000) - Write only
-		return 0
-		
-	case 0x1: // PPUMASK ($2001) - Write only
-		return 0
-		
 	case 0x2: // PPUSTATUS ($2002)
+		// Reading one dot before VBlank starts reads it clear and
+		// keeps it from being set at all this frame
+		if p.Scanline == p.timing.VBlankLine && p.Cycle == 1 {
+			p.suppressVBlank = true
+		}
+		
 		// Reading PPUSTATUS has side effects
-		result := p.PPUSTATUS
+		// Only the top three bits are driven, the rest come from the latch
+		result := (p.PPUSTATUS & 0xE0) | (p.ioLatch & 0x1F)
+		p.refreshLatch(result, 0xE0)
 		// Clear VBlank flag
 		p.PPUSTATUS &= 0x7F
+		p.nmiOccurred = false
+		p.nmiChange()
 		// Reset address latch
 		p.w = 0
 		return result
 		
-	case 0x3: // OAMADDR ($2003) - Write only
-		return 0
-		
 	case 0x4: // OAMDATA ($2004)
-		return p.OAM[p.OAMADDR]
-		
-	case 0x5: // PPUSCROLL ($2005) - Write only
-		return 0
-		
-	case 0x6: // PPUADDR ($2006) - Write only
-		return 0
+		value := p.OAM[p.OAMADDR]
+		// Bits 2-4 of sprite attribute bytes don't exist
+		if p.OAMADDR%4 == 2 {
+			value &= 0xE3
+		}
+		p.refreshLatch(value, 0xFF)
+		return value
 		
 	case 0x7: // PPUDATA ($2007)
 		// Reading from PPUDATA has special behavior
@@ -171,8 +260,12 @@ func (p *PPU) ReadRegister(address uint16) uint8 {
 		
 		// Special case for palette memory
 		if p.v >= 0x3F00 && p.v <= 0x3FFF {
-			value = p.readBuffer
+			// Palette entries are 6 bits wide, the top two come from the latch
+			value = (p.readBuffer & 0x3F) | (p.ioLatch & 0xC0)
 			p.readBuffer = p.readPPUData()
+			p.refreshLatch(value, 0x3F)
+		} else {
+			p.refreshLatch(value, 0xFF)
 		}
 		
 		// Auto-increment address
@@ -181,7 +274,32 @@ func (p *PPU) ReadRegister(address uint16) uint8 {
 		return value
 	}
 	
-	return 0
+	// Write-only registers return the I/O latch
+	return p.ioLatch
+}
+
+// refreshLatch loads the bits selected by mask into the I/O latch
+// and restarts their decay
+func (p *PPU) refreshLatch(value uint8, mask uint8) {
+	p.ioLatch = (p.ioLatch &^ mask) | (value & mask)
+	for bit := 0; bit < 8; bit++ {
+		if mask&(1<<bit) != 0 {
+			p.ioLatchDecay[bit] = ioLatchDecayFrames
+		}
+	}
+}
+
+// decayLatch runs once per frame, clearing latch bits that weren't refreshed
+func (p *PPU) decayLatch() {
+	for bit := 0; bit < 8; bit++ {
+		if p.ioLatchDecay[bit] == 0 {
+			continue
+		}
+		p.ioLatchDecay[bit]--
+		if p.ioLatchDecay[bit] == 0 {
+			p.ioLatch &^= 1 << bit
+		}
+	}
 }
 
 // WriteRegister writes to a PPU register
@@ -189,17 +307,24 @@ func (p *PPU) WriteRegister(address uint16, value uint8) {
 	// Map the address to 0-7 range (PPU registers)
 	reg := address % 8
 	
+	// Every write fills the I/O latch
+	p.refreshLatch(value, 0xFF)
+	
+	// During warm-up these registers ignore writes
+	if p.warmUp > 0 && (reg == 0x0 || reg == 0x1 || reg == 0x5 || reg == 0x6) {
+		return
+	}
+	
 	switch reg {
 	case 0x0: // PPUCTRL ($2000)
 		p.PPUCTRL = value
 		// t: ...BA.. ........ = d: ......BA
 		p.t = (p.t & 0xF3FF) | ((uint16(value) & 0x03) << 10)
 		// Update NMI output
+		// Enabling it during VBlank raises the NMI line right away,
+		// disabling it in the race window cancels a latched NMI
 		p.nmiOutput = (value & 0x80) != 0
-		// If NMI occurs and output is enabled, trigger NMI
-		if p.nmiOutput && p.nmiOccurred && p.CPU != nil {
-			p.CPU.TriggerNMI()
-		}
+		p.nmiChange()
 		
 	case 0x1: // PPUMASK ($2001)
 		p.PPUMASK = value
@@ -264,6 +389,10 @@ func (p *PPU) readPPUData() uint8 {
 		if paletteAddress >= 16 && paletteAddress%4 == 0 {
 			paletteAddress -= 16
 		}
+		// Grayscale also applies to palette reads
+		if p.PPUMASK&0x01 != 0 {
+			return p.Palette[paletteAddress] & 0x30
+		}
 		return p.Palette[paletteAddress]
 	}
 }
@@ -322,7 +451,7 @@ func (p *PPU) calculatePixelColor() uint8 {
 	// In a real implementation, this would involve checking background and sprite priorities
 	
 	// If rendering is disabled, return the background color
-	if p.PPUMASK&0x08 == 0 && p.PPUMASK&0x10 == 0 {
+	if !p.renderingEnabled() {
 		return p.Palette[0] & 0x3F
 	}
 	
@@ -341,19 +470,81 @@ func (p *PPU) calculatePixelColor() uint8 {
 	}
 }
 
+// maskColor applies the PPUMASK grayscale and emphasis bits to a palette
+// color, returning a 9-bit index into EmphasisPalette
+func (p *PPU) maskColor(colorIndex uint8) uint16 {
+	// Grayscale keeps only the brightness column of the palette
+	if p.PPUMASK&0x01 != 0 {
+		colorIndex &= 0x30
+	}
+
+	emphasis := uint16(p.PPUMASK >> 5)
+	if p.timing.SwapRedGreenEmphasis {
+		emphasis = (emphasis & 0x04) | (emphasis&0x01)<<1 | (emphasis&0x02)>>1
+	}
+
+	return emphasis<<6 | uint16(colorIndex&0x3F)
+}
+
 // SwapBuffers swaps the front and back buffers
 func (p *PPU) SwapBuffers() {
 	p.frontBuffer, p.backBuffer = p.backBuffer, p.frontBuffer
+	p.frontIndices, p.backIndices = p.backIndices, p.frontIndices
+	p.frontPhase = p.framePhase
+}
+
+// renderingEnabled reports whether background or sprite rendering is on
+func (p *PPU) renderingEnabled() bool {
+	return p.PPUMASK&0x18 != 0
+}
+
+// nmiChange re-evaluates the NMI line and latches an NMI on its rising edge
+// The NMI raised with VBlank is held through the race window, one raised by
+// enabling NMIs goes out on the next dot
+// Once latched, the NMI happens even if the line falls again, unless it
+// falls within the race window, by a PPUSTATUS read or a PPUCTRL write
+func (p *PPU) nmiChange() {
+	nmi := p.nmiOutput && p.nmiOccurred
+	if nmi && !p.nmiPrevious {
+		p.nmiDelay = 1
+		if p.Scanline == p.timing.VBlankLine && p.Cycle == 1 {
+			p.nmiDelay = nmiRaceDots
+		}
+	}
+	if !nmi && p.inNMIRace() {
+		p.nmiDelay = 0
+	}
+	p.nmiPrevious = nmi
+}
+
+// inNMIRace reports whether a PPUSTATUS read now falls on the dot VBlank was
+// set or the one after
+// Step has already run the dot VBlank was set on, so Cycle is one past it
+func (p *PPU) inNMIRace() bool {
+	return p.Scanline == p.timing.VBlankLine && p.Cycle >= 2 && p.Cycle < 2+nmiRaceDots
 }
 
 // Step advances the PPU by one cycle
 func (p *PPU) Step() {
-	// Pre-render scanline (-1 or 261)
-	if p.Scanline == 261 {
-		// Clear VBlank flag at dot 1 of pre-render scanline
+	if p.warmUp > 0 {
+		p.warmUp--
+	}
+
+	// Deliver a latched NMI once its delay runs out
+	if p.nmiDelay > 0 {
+		p.nmiDelay--
+		if p.nmiDelay == 0 && p.CPU != nil {
+			p.CPU.TriggerNMI()
+		}
+	}
+
+	// Pre-render scanline (-1 or 261 on NTSC)
+	if p.Scanline == p.preRenderLine() {
+		// Clear VBlank, sprite 0 hit and overflow at dot 1 of pre-render scanline
 		if p.Cycle == 1 {
-			p.PPUSTATUS &= 0x7F // Clear bit 7 (VBlank)
+			p.PPUSTATUS &= 0x1F
 			p.nmiOccurred = false
+			p.nmiChange()
 		}
 	}
 	
@@ -365,8 +556,8 @@ func (p *PPU) Step() {
 			y := p.Scanline
 			
 			// Calculate the color for this pixel
-			colorIndex := p.calculatePixelColor()
-			color := GetColor(colorIndex)
+			colorIndex := p.maskColor(p.calculatePixelColor())
+			color := p.colors[colorIndex]
 			
 			// Set the pixel in the back buffer
 			offset := (y*256 + x) * 4
@@ -374,34 +565,49 @@ func (p *PPU) Step() {
 			p.backBuffer[offset+1] = color.G
 			p.backBuffer[offset+2] = color.B
 			p.backBuffer[offset+3] = 255 // Full opacity
+			p.backIndices[y*256+x] = colorIndex
 		}
 	}
 	
-	// VBlank scanlines (241-260)
-	if p.Scanline == 241 && p.Cycle == 1 {
-		// Set VBlank flag
-		p.PPUSTATUS |= 0x80 // Set bit 7
-		p.nmiOccurred = true
-		
-		// Generate NMI if enabled
-		if p.nmiOutput && p.CPU != nil {
-			p.CPU.TriggerNMI()
+	// VBlank scanlines (241-260 on NTSC)
+	if p.Scanline == p.timing.VBlankLine && p.Cycle == 1 {
+		// Set VBlank flag and raise NMI if enabled, unless a
+		// PPUSTATUS read just before suppressed it
+		if !p.suppressVBlank {
+			p.PPUSTATUS |= 0x80 // Set bit 7
+			p.nmiOccurred = true
+			p.nmiChange()
 		}
+		p.suppressVBlank = false
 		
 		// Swap front and back buffers
 		p.SwapBuffers()
 		p.FrameComplete = true
+		
+		p.decayLatch()
 	}
 	
 	// Update cycle and scanline counters
 	p.Cycle++
+	p.frameDots++
+	
+	// Odd frames drop the last dot of the pre-render line when rendering is on
+	if p.Scanline == p.preRenderLine() && p.Cycle == 340 && p.timing.SkipOddDot && p.oddFrame && p.renderingEnabled() {
+		p.Cycle++
+	}
+	
 	if p.Cycle > 340 {
 		p.Cycle = 0
 		p.Scanline++
 		
-		if p.Scanline > 261 {
+		if p.Scanline > p.preRenderLine() {
 			p.Scanline = 0
 			p.FrameComplete = false
+			p.oddFrame = !p.oddFrame
+			
+			// Each dot is 8 samples of the 12-sample color subcarrier cycle
+			p.framePhase = (p.framePhase + p.frameDots*8) % 12
+			p.frameDots = 0
 		}
 	}
 }
\ No newline at end of file
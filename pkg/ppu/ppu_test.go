@@ -0,0 +1,366 @@
+package ppu
+
+import "testing"
+
+// testCPU counts the NMIs the PPU sends
+type testCPU struct {
+	nmis int
+}
+
+func (c *testCPU) TriggerNMI() {
+	c.nmis++
+}
+
+// newNMITestPPU returns a powered-on PPU with NMIs enabled, stopped on the
+// VBlank scanline before dot cycle runs
+func newNMITestPPU(t *testing.T, timing Timing, cycle int) (*PPU, *testCPU) {
+	t.Helper()
+	cpu := &testCPU{}
+	p := NewPPU()
+	p.SetTiming(timing)
+	p.SetCPU(cpu)
+	p.PowerOn()
+	p.warmUp = 0
+	p.WriteRegister(0x2000, 0x80)
+	p.ReadRegister(0x2002) // Clear the VBlank flag set at power-up
+
+	for i := 0; !(p.Scanline == timing.VBlankLine && p.Cycle == cycle); i++ {
+		if i > 400000 {
+			t.Fatalf("never reached scanline %d, dot %d", timing.VBlankLine, cycle)
+		}
+		p.Step()
+	}
+	return p, cpu
+}
+
+func TestNMIStatusRace(t *testing.T) {
+	tests := []struct {
+		name       string
+		readBefore int  // Dot of the VBlank line a PPUSTATUS read happens before, 0 for none
+		wantVBlank bool // VBlank bit of the read
+		wantNMIs   int
+	}{
+		{"no read", 0, false, 1},
+		{"read one dot before VBlank", 1, false, 0},
+		{"read on the VBlank dot", 2, true, 0},
+		{"read one dot after", 3, true, 0},
+		{"read two dots after", 4, true, 1},
+		{"read later in VBlank", 100, true, 1},
+	}
+
+	timings := []struct {
+		name   string
+		timing Timing
+	}{
+		{"NTSC", NTSCTiming},
+		{"PAL", PALTiming},
+	}
+
+	for _, region := range timings {
+		timing := region.timing
+		for _, tt := range tests {
+			t.Run(region.name+" "+tt.name, func(t *testing.T) {
+				cycle := tt.readBefore
+				if cycle == 0 {
+					cycle = 1
+				}
+				p, cpu := newNMITestPPU(t, timing, cycle)
+				if tt.readBefore != 0 {
+					status := p.ReadRegister(0x2002)
+					if vblank := status&0x80 != 0; vblank != tt.wantVBlank {
+						t.Errorf("PPUSTATUS = %#02x, want VBlank %v", status, tt.wantVBlank)
+					}
+				}
+
+				// Run to the end of the VBlank line
+				for p.Scanline == timing.VBlankLine {
+					p.Step()
+				}
+				if cpu.nmis != tt.wantNMIs {
+					t.Errorf("%d NMIs, want %d", cpu.nmis, tt.wantNMIs)
+				}
+			})
+		}
+	}
+}
+
+func TestNMIDisabledDuringRace(t *testing.T) {
+	tests := []struct {
+		name        string
+		writeBefore int // Dot of the VBlank line PPUCTRL bit 7 is cleared before
+		wantNMIs    int
+	}{
+		{"on the VBlank dot", 2, 0},
+		{"one dot after", 3, 0},
+		{"two dots after", 4, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, cpu := newNMITestPPU(t, NTSCTiming, tt.writeBefore)
+			p.WriteRegister(0x2000, 0x00)
+			for p.Scanline == NTSCTiming.VBlankLine {
+				p.Step()
+			}
+			if cpu.nmis != tt.wantNMIs {
+				t.Errorf("%d NMIs, want %d", cpu.nmis, tt.wantNMIs)
+			}
+		})
+	}
+}
+
+func TestNMIEnabledDuringVBlank(t *testing.T) {
+	p, cpu := newNMITestPPU(t, NTSCTiming, 10)
+	p.WriteRegister(0x2000, 0x00)
+	p.WriteRegister(0x2000, 0x80) // Rising edge with VBlank set
+	p.Step()
+	if cpu.nmis != 2 {
+		t.Errorf("%d NMIs, want the one at VBlank and one from enabling them again", cpu.nmis)
+	}
+
+	// Enabling them again after the flag is read doesn't cause another
+	p.ReadRegister(0x2002)
+	p.WriteRegister(0x2000, 0x00)
+	p.WriteRegister(0x2000, 0x80)
+	p.Step()
+	if cpu.nmis != 2 {
+		t.Errorf("%d NMIs after reading PPUSTATUS, want 2", cpu.nmis)
+	}
+}
+
+func TestOddFrameDotSkip(t *testing.T) {
+	tests := []struct {
+		name     string
+		timing   Timing
+		mask     uint8
+		wantSkip bool
+	}{
+		{"NTSC rendering", NTSCTiming, 0x18, true},
+		{"NTSC rendering off", NTSCTiming, 0x00, false},
+		{"PAL rendering", PALTiming, 0x18, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPPU()
+			p.SetTiming(tt.timing)
+			p.PowerOn()
+			p.warmUp = 0
+			p.WriteRegister(0x2001, tt.mask)
+			for p.Scanline != 0 || p.Cycle != 0 {
+				p.Step()
+			}
+
+			full := 341 * (p.preRenderLine() + 1)
+			for frame := 0; frame < 2; frame++ {
+				odd := p.oddFrame
+				dots, sawLastDot := 0, false
+				for {
+					p.Step()
+					dots++
+					if p.Scanline == p.preRenderLine() && p.Cycle == 340 {
+						sawLastDot = true
+					}
+					if p.Scanline == 0 && p.Cycle == 0 {
+						break
+					}
+				}
+
+				want := full
+				if odd && tt.wantSkip {
+					want--
+				}
+				if dots != want {
+					t.Errorf("odd frame %v: %d dots, want %d", odd, dots, want)
+				}
+				if sawLastDot != (want == full) {
+					t.Errorf("odd frame %v: pre-render dot 340 run = %v", odd, sawLastDot)
+				}
+			}
+		})
+	}
+}
+
+func TestFrameIndices(t *testing.T) {
+	tests := []struct {
+		name   string
+		timing Timing
+		mask   uint8
+		want   uint16
+	}{
+		{"plain", NTSCTiming, 0x00, 0x21},
+		{"grayscale", NTSCTiming, 0x01, 0x20},
+		{"all emphasis", NTSCTiming, 0xE0, 0x1C0 | 0x21},
+		{"red emphasis", NTSCTiming, 0x20, 0x040 | 0x21},
+		{"PAL swaps red and green", PALTiming, 0x20, 0x080 | 0x21},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPPU()
+			p.SetTiming(tt.timing)
+			p.PowerOn()
+			p.warmUp = 0
+			p.Palette[0] = 0x21 // Rendering is off, so the backdrop fills the frame
+			p.WriteRegister(0x2001, tt.mask)
+
+			for frames := 0; frames < 2; {
+				p.Step()
+				if p.Scanline == tt.timing.VBlankLine && p.Cycle == 2 {
+					frames++
+				}
+			}
+
+			frame := p.Frame()
+			if len(frame) != FrameWidth*FrameHeight {
+				t.Fatalf("len(Frame()) = %d, want %d", len(frame), FrameWidth*FrameHeight)
+			}
+			for i, index := range frame {
+				if index != tt.want {
+					t.Fatalf("Frame()[%d] = %#03x, want %#03x", i, index, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestWarmUp(t *testing.T) {
+	// writeAll writes the four registers that ignore writes during warm-up
+	writeAll := func(p *PPU) {
+		p.WriteRegister(0x2000, 0x80)
+		p.WriteRegister(0x2001, 0x1E)
+		p.WriteRegister(0x2005, 0x07) // First write: fine X 7
+		p.WriteRegister(0x2006, 0x21) // Second write: low byte of the address
+	}
+	// written reports which of the writes took effect
+	written := func(p *PPU) [4]bool {
+		return [4]bool{p.PPUCTRL == 0x80, p.PPUMASK == 0x1E, p.x == 7, p.t&0x00FF == 0x21}
+	}
+
+	timings := []struct {
+		name   string
+		timing Timing
+	}{
+		{"NTSC", NTSCTiming},
+		{"PAL", PALTiming},
+		{"Dendy", DendyTiming},
+	}
+
+	for _, region := range timings {
+		timing := region.timing
+		t.Run(region.name, func(t *testing.T) {
+			p := NewPPU()
+			p.SetTiming(timing)
+			p.PowerOn()
+
+			for i := 0; i < timing.WarmUpDots-1; i++ {
+				p.Step()
+			}
+			writeAll(p)
+			if got := written(p); got != [4]bool{} {
+				t.Errorf("writes one dot before the end of warm-up took effect: %v", got)
+			}
+			// OAMADDR works right away
+			p.WriteRegister(0x2003, 0x10)
+			if p.OAMADDR != 0x10 {
+				t.Errorf("OAMADDR = %#02x during warm-up, want %#02x", p.OAMADDR, 0x10)
+			}
+
+			p.Step()
+			writeAll(p)
+			if got := written(p); got != [4]bool{true, true, true, true} {
+				t.Errorf("writes after warm-up took effect: %v, want all", got)
+			}
+		})
+	}
+}
+
+func TestResetKeepsMemory(t *testing.T) {
+	p := NewPPU()
+	p.PowerOn()
+	p.warmUp = 0
+	p.VRAM[0x123] = 0x45
+	p.OAM[0x10] = 0x67
+	p.Palette[0x05] = 0x16
+	p.WriteRegister(0x2001, 0x1E)
+
+	p.Reset()
+	if p.VRAM[0x123] != 0x45 || p.OAM[0x10] != 0x67 || p.Palette[0x05] != 0x16 {
+		t.Error("Reset cleared VRAM, OAM or palette memory")
+	}
+	if p.PPUMASK != 0 {
+		t.Errorf("PPUMASK = %#02x after Reset, want 0", p.PPUMASK)
+	}
+	// The warm-up starts over
+	if p.warmUp != p.timing.WarmUpDots {
+		t.Errorf("warm-up = %d dots after Reset, want %d", p.warmUp, p.timing.WarmUpDots)
+	}
+	p.WriteRegister(0x2001, 0x1E)
+	if p.PPUMASK != 0 {
+		t.Error("PPUMASK write after Reset took effect during warm-up")
+	}
+}
+
+// stepFrames runs the PPU until it has finished n more frames
+func stepFrames(p *PPU, n int) {
+	for i := 0; i < n; i++ {
+		for p.FrameComplete {
+			p.Step()
+		}
+		for !p.FrameComplete {
+			p.Step()
+		}
+	}
+}
+
+func TestIOLatchDecay(t *testing.T) {
+	p := NewPPU()
+	p.PowerOn()
+	p.warmUp = 0
+	stepFrames(p, 1)
+
+	// Any write fills the latch, write-only registers read it back
+	p.WriteRegister(0x2003, 0xFF)
+	if got := p.ReadRegister(0x2000); got != 0xFF {
+		t.Fatalf("$2000 = %#02x after writing 0xFF, want 0xFF", got)
+	}
+
+	// Ten frames on, a PPUSTATUS read refreshes only the top three bits
+	// VBlank was just set, the sprite flags are clear
+	stepFrames(p, 10)
+	if got := p.ReadRegister(0x2002); got != 0x9F {
+		t.Errorf("$2002 = %#02x, want 0x9F with the low bits from the latch", got)
+	}
+
+	stepFrames(p, ioLatchDecayFrames-11)
+	if got := p.ReadRegister(0x2000); got != 0x9F {
+		t.Errorf("$2000 = %#02x one frame before the decay, want 0x9F", got)
+	}
+	stepFrames(p, 1)
+	if got := p.ReadRegister(0x2000); got != 0x80 {
+		t.Errorf("$2000 = %#02x after the low bits decayed, want 0x80", got)
+	}
+	stepFrames(p, 10)
+	if got := p.ReadRegister(0x2000); got != 0 {
+		t.Errorf("$2000 = %#02x after every bit decayed, want 0", got)
+	}
+}
+
+func TestOAMDataAttributeMask(t *testing.T) {
+	p := NewPPU()
+	p.PowerOn()
+	for i := 0; i < 4; i++ {
+		p.OAM[i] = 0xFF
+	}
+
+	want := []uint8{0xFF, 0xFF, 0xE3, 0xFF} // Byte 2 is the attribute byte
+	for i, value := range want {
+		p.WriteRegister(0x2003, uint8(i))
+		if got := p.ReadRegister(0x2004); got != value {
+			t.Errorf("OAM byte %d = %#02x, want %#02x", i, got, value)
+		}
+		if got := p.ReadRegister(0x2000); got != value {
+			t.Errorf("latch after reading OAM byte %d = %#02x, want %#02x", i, got, value)
+		}
+	}
+}
@@ -15,6 +15,10 @@ type Renderer struct {
 	frameBuffer *ebiten.Image
 	scale       float64
 	frameCount  int
+	ntsc        *NTSCFilter // Optional composite video filter
+	pixels      *image.RGBA // Frame converted with the current palette
+	scaling     ScaleOptions // Pixel-art upscaler settings
+	output      *image.RGBA // Last image written to the frame buffer
 }
 
 // NewRenderer creates a new PPU renderer
@@ -40,6 +44,45 @@ func (r *Renderer) SetScale(scale float64) {
 	r.scale = scale
 }
 
+// SetNTSCFilter enables the NTSC composite filter, nil turns it off
+func (r *Renderer) SetNTSCFilter(filter *NTSCFilter) {
+	r.ntsc = filter
+	
+	// The filter outputs a wider image
+	width, height, _ := ScaledSize(FrameWidth, FrameHeight, r.scaling)
+	if filter != nil {
+		width, height = NTSCWidth, 240
+	}
+	r.frameBuffer = ebiten.NewImage(width, height)
+	r.frameBuffer.Fill(color.RGBA{0, 0, 0, 255})
+}
+
+// SetScaleOptions selects the pixel-art upscaler used for the output
+// Scalers only apply without the NTSC filter, which has its own resampling
+func (r *Renderer) SetScaleOptions(options ScaleOptions) error {
+	width, height, err := ScaledSize(FrameWidth, FrameHeight, options)
+	if err != nil {
+		return err
+	}
+	r.scaling = options
+	
+	if r.ntsc == nil {
+		r.frameBuffer = ebiten.NewImage(width, height)
+		r.frameBuffer.Fill(color.RGBA{0, 0, 0, 255})
+	}
+	return nil
+}
+
+// Layout returns the logical screen size needed to show the output
+// NTSC output is drawn at twice the height to keep its aspect ratio
+func (r *Renderer) Layout() (int, int) {
+	if r.ntsc != nil {
+		return NTSCWidth, 480
+	}
+	width, height, _ := ScaledSize(FrameWidth, FrameHeight, r.scaling)
+	return width, height
+}
+
 // Update updates the renderer state
 func (r *Renderer) Update() error {
 	// Check if a new frame is ready
@@ -54,27 +97,41 @@ func (r *Renderer) Update() error {
 	return nil
 }
 
-// updateFrameBuffer copies the PPU's front buffer to the Ebiten image
+// Refresh redraws the current frame, e.g. after the palette changed while paused
+func (r *Renderer) Refresh() {
+	r.updateFrameBuffer()
+}
+
+// updateFrameBuffer converts the PPU's last frame to the Ebiten image
+// It works from the palette indices, so the palette can change after the fact
 func (r *Renderer) updateFrameBuffer() {
-	// Create a temporary RGBA image to hold the pixel data
-	img := image.NewRGBA(image.Rect(0, 0, 256, 240))
+	if r.ntsc != nil {
+		r.output = r.ntsc.FilterFrame(r.ppu)
+		r.frameBuffer.WritePixels(r.output.Pix)
+		return
+	}
 	
-	// Copy pixel data from PPU's front buffer to the RGBA image
-	for y := 0; y < 240; y++ {
-		for x := 0; x < 256; x++ {
-			offset := (y*256 + x) * 4
-			c := color.RGBA{
-				r.ppu.frontBuffer[offset],
-				r.ppu.frontBuffer[offset+1],
-				r.ppu.frontBuffer[offset+2],
-				r.ppu.frontBuffer[offset+3],
-			}
-			img.SetRGBA(x, y, c)
-		}
+	r.pixels = RenderFrame(r.ppu.Frame(), r.ppu.GetColorPalette(), r.pixels)
+	
+	// Upscale on the CPU so screenshots match the window
+	scaled, err := Scale(r.pixels, r.scaling)
+	if err != nil {
+		fmt.Printf("Error scaling frame: %v\n", err)
+		scaled = r.pixels
 	}
+	r.output = scaled
 	
 	// Update the Ebiten image
-	r.frameBuffer.WritePixels(img.Pix)
+	r.frameBuffer.WritePixels(r.output.Pix)
+}
+
+// Screenshot returns the last frame as shown, after filtering and scaling
+// NTSC output is returned at its native 240 line height
+func (r *Renderer) Screenshot() *image.RGBA {
+	if r.output == nil {
+		r.updateFrameBuffer()
+	}
+	return r.output
 }
 
 // Draw draws the frame buffer to the screen
@@ -83,6 +140,9 @@ func (r *Renderer) Draw(screen *ebiten.Image) {
 	op := &ebiten.DrawImageOptions{}
 	
 	// Apply scaling
+	if r.ntsc != nil {
+		op.GeoM.Scale(1, 2)
+	}
 	op.GeoM.Scale(r.scale, r.scale)
 	
 	// Draw the frame buffer to the screen
@@ -0,0 +1,289 @@
+// Package ppu implements the NES Picture Processing Unit emulation
+package ppu
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"strings"
+)
+
+// Pixel-art upscalers
+const (
+	ScaleNearest = "nearest" // Integer nearest-neighbor, uses ScaleOptions.Factor
+	Scale2x      = "scale2x"
+	Scale3x      = "scale3x"
+	ScaleHQ2x    = "hq2x"
+	ScaleHQ3x    = "hq3x"
+	ScaleXBRZ2x  = "xbrz2x"
+	ScaleXBRZ3x  = "xbrz3x"
+	ScaleXBRZ4x  = "xbrz4x"
+)
+
+// ScaleFilters lists the available upscalers
+var ScaleFilters = []string{
+	ScaleNearest, Scale2x, Scale3x, ScaleHQ2x, ScaleHQ3x, ScaleXBRZ2x, ScaleXBRZ3x, ScaleXBRZ4x,
+}
+
+// ScaleOptions configures the upscaling of frames
+type ScaleOptions struct {
+	Filter      string  // One of ScaleFilters, empty means nearest
+	Factor      int     // Integer factor for the nearest filter
+	Scanlines   float64 // How much to darken every other line, 0 disables
+	AspectRatio bool    // Stretch horizontally to the NES's 8:7 pixel aspect ratio
+}
+
+// pixelAspectRatio is the width to height ratio of an NES pixel
+const pixelAspectRatio = 8.0 / 7.0
+
+// Scale upscales an image with the selected filter, then applies the
+// scanline and aspect ratio options
+// It runs on the CPU, so the same output can go to the window or to a file
+func Scale(src *image.RGBA, options ScaleOptions) (*image.RGBA, error) {
+	var dst *image.RGBA
+
+	switch strings.ToLower(options.Filter) {
+	case "", ScaleNearest:
+		factor := options.Factor
+		if factor < 1 {
+			factor = 1
+		}
+		dst = scaleNearest(src, factor)
+	case Scale2x:
+		dst = scaleEPX2x(src)
+	case Scale3x:
+		dst = scaleEPX3x(src)
+	case ScaleHQ2x:
+		dst = scaleHQ2x(src)
+	case ScaleHQ3x:
+		dst = scaleHQ3x(src)
+	case ScaleXBRZ2x:
+		dst = scaleXBRZ(src, 2)
+	case ScaleXBRZ3x:
+		dst = scaleXBRZ(src, 3)
+	case ScaleXBRZ4x:
+		dst = scaleXBRZ(src, 4)
+	default:
+		return nil, fmt.Errorf("unknown scale filter: %s", options.Filter)
+	}
+
+	if options.Scanlines > 0 {
+		applyScanlines(dst, dst.Rect.Dy()/src.Rect.Dy(), options.Scanlines)
+	}
+	if options.AspectRatio {
+		dst = stretchAspect(dst)
+	}
+	return dst, nil
+}
+
+// ScaledSize returns the size of a frame after Scale
+func ScaledSize(width, height int, options ScaleOptions) (int, int, error) {
+	factor := 1
+	switch strings.ToLower(options.Filter) {
+	case "", ScaleNearest:
+		factor = options.Factor
+		if factor < 1 {
+			factor = 1
+		}
+	case Scale2x, ScaleHQ2x, ScaleXBRZ2x:
+		factor = 2
+	case Scale3x, ScaleHQ3x, ScaleXBRZ3x:
+		factor = 3
+	case ScaleXBRZ4x:
+		factor = 4
+	default:
+		return 0, 0, fmt.Errorf("unknown scale filter: %s", options.Filter)
+	}
+
+	width *= factor
+	height *= factor
+	if options.AspectRatio {
+		width = aspectWidth(width)
+	}
+	return width, height, nil
+}
+
+// SavePNG writes an image, such as a scaled screenshot, to a PNG file
+func SavePNG(path string, img image.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer file.Close()
+
+	if err := png.Encode(file, img); err != nil {
+		return fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+	return nil
+}
+
+// pixelAt returns a pixel, clamping coordinates to the image edges
+func pixelAt(img *image.RGBA, x, y int) color.RGBA {
+	b := img.Rect
+	if x < b.Min.X {
+		x = b.Min.X
+	} else if x >= b.Max.X {
+		x = b.Max.X - 1
+	}
+	if y < b.Min.Y {
+		y = b.Min.Y
+	} else if y >= b.Max.Y {
+		y = b.Max.Y - 1
+	}
+	return img.RGBAAt(x, y)
+}
+
+// scaleNearest repeats every pixel factor times in each direction
+func scaleNearest(src *image.RGBA, factor int) *image.RGBA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w*factor, h*factor))
+	for y := 0; y < h*factor; y++ {
+		for x := 0; x < w*factor; x++ {
+			dst.SetRGBA(x, y, src.RGBAAt(src.Rect.Min.X+x/factor, src.Rect.Min.Y+y/factor))
+		}
+	}
+	return dst
+}
+
+// scaleEPX2x is the Scale2x (EPX) algorithm
+func scaleEPX2x(src *image.RGBA) *image.RGBA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w*2, h*2))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sx, sy := src.Rect.Min.X+x, src.Rect.Min.Y+y
+			b := pixelAt(src, sx, sy-1)
+			d := pixelAt(src, sx-1, sy)
+			e := pixelAt(src, sx, sy)
+			f := pixelAt(src, sx+1, sy)
+			hh := pixelAt(src, sx, sy+1)
+
+			e0, e1, e2, e3 := e, e, e, e
+			if b != hh && d != f {
+				if d == b {
+					e0 = d
+				}
+				if b == f {
+					e1 = f
+				}
+				if d == hh {
+					e2 = d
+				}
+				if hh == f {
+					e3 = f
+				}
+			}
+
+			dst.SetRGBA(x*2, y*2, e0)
+			dst.SetRGBA(x*2+1, y*2, e1)
+			dst.SetRGBA(x*2, y*2+1, e2)
+			dst.SetRGBA(x*2+1, y*2+1, e3)
+		}
+	}
+	return dst
+}
+
+// scaleEPX3x is the Scale3x (AdvMAME3x) algorithm
+func scaleEPX3x(src *image.RGBA) *image.RGBA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w*3, h*3))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sx, sy := src.Rect.Min.X+x, src.Rect.Min.Y+y
+			a := pixelAt(src, sx-1, sy-1)
+			b := pixelAt(src, sx, sy-1)
+			c := pixelAt(src, sx+1, sy-1)
+			d := pixelAt(src, sx-1, sy)
+			e := pixelAt(src, sx, sy)
+			f := pixelAt(src, sx+1, sy)
+			g := pixelAt(src, sx-1, sy+1)
+			hh := pixelAt(src, sx, sy+1)
+			i := pixelAt(src, sx+1, sy+1)
+
+			out := [9]color.RGBA{e, e, e, e, e, e, e, e, e}
+			if b != hh && d != f {
+				if d == b {
+					out[0] = d
+				}
+				if (d == b && e != c) || (b == f && e != a) {
+					out[1] = b
+				}
+				if b == f {
+					out[2] = f
+				}
+				if (d == b && e != g) || (d == hh && e != a) {
+					out[3] = d
+				}
+				if (b == f && e != i) || (hh == f && e != c) {
+					out[5] = f
+				}
+				if d == hh {
+					out[6] = d
+				}
+				if (d == hh && e != i) || (hh == f && e != g) {
+					out[7] = hh
+				}
+				if hh == f {
+					out[8] = f
+				}
+			}
+
+			for n, px := range out {
+				dst.SetRGBA(x*3+n%3, y*3+n/3, px)
+			}
+		}
+	}
+	return dst
+}
+
+// applyScanlines darkens the last output row of every source row
+func applyScanlines(img *image.RGBA, factor int, intensity float64) {
+	if factor < 2 {
+		return
+	}
+	if intensity > 1 {
+		intensity = 1
+	}
+	keep := 1 - intensity
+
+	for y := factor - 1; y < img.Rect.Dy(); y += factor {
+		row := img.Pix[y*img.Stride : y*img.Stride+img.Rect.Dx()*4]
+		for i := 0; i < len(row); i += 4 {
+			row[i] = uint8(float64(row[i]) * keep)
+			row[i+1] = uint8(float64(row[i+1]) * keep)
+			row[i+2] = uint8(float64(row[i+2]) * keep)
+		}
+	}
+}
+
+// aspectWidth returns the width an image needs for 8:7 pixels
+func aspectWidth(width int) int {
+	return int(float64(width)*pixelAspectRatio + 0.5)
+}
+
+// stretchAspect widens an image to the 8:7 pixel aspect ratio
+func stretchAspect(src *image.RGBA) *image.RGBA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dw := aspectWidth(w)
+	dst := image.NewRGBA(image.Rect(0, 0, dw, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < dw; x++ {
+			dst.SetRGBA(x, y, src.RGBAAt(src.Rect.Min.X+x*w/dw, src.Rect.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// mixColors blends colors with integer weights
+func mixColors(colors []color.RGBA, weights []int) color.RGBA {
+	var r, g, b, total int
+	for i, c := range colors {
+		r += int(c.R) * weights[i]
+		g += int(c.G) * weights[i]
+		b += int(c.B) * weights[i]
+		total += weights[i]
+	}
+	return color.RGBA{uint8(r / total), uint8(g / total), uint8(b / total), 0xFF}
+}
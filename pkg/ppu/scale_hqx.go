@@ -0,0 +1,289 @@
+// Package ppu implements the NES Picture Processing Unit emulation
+package ppu
+
+import (
+	"image"
+	"image/color"
+)
+
+// Thresholds hqx uses to decide whether two colors are different
+const (
+	hqThresholdY = 48
+	hqThresholdU = 7
+	hqThresholdV = 6
+)
+
+// hqDiff reports whether two colors differ enough to form an edge,
+// comparing them in YUV space like hqx does
+func hqDiff(a, b color.RGBA) bool {
+	if a == b {
+		return false
+	}
+	y1, u1, v1 := hqYUV(a)
+	y2, u2, v2 := hqYUV(b)
+	return hqAbs(y1-y2) > hqThresholdY || hqAbs(u1-u2) > hqThresholdU || hqAbs(v1-v2) > hqThresholdV
+}
+
+// hqYUV converts a color to the YUV space used by hqx
+func hqYUV(c color.RGBA) (int, int, int) {
+	r, g, b := int(c.R), int(c.G), int(c.B)
+	y := (299*r + 587*g + 114*b) / 1000
+	u := (-169*r-331*g+500*b)/1000 + 128
+	v := (500*r-419*g-81*b)/1000 + 128
+	return y, u, v
+}
+
+// hqAbs returns the absolute value of an integer
+func hqAbs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
+
+// hq2xTable is the hq2x lookup table for the top left quarter of a pixel,
+// indexed by which of its neighbors A to I (bits 0 to 7) differ from it
+// The other quarters use the same table with the neighborhood rotated
+// The values are the rules in hqCorner.hq2x
+var hq2xTable = [256]uint8{
+	4, 4, 6, 2, 4, 4, 6, 2, 5, 3, 15, 12, 5, 3, 17, 13,
+	4, 4, 6, 18, 4, 4, 6, 18, 5, 3, 12, 12, 5, 3, 1, 12,
+	4, 4, 6, 2, 4, 4, 6, 2, 5, 3, 17, 13, 5, 3, 16, 14,
+	4, 4, 6, 18, 4, 4, 6, 18, 5, 3, 16, 12, 5, 3, 1, 14,
+	4, 4, 6, 2, 4, 4, 6, 2, 5, 19, 12, 12, 5, 19, 16, 12,
+	4, 4, 6, 2, 4, 4, 6, 2, 5, 3, 16, 12, 5, 3, 16, 12,
+	4, 4, 6, 2, 4, 4, 6, 2, 5, 19, 1, 12, 5, 19, 1, 14,
+	4, 4, 6, 2, 4, 4, 6, 18, 5, 3, 16, 12, 5, 19, 1, 14,
+	4, 4, 6, 2, 4, 4, 6, 2, 5, 3, 15, 12, 5, 3, 17, 13,
+	4, 4, 6, 2, 4, 4, 6, 2, 5, 3, 16, 12, 5, 3, 16, 12,
+	4, 4, 6, 2, 4, 4, 6, 2, 5, 3, 17, 13, 5, 3, 16, 14,
+	4, 4, 6, 2, 4, 4, 6, 2, 5, 3, 16, 13, 5, 3, 1, 14,
+	4, 4, 6, 2, 4, 4, 6, 2, 5, 3, 16, 12, 5, 3, 16, 13,
+	4, 4, 6, 2, 4, 4, 6, 2, 5, 3, 16, 12, 5, 3, 1, 12,
+	4, 4, 6, 2, 4, 4, 6, 2, 5, 3, 16, 12, 5, 3, 1, 14,
+	4, 4, 6, 2, 4, 4, 6, 2, 5, 3, 1, 12, 5, 3, 1, 14,
+}
+
+// hqRotations lists the 3x3 neighborhood positions of each corner, rotated
+// so the corner is at the top left, in the order A B C D F G H I around E:
+//
+//	A B C
+//	D E F
+//	G H I
+var hqRotations = [4][8]int{
+	{0, 1, 2, 3, 5, 6, 7, 8}, // Top left
+	{2, 5, 8, 1, 7, 0, 3, 6}, // Top right
+	{8, 7, 6, 5, 3, 2, 1, 0}, // Bottom right
+	{6, 3, 0, 7, 1, 8, 5, 2}, // Bottom left
+}
+
+// hqCorner is a pixel's neighborhood seen from one of its corners
+type hqCorner struct {
+	e, a, b, d, f, h color.RGBA
+	rule             uint8
+}
+
+// newHQCorner rotates a 3x3 neighborhood to one of its corners and looks up
+// the corner's hq2x rule
+func newHQCorner(window *[9]color.RGBA, diff *[9]bool, corner int) hqCorner {
+	n := hqRotations[corner]
+	pattern := 0
+	for bit, i := range n {
+		if diff[i] {
+			pattern |= 1 << bit
+		}
+	}
+	return hqCorner{
+		e: window[4], a: window[n[0]], b: window[n[1]], d: window[n[3]], f: window[n[4]], h: window[n[6]],
+		rule: hq2xTable[pattern],
+	}
+}
+
+// hq2x returns the color of the corner's quarter of the pixel
+func (c hqCorner) hq2x() color.RGBA {
+	same := !hqDiff(c.b, c.d)
+	switch c.rule {
+	case 1:
+		return mixColors([]color.RGBA{c.e, c.a}, []int{3, 1})
+	case 2:
+		return mixColors([]color.RGBA{c.e, c.d}, []int{3, 1})
+	case 3:
+		return mixColors([]color.RGBA{c.e, c.b}, []int{3, 1})
+	case 4:
+		return mixColors([]color.RGBA{c.e, c.d, c.b}, []int{2, 1, 1})
+	case 5:
+		return mixColors([]color.RGBA{c.e, c.a, c.b}, []int{2, 1, 1})
+	case 6:
+		return mixColors([]color.RGBA{c.e, c.a, c.d}, []int{2, 1, 1})
+	case 12, 13, 14:
+		if !same {
+			return c.e
+		}
+	case 15, 16, 17:
+		if !same {
+			return mixColors([]color.RGBA{c.e, c.a}, []int{3, 1})
+		}
+	case 18:
+		if !hqDiff(c.b, c.f) {
+			return mixColors([]color.RGBA{c.e, c.b, c.d}, []int{5, 2, 1})
+		}
+		return mixColors([]color.RGBA{c.e, c.d}, []int{3, 1})
+	case 19:
+		if !hqDiff(c.d, c.h) {
+			return mixColors([]color.RGBA{c.e, c.d, c.b}, []int{5, 2, 1})
+		}
+		return mixColors([]color.RGBA{c.e, c.b}, []int{3, 1})
+	}
+
+	// B and D are alike, so an edge runs across the corner
+	switch c.rule {
+	case 12, 15:
+		return mixColors([]color.RGBA{c.e, c.d, c.b}, []int{2, 1, 1})
+	case 13, 17:
+		return mixColors([]color.RGBA{c.e, c.d, c.b}, []int{2, 3, 3})
+	case 14:
+		return mixColors([]color.RGBA{c.e, c.d, c.b}, []int{14, 1, 1})
+	default:
+		return mixColors([]color.RGBA{c.e, c.d, c.b}, []int{6, 1, 1})
+	}
+}
+
+// edgeB reports whether a long edge runs from the corner along B and F
+func (c hqCorner) edgeB() bool {
+	return c.rule == 18 && !hqDiff(c.b, c.f)
+}
+
+// edgeD reports whether a long edge runs from the corner along D and H
+func (c hqCorner) edgeD() bool {
+	return c.rule == 19 && !hqDiff(c.d, c.h)
+}
+
+// diagonal reports whether the corner blends strongly into B and D
+func (c hqCorner) diagonal() bool {
+	return (c.rule == 13 || c.rule == 17) && !hqDiff(c.b, c.d)
+}
+
+// hq3x returns the color of the corner pixel of a 3x3 block, given the
+// corners before and after it going clockwise
+func (c hqCorner) hq3x(prev, next hqCorner) color.RGBA {
+	switch {
+	case c.edgeB() || c.edgeD():
+		return mixColors([]color.RGBA{c.e, c.d, c.b}, []int{2, 1, 1})
+	case prev.edgeB() || next.edgeD():
+		return mixColors([]color.RGBA{c.d, c.b}, []int{1, 1})
+	}
+
+	same := !hqDiff(c.b, c.d)
+	switch c.rule {
+	case 1, 5, 6:
+		return mixColors([]color.RGBA{c.e, c.a}, []int{3, 1})
+	case 2, 18:
+		return mixColors([]color.RGBA{c.e, c.d}, []int{3, 1})
+	case 3, 19:
+		return mixColors([]color.RGBA{c.e, c.b}, []int{3, 1})
+	case 12, 14:
+		if !same {
+			return c.e
+		}
+	case 13:
+		if !same {
+			return c.e
+		}
+		return mixColors([]color.RGBA{c.e, c.d, c.b}, []int{2, 7, 7})
+	case 15, 16:
+		if !same {
+			return mixColors([]color.RGBA{c.e, c.a}, []int{3, 1})
+		}
+	case 17:
+		if !same {
+			return mixColors([]color.RGBA{c.e, c.a}, []int{3, 1})
+		}
+		return mixColors([]color.RGBA{c.e, c.d, c.b}, []int{2, 7, 7})
+	}
+	return mixColors([]color.RGBA{c.e, c.d, c.b}, []int{2, 1, 1})
+}
+
+// hq3xSide returns the color of the side pixel of a 3x3 block between a
+// corner's B and the next corner's D, given the corners of the block
+// clockwise from the first one
+func hq3xSide(corners [4]hqCorner) color.RGBA {
+	c, next, opposite, prev := corners[0], corners[1], corners[2], corners[3]
+	switch {
+	case c.edgeB() || next.edgeD():
+		return mixColors([]color.RGBA{c.b, c.e}, []int{3, 1})
+	case c.diagonal() || next.diagonal():
+		return mixColors([]color.RGBA{c.e, c.b}, []int{7, 1})
+	case prev.edgeB() || opposite.edgeD() || !hqDiff(c.e, c.b):
+		return mixColors([]color.RGBA{c.e, c.b}, []int{3, 1})
+	}
+	return c.e
+}
+
+// hqWindow returns the 3x3 neighborhood of a pixel, and which of the
+// neighbors differ from the pixel
+func hqWindow(src *image.RGBA, x, y int) ([9]color.RGBA, [9]bool) {
+	var window [9]color.RGBA
+	var diff [9]bool
+	for i := range window {
+		window[i] = pixelAt(src, x+i%3-1, y+i/3-1)
+	}
+	for i := range diff {
+		diff[i] = hqDiff(window[4], window[i])
+	}
+	return window, diff
+}
+
+// scaleHQ2x is Maxim Stepin's hq2x, driven by the 256-pattern lookup table
+func scaleHQ2x(src *image.RGBA) *image.RGBA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w*2, h*2))
+
+	// Output offsets of the corners in hqRotations order
+	offsets := [4][2]int{{0, 0}, {1, 0}, {1, 1}, {0, 1}}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			window, diff := hqWindow(src, src.Rect.Min.X+x, src.Rect.Min.Y+y)
+			for corner, offset := range offsets {
+				c := newHQCorner(&window, &diff, corner)
+				dst.SetRGBA(x*2+offset[0], y*2+offset[1], c.hq2x())
+			}
+		}
+	}
+	return dst
+}
+
+// scaleHQ3x is hq3x, with each corner's case picked from the hq2x table and
+// carried over to hq3x's 3x3 interpolations
+func scaleHQ3x(src *image.RGBA) *image.RGBA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w*3, h*3))
+
+	// Output offsets of the corners in hqRotations order, and of the side
+	// clockwise after each corner
+	cornerOffsets := [4][2]int{{0, 0}, {2, 0}, {2, 2}, {0, 2}}
+	sideOffsets := [4][2]int{{1, 0}, {2, 1}, {1, 2}, {0, 1}}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			window, diff := hqWindow(src, src.Rect.Min.X+x, src.Rect.Min.Y+y)
+			var corners [4]hqCorner
+			for i := range corners {
+				corners[i] = newHQCorner(&window, &diff, i)
+			}
+
+			ox, oy := x*3, y*3
+			dst.SetRGBA(ox+1, oy+1, window[4])
+			for i := range corners {
+				prev, next := corners[(i+3)%4], corners[(i+1)%4]
+				offset := cornerOffsets[i]
+				dst.SetRGBA(ox+offset[0], oy+offset[1], corners[i].hq3x(prev, next))
+
+				clockwise := [4]hqCorner{corners[i], next, corners[(i+2)%4], prev}
+				offset = sideOffsets[i]
+				dst.SetRGBA(ox+offset[0], oy+offset[1], hq3xSide(clockwise))
+			}
+		}
+	}
+	return dst
+}
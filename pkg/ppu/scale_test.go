@@ -0,0 +1,152 @@
+package ppu
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// grayImage builds an image from rows of gray levels
+func grayImage(rows [][]uint8) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, len(rows[0]), len(rows)))
+	for y, row := range rows {
+		for x, level := range row {
+			img.SetRGBA(x, y, color.RGBA{level, level, level, 0xFF})
+		}
+	}
+	return img
+}
+
+// staircase is a 45 degree edge between black and light gray
+var staircase = [][]uint8{
+	{200, 200, 200, 200},
+	{0, 200, 200, 200},
+	{0, 0, 200, 200},
+	{0, 0, 0, 200},
+}
+
+func TestScaleSolid(t *testing.T) {
+	gray := color.RGBA{0x55, 0x66, 0x77, 0xFF}
+	src := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	for i := 0; i < len(src.Pix); i += 4 {
+		src.Pix[i], src.Pix[i+1], src.Pix[i+2], src.Pix[i+3] = gray.R, gray.G, gray.B, gray.A
+	}
+
+	for _, filter := range ScaleFilters {
+		t.Run(filter, func(t *testing.T) {
+			options := ScaleOptions{Filter: filter, Factor: 2}
+			dst, err := Scale(src, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w, h, err := ScaledSize(4, 3, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dst.Rect.Dx() != w || dst.Rect.Dy() != h {
+				t.Fatalf("size = %dx%d, ScaledSize = %dx%d", dst.Rect.Dx(), dst.Rect.Dy(), w, h)
+			}
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					if got := dst.RGBAAt(x, y); got != gray {
+						t.Fatalf("pixel (%d, %d) = %v, want %v", x, y, got, gray)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestScalePixels(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter string
+		src    [][]uint8
+		x, y   int       // Source pixel to check
+		want   [][]uint8 // Its scaled block
+	}{
+		{
+			name:   "scale2x corner",
+			filter: Scale2x,
+			src:    [][]uint8{{0, 0, 200}, {0, 200, 200}, {200, 200, 200}},
+			x:      1, y: 1,
+			want: [][]uint8{{0, 200}, {200, 200}},
+		},
+		{
+			name:   "scale2x checkerboard is kept",
+			filter: Scale2x,
+			src:    [][]uint8{{0, 200, 0}, {200, 0, 200}, {0, 200, 0}},
+			x:      1, y: 1,
+			want: [][]uint8{{0, 0}, {0, 0}},
+		},
+		{
+			name:   "scale3x corner",
+			filter: Scale3x,
+			src:    [][]uint8{{0, 0, 200}, {0, 200, 200}, {200, 200, 200}},
+			x:      1, y: 1,
+			want: [][]uint8{{0, 200, 200}, {200, 200, 200}, {200, 200, 200}},
+		},
+		{
+			name:   "scale3x corner below a line",
+			filter: Scale3x,
+			src:    [][]uint8{{200, 0, 0}, {0, 200, 200}, {200, 200, 200}},
+			x:      1, y: 1,
+			want: [][]uint8{{0, 0, 200}, {200, 200, 200}, {200, 200, 200}},
+		},
+		{
+			name:   "hq2x diagonal",
+			filter: ScaleHQ2x,
+			src:    staircase,
+			x:      1, y: 1,
+			want: [][]uint8{{200, 200}, {100, 200}},
+		},
+		{
+			name:   "xbrz2x diagonal",
+			filter: ScaleXBRZ2x,
+			src:    staircase,
+			x:      1, y: 1,
+			want: [][]uint8{{200, 200}, {100, 200}},
+		},
+		{
+			name:   "xbrz3x diagonal",
+			filter: ScaleXBRZ3x,
+			src:    staircase,
+			x:      1, y: 1,
+			want: [][]uint8{{200, 200, 200}, {175, 200, 200}, {25, 175, 200}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst, err := Scale(grayImage(tt.src), ScaleOptions{Filter: tt.filter})
+			if err != nil {
+				t.Fatal(err)
+			}
+			factor := len(tt.want)
+			for i, row := range tt.want {
+				for j, want := range row {
+					x, y := tt.x*factor+j, tt.y*factor+i
+					if got := dst.RGBAAt(x, y).R; got != want {
+						t.Errorf("pixel (%d, %d) = %d, want %d", x, y, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestScanlinesAndAspect(t *testing.T) {
+	src := grayImage([][]uint8{{200, 200}, {200, 200}})
+	dst, err := Scale(src, ScaleOptions{Factor: 2, Scanlines: 0.5, AspectRatio: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w, h := dst.Rect.Dx(), dst.Rect.Dy(); w != 5 || h != 4 {
+		t.Fatalf("size = %dx%d, want 5x4", w, h)
+	}
+	for y, want := range []uint8{200, 100, 200, 100} {
+		if got := dst.RGBAAt(0, y).R; got != want {
+			t.Errorf("row %d = %d, want %d", y, got, want)
+		}
+	}
+}
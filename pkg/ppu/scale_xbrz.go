@@ -0,0 +1,253 @@
+// Package ppu implements the NES Picture Processing Unit emulation
+package ppu
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// xBRZ tuning, the defaults of the reference implementation
+const (
+	xbrzEqualColorTolerance        = 30.0
+	xbrzCenterDirectionBias        = 4.0
+	xbrzDominantDirectionThreshold = 3.6
+	xbrzSteepDirectionThreshold    = 2.2
+)
+
+// How strongly a pixel corner gets blended
+const (
+	xbrzBlendNone uint8 = iota
+	xbrzBlendNormal
+	xbrzBlendDominant
+)
+
+// Pixel corners in clockwise order, so rotating the kernel by 90 degrees
+// moves each corner to the next index
+const (
+	xbrzBottomRight = iota
+	xbrzBottomLeft
+	xbrzTopLeft
+	xbrzTopRight
+)
+
+// xbrzOp blends the line color into one output sub-pixel of the bottom-right
+// corner, at row i and column j, with an alpha of num/den
+type xbrzOp struct {
+	i, j     int
+	num, den int
+}
+
+// xbrzShapes holds the sub-pixel blends of each line shape for one scale factor
+type xbrzShapes struct {
+	shallow, steep, steepAndShallow, diagonal, corner []xbrzOp
+}
+
+// xbrzScalers holds the blend shapes for each supported factor
+var xbrzScalers = map[int]xbrzShapes{
+	2: {
+		shallow:         []xbrzOp{{1, 0, 1, 4}, {1, 1, 3, 4}},
+		steep:           []xbrzOp{{0, 1, 1, 4}, {1, 1, 3, 4}},
+		steepAndShallow: []xbrzOp{{1, 0, 1, 4}, {0, 1, 1, 4}, {1, 1, 5, 6}},
+		diagonal:        []xbrzOp{{1, 1, 1, 2}},
+		corner:          []xbrzOp{{1, 1, 21, 100}},
+	},
+	3: {
+		shallow:         []xbrzOp{{2, 0, 1, 4}, {1, 2, 1, 4}, {2, 1, 3, 4}, {2, 2, 1, 1}},
+		steep:           []xbrzOp{{0, 2, 1, 4}, {2, 1, 1, 4}, {1, 2, 3, 4}, {2, 2, 1, 1}},
+		steepAndShallow: []xbrzOp{{2, 0, 1, 4}, {0, 2, 1, 4}, {2, 1, 3, 4}, {1, 2, 3, 4}, {2, 2, 1, 1}},
+		diagonal:        []xbrzOp{{1, 2, 1, 8}, {2, 1, 1, 8}, {2, 2, 7, 8}},
+		corner:          []xbrzOp{{2, 2, 45, 100}},
+	},
+	4: {
+		shallow:         []xbrzOp{{3, 0, 1, 4}, {2, 2, 1, 4}, {3, 1, 3, 4}, {2, 3, 3, 4}, {3, 2, 1, 1}, {3, 3, 1, 1}},
+		steep:           []xbrzOp{{0, 3, 1, 4}, {2, 2, 1, 4}, {1, 3, 3, 4}, {3, 2, 3, 4}, {2, 3, 1, 1}, {3, 3, 1, 1}},
+		steepAndShallow: []xbrzOp{{3, 1, 3, 4}, {1, 3, 3, 4}, {3, 0, 1, 4}, {0, 3, 1, 4}, {2, 2, 1, 3}, {3, 3, 1, 1}, {3, 2, 1, 1}, {2, 3, 1, 1}},
+		diagonal:        []xbrzOp{{3, 2, 1, 2}, {2, 3, 1, 2}, {3, 3, 1, 1}},
+		corner:          []xbrzOp{{3, 3, 68, 100}, {3, 2, 9, 100}, {2, 3, 9, 100}},
+	},
+}
+
+// xbrzDist is the perceptual distance between two colors in YCbCr space
+func xbrzDist(a, b color.RGBA) float64 {
+	const kb = 0.0593
+	const kr = 0.2627
+	const kg = 1 - kb - kr
+	const scaleB = 0.5 / (1 - kb)
+	const scaleR = 0.5 / (1 - kr)
+
+	dr := float64(a.R) - float64(b.R)
+	dg := float64(a.G) - float64(b.G)
+	db := float64(a.B) - float64(b.B)
+
+	y := kr*dr + kg*dg + kb*db
+	cb := scaleB * (db - y)
+	cr := scaleR * (dr - y)
+	return math.Sqrt(y*y + cb*cb + cr*cr)
+}
+
+// xbrzEq reports whether two colors are close enough to count as equal
+func xbrzEq(a, b color.RGBA) bool {
+	return xbrzDist(a, b) < xbrzEqualColorTolerance
+}
+
+// scaleXBRZ is the xBRZ upscaler
+func scaleXBRZ(src *image.RGBA, factor int) *image.RGBA {
+	shapes := xbrzScalers[factor]
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w*factor, h*factor))
+
+	blends := xbrzPreprocess(src)
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sx, sy := src.Rect.Min.X+x, src.Rect.Min.Y+y
+			center := src.RGBAAt(sx, sy)
+			for i := 0; i < factor; i++ {
+				for j := 0; j < factor; j++ {
+					dst.SetRGBA(x*factor+j, y*factor+i, center)
+				}
+			}
+
+			for rotation := 0; rotation < 4; rotation++ {
+				xbrzBlendCorner(src, dst, sx, sy, x*factor, y*factor, factor, rotation, blends[y*w+x], shapes)
+			}
+		}
+	}
+	return dst
+}
+
+// xbrzPreprocess decides for every corner of every pixel whether it lies on
+// an edge, looking at each 2x2 block of pixels with its 4x4 surroundings
+func xbrzPreprocess(src *image.RGBA) [][4]uint8 {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	blends := make([][4]uint8, w*h)
+
+	set := func(x, y, corner int, blend uint8) {
+		if x >= 0 && x < w && y >= 0 && y < h {
+			blends[y*w+x][corner] = blend
+		}
+	}
+
+	for y := -1; y < h; y++ {
+		for x := -1; x < w; x++ {
+			at := func(dx, dy int) color.RGBA {
+				return pixelAt(src, src.Rect.Min.X+x+dx, src.Rect.Min.Y+y+dy)
+			}
+
+			// F G, J K is the 2x2 block in the middle
+			b, c := at(0, -1), at(1, -1)
+			e, f, g, hh := at(-1, 0), at(0, 0), at(1, 0), at(2, 0)
+			i, j, k, l := at(-1, 1), at(0, 1), at(1, 1), at(2, 1)
+			n, o := at(0, 2), at(1, 2)
+
+			if (f == g && j == k) || (f == j && g == k) {
+				continue
+			}
+
+			jg := xbrzDist(i, f) + xbrzDist(f, c) + xbrzDist(n, k) + xbrzDist(k, hh) + xbrzCenterDirectionBias*xbrzDist(j, g)
+			fk := xbrzDist(e, j) + xbrzDist(j, o) + xbrzDist(b, g) + xbrzDist(g, l) + xbrzCenterDirectionBias*xbrzDist(f, k)
+
+			if jg < fk {
+				blend := xbrzBlendNormal
+				if xbrzDominantDirectionThreshold*jg < fk {
+					blend = xbrzBlendDominant
+				}
+				if f != g && f != j {
+					set(x, y, xbrzBottomRight, blend)
+				}
+				if k != j && k != g {
+					set(x+1, y+1, xbrzTopLeft, blend)
+				}
+			} else if fk < jg {
+				blend := xbrzBlendNormal
+				if xbrzDominantDirectionThreshold*fk < jg {
+					blend = xbrzBlendDominant
+				}
+				if j != f && j != k {
+					set(x, y+1, xbrzTopRight, blend)
+				}
+				if g != f && g != k {
+					set(x+1, y, xbrzBottomLeft, blend)
+				}
+			}
+		}
+	}
+	return blends
+}
+
+// xbrzBlendCorner blends one corner of a scaled pixel
+// The kernel is rotated so the corner being handled is always the bottom-right one
+func xbrzBlendCorner(src, dst *image.RGBA, sx, sy, ox, oy, factor, rotation int, blend [4]uint8, shapes xbrzShapes) {
+	bottomRight := blend[(xbrzBottomRight+rotation)%4]
+	if bottomRight < xbrzBlendNormal {
+		return
+	}
+	topRight := blend[(xbrzTopRight+rotation)%4]
+	bottomLeft := blend[(xbrzBottomLeft+rotation)%4]
+
+	at := func(dx, dy int) color.RGBA {
+		for r := 0; r < rotation; r++ {
+			dx, dy = -dy, dx
+		}
+		return pixelAt(src, sx+dx, sy+dy)
+	}
+
+	// a b c
+	// d e f
+	// g h i
+	b, c := at(0, -1), at(1, -1)
+	d, e, f := at(-1, 0), at(0, 0), at(1, 0)
+	g, hh, i := at(-1, 1), at(0, 1), at(1, 1)
+
+	doLineBlend := true
+	switch {
+	case bottomRight >= xbrzBlendDominant:
+		doLineBlend = true
+	case topRight != xbrzBlendNone && !xbrzEq(e, g):
+		// Keep the corners of thin lines
+		doLineBlend = false
+	case bottomLeft != xbrzBlendNone && !xbrzEq(e, c):
+		doLineBlend = false
+	case !xbrzEq(e, i) && xbrzEq(g, hh) && xbrzEq(hh, i) && xbrzEq(i, f) && xbrzEq(f, c):
+		// No blending when the corner sits in a flat area
+		doLineBlend = false
+	}
+
+	px := hh
+	if xbrzDist(e, f) <= xbrzDist(e, hh) {
+		px = f
+	}
+
+	ops := shapes.corner
+	if doLineBlend {
+		fg := xbrzDist(f, g)
+		hc := xbrzDist(hh, c)
+		shallow := xbrzSteepDirectionThreshold*fg <= hc && e != g && d != g
+		steep := xbrzSteepDirectionThreshold*hc <= fg && e != c && b != c
+
+		switch {
+		case shallow && steep:
+			ops = shapes.steepAndShallow
+		case shallow:
+			ops = shapes.shallow
+		case steep:
+			ops = shapes.steep
+		default:
+			ops = shapes.diagonal
+		}
+	}
+
+	for _, op := range ops {
+		// Rotate the sub-pixel position around the center of the block
+		x2, y2 := 2*op.j-(factor-1), 2*op.i-(factor-1)
+		for r := 0; r < rotation; r++ {
+			x2, y2 = -y2, x2
+		}
+		outX := ox + (x2+factor-1)/2
+		outY := oy + (y2+factor-1)/2
+
+		back := dst.RGBAAt(outX, outY)
+		dst.SetRGBA(outX, outY, mixColors([]color.RGBA{px, back}, []int{op.num, op.den - op.num}))
+	}
+}
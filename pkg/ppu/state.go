@@ -0,0 +1,56 @@
+// Package ppu implements the NES Picture Processing Unit emulation
+package ppu
+
+import (
+	"fmt"
+
+	"github.com/example/my-golang-project/pkg/savestate"
+)
+
+// Serialize saves or loads the registers, the internal v/t/x/w registers,
+// VRAM, OAM, palette RAM and the position in the frame
+// The rendering buffers are not included, the next frame redraws them
+func (p *PPU) Serialize(s *savestate.Serializer) {
+	s.Section("PPU ")
+	s.Uint8(&p.PPUCTRL)
+	s.Uint8(&p.PPUMASK)
+	s.Uint8(&p.PPUSTATUS)
+	s.Uint8(&p.OAMADDR)
+	s.Uint8(&p.OAMDATA)
+	s.Uint8(&p.PPUSCROLL)
+	s.Uint8(&p.PPUADDR)
+	s.Uint8(&p.PPUDATA)
+
+	s.Bytes(p.VRAM)
+	s.Bytes(p.OAM)
+	s.Bytes(p.Palette)
+
+	s.Uint16(&p.v)
+	s.Uint16(&p.t)
+	s.Uint8(&p.x)
+	s.Uint8(&p.w)
+
+	s.Int(&p.Scanline)
+	s.Int(&p.Cycle)
+	s.Bool(&p.FrameComplete)
+
+	s.Bool(&p.nmiOccurred)
+	s.Bool(&p.nmiOutput)
+	s.Bool(&p.nmiPrevious)
+	s.Uint8(&p.nmiDelay)
+	s.Bool(&p.suppressVBlank)
+	s.Bool(&p.oddFrame)
+
+	s.Uint8(&p.readBuffer)
+	s.Int(&p.warmUp)
+	s.Uint8(&p.ioLatch)
+	s.Bytes(p.ioLatchDecay[:])
+
+	s.Int(&p.framePhase)
+	s.Int(&p.frontPhase)
+	s.Int(&p.frameDots)
+
+	if p.Scanline < 0 || p.Scanline > p.preRenderLine() || p.Cycle < 0 || p.Cycle > 340 {
+		s.Fail(fmt.Errorf("invalid PPU position: scanline %d, dot %d", p.Scanline, p.Cycle))
+	}
+}
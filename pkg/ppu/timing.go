@@ -0,0 +1,62 @@
+// Package ppu implements the NES Picture Processing Unit emulation
+package ppu
+
+// Timing describes the frame layout of a PPU variant
+type Timing struct {
+	Scanlines  int  // Scanlines per frame, including the pre-render line
+	VBlankLine int  // Scanline on which VBlank starts
+	SkipOddDot bool // Odd frames drop a dot on the pre-render line while rendering
+
+	// The PAL PPU swaps the meaning of the red and green emphasis bits
+	SwapRedGreenEmphasis bool
+
+	// PPU dots before writes to PPUCTRL, PPUMASK, PPUSCROLL and PPUADDR
+	// take effect after power-on or reset
+	WarmUpDots int
+}
+
+// NTSCTiming is the 2C02 used in North American and Japanese consoles
+var NTSCTiming = Timing{
+	Scanlines:  262,
+	VBlankLine: 241,
+	SkipOddDot: true,
+	WarmUpDots: 29658 * 3,
+
+	SwapRedGreenEmphasis: false,
+}
+
+// PALTiming is the 2C07 used in European consoles
+var PALTiming = Timing{
+	Scanlines:  312,
+	VBlankLine: 241,
+	SkipOddDot: false,
+	WarmUpDots: 33132 * 16 / 5,
+
+	SwapRedGreenEmphasis: true,
+}
+
+// DendyTiming is the UA6538 used in Dendy famiclones, which keep PAL's frame
+// length but start VBlank 50 lines late so NMI timing resembles NTSC
+var DendyTiming = Timing{
+	Scanlines:  312,
+	VBlankLine: 291,
+	SkipOddDot: false,
+	WarmUpDots: 33132 * 3,
+
+	SwapRedGreenEmphasis: true,
+}
+
+// SetTiming selects the frame layout of the PPU
+func (p *PPU) SetTiming(timing Timing) {
+	p.timing = timing
+}
+
+// GetTiming returns the frame layout of the PPU
+func (p *PPU) GetTiming() Timing {
+	return p.timing
+}
+
+// preRenderLine returns the scanline number of the pre-render line
+func (p *PPU) preRenderLine() int {
+	return p.timing.Scanlines - 1
+}
@@ -0,0 +1,135 @@
+// Package savestate implements the binary encoding of emulator save states
+package savestate
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Serializer writes or reads the fields of a save state
+// Components describe their state once, calling the same methods in the same
+// order for both directions: when saving the values are written, when loading
+// they are read back into the same variables. Values are little-endian.
+// The first error stops all further reads and writes and is kept in Err.
+type Serializer struct {
+	w       io.Writer
+	r       io.Reader
+	loading bool
+	err     error
+	buf     [8]byte
+}
+
+// NewWriter creates a Serializer that saves to w
+func NewWriter(w io.Writer) *Serializer {
+	return &Serializer{w: w}
+}
+
+// NewReader creates a Serializer that loads from r
+func NewReader(r io.Reader) *Serializer {
+	return &Serializer{r: r, loading: true}
+}
+
+// Loading reports whether the state is being loaded
+func (s *Serializer) Loading() bool {
+	return s.loading
+}
+
+// Err returns the first error that happened
+func (s *Serializer) Err() error {
+	return s.err
+}
+
+// Fail records an error, e.g. a loaded value out of range
+func (s *Serializer) Fail(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// transfer writes or reads the first n bytes of buf
+func (s *Serializer) transfer(n int) bool {
+	if s.err != nil {
+		return false
+	}
+	if s.loading {
+		_, s.err = io.ReadFull(s.r, s.buf[:n])
+	} else {
+		_, s.err = s.w.Write(s.buf[:n])
+	}
+	return s.err == nil
+}
+
+// Section writes a 4-character tag, or checks it when loading, so a state
+// saved with a different layout is reported instead of loaded as garbage
+func (s *Serializer) Section(tag string) {
+	if len(tag) != 4 {
+		panic("savestate: section tags are 4 characters")
+	}
+	copy(s.buf[:4], tag)
+	if s.transfer(4) && s.loading && string(s.buf[:4]) != tag {
+		s.Fail(fmt.Errorf("save state section %q found where %q was expected", s.buf[:4], tag))
+	}
+}
+
+// Uint8 saves or loads a byte
+func (s *Serializer) Uint8(v *uint8) {
+	s.buf[0] = *v
+	if s.transfer(1) {
+		*v = s.buf[0]
+	}
+}
+
+// Bool saves or loads a flag as a byte
+func (s *Serializer) Bool(v *bool) {
+	s.buf[0] = 0
+	if *v {
+		s.buf[0] = 1
+	}
+	if s.transfer(1) {
+		*v = s.buf[0] != 0
+	}
+}
+
+// Uint16 saves or loads a 16-bit value
+func (s *Serializer) Uint16(v *uint16) {
+	binary.LittleEndian.PutUint16(s.buf[:], *v)
+	if s.transfer(2) {
+		*v = binary.LittleEndian.Uint16(s.buf[:])
+	}
+}
+
+// Uint32 saves or loads a 32-bit value
+func (s *Serializer) Uint32(v *uint32) {
+	binary.LittleEndian.PutUint32(s.buf[:], *v)
+	if s.transfer(4) {
+		*v = binary.LittleEndian.Uint32(s.buf[:])
+	}
+}
+
+// Uint64 saves or loads a 64-bit value
+func (s *Serializer) Uint64(v *uint64) {
+	binary.LittleEndian.PutUint64(s.buf[:], *v)
+	if s.transfer(8) {
+		*v = binary.LittleEndian.Uint64(s.buf[:])
+	}
+}
+
+// Int saves or loads an int as 64 bits
+func (s *Serializer) Int(v *int) {
+	value := uint64(int64(*v))
+	s.Uint64(&value)
+	*v = int(int64(value))
+}
+
+// Bytes saves or loads a block of memory of fixed size
+func (s *Serializer) Bytes(b []byte) {
+	if s.err != nil {
+		return
+	}
+	if s.loading {
+		_, s.err = io.ReadFull(s.r, b)
+	} else {
+		_, s.err = s.w.Write(b)
+	}
+}